@@ -0,0 +1,120 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/theadell/dnsify/internal/acme"
+	"github.com/theadell/dnsify/internal/dnsservice"
+)
+
+// HTTPReqChallenge is the body of the present and cleanup requests of lego's httpreq provider.
+// In its default mode the client sends the FQDN and value of the challenge record, in RAW mode
+// the domain and the key authorization the value is derived from.
+type HTTPReqChallenge struct {
+	FQDN    string `json:"fqdn"`
+	Value   string `json:"value"`
+	Domain  string `json:"domain"`
+	Token   string `json:"token"`
+	KeyAuth string `json:"keyAuth"`
+}
+
+// record returns the name and value of the challenge record.
+func (c HTTPReqChallenge) record() (string, string) {
+	if c.FQDN == "" && c.Domain != "" {
+		return acme.ChallengeName(c.Domain), acme.KeyAuthorizationDigest(c.KeyAuth)
+	}
+	return c.FQDN, c.Value
+}
+
+// ACMEDNSUpdate is the body of an acme-dns update request. Without acme-dns registrations the
+// subdomain is the domain the certificate is for, or its challenge name.
+type ACMEDNSUpdate struct {
+	Subdomain string `json:"subdomain"`
+	TXT       string `json:"txt"`
+}
+
+// HTTPReqPresentHandler publishes a challenge record for lego's httpreq provider.
+func (app *App) HTTPReqPresentHandler(w http.ResponseWriter, r *http.Request) {
+	var req HTTPReqChallenge
+	if err := app.decodeJSON(w, r, &req); err != nil {
+		app.apiError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	ctx, cancel := dnsContext(r)
+	defer cancel()
+	fqdn, value := req.record()
+	if err := app.challenges.Present(ctx, fqdn, value); err != nil {
+		app.handleACMEError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// HTTPReqCleanupHandler removes a challenge record for lego's httpreq provider.
+func (app *App) HTTPReqCleanupHandler(w http.ResponseWriter, r *http.Request) {
+	var req HTTPReqChallenge
+	if err := app.decodeJSON(w, r, &req); err != nil {
+		app.apiError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	ctx, cancel := dnsContext(r)
+	defer cancel()
+	fqdn, value := req.record()
+	if err := app.challenges.CleanUp(ctx, fqdn, value); err != nil {
+		app.handleACMEError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// ACMEDNSUpdateHandler publishes a challenge record for acme-dns clients. The two most recent
+// records of a name are kept, older ones are removed.
+func (app *App) ACMEDNSUpdateHandler(w http.ResponseWriter, r *http.Request) {
+	var req ACMEDNSUpdate
+	if err := app.decodeJSON(w, r, &req); err != nil {
+		app.apiError(w, http.StatusBadRequest, "bad_request")
+		return
+	}
+	if req.Subdomain == "" {
+		app.apiError(w, http.StatusBadRequest, "bad_subdomain")
+		return
+	}
+	ctx, cancel := dnsContext(r)
+	defer cancel()
+	err := app.challenges.Update(ctx, acme.ChallengeName(req.Subdomain), req.TXT)
+	switch {
+	case errors.Is(err, acme.ErrInvalidChallenge):
+		app.apiError(w, http.StatusBadRequest, "bad_txt")
+	case errors.Is(err, acme.ErrNotChallenge), errors.Is(err, dnsservice.ErrZoneNotFound):
+		app.apiError(w, http.StatusBadRequest, "bad_subdomain")
+	case err != nil:
+		app.handleACMEError(w, err)
+	default:
+		app.writeJSON(w, http.StatusOK, map[string]string{"txt": req.TXT})
+	}
+}
+
+func (app *App) handleACMEError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, acme.ErrNotChallenge):
+		app.apiError(w, http.StatusForbidden, "Only _acme-challenge TXT records can be changed")
+	case errors.Is(err, acme.ErrInvalidChallenge):
+		app.apiError(w, http.StatusBadRequest, err.Error())
+	case errors.Is(err, dnsservice.ErrZoneNotFound):
+		app.apiError(w, http.StatusNotFound, "Zone not found")
+	default:
+		handleAPIDNSError(err, w, app)
+	}
+}
+
+// acmeUnauthorized answers ACME requests without valid credentials.
+func (app *App) acmeUnauthorized(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("WWW-Authenticate", `Basic realm="DNSify"`)
+	app.apiError(w, http.StatusUnauthorized, "unauthorized")
+}
+
+// apiKeyScopeDenied answers requests made with an API key that is limited to ACME challenges.
+func (app *App) apiKeyScopeDenied(w http.ResponseWriter, r *http.Request) {
+	app.apiError(w, http.StatusForbidden, "The API key is limited to ACME challenges")
+}
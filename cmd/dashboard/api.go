@@ -0,0 +1,321 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/theadell/dnsify/internal/dnsservice"
+)
+
+func (app *App) APIListRecordsHandler(w http.ResponseWriter, r *http.Request) {
+	records, ok := app.filteredRecords(w, r)
+	if !ok {
+		return
+	}
+
+	response := make([]RecordResponse, 0, len(records))
+	for _, record := range records {
+		response = append(response, NewRecordResponse(record))
+	}
+	app.writeJSON(w, http.StatusOK, response)
+}
+
+func (app *App) APIListRecordSetsHandler(w http.ResponseWriter, r *http.Request) {
+	records, ok := app.filteredRecords(w, r)
+	if !ok {
+		return
+	}
+
+	sets := dnsservice.GroupRecordSets(records)
+	response := make([]RecordSetResponse, 0, len(sets))
+	for _, set := range sets {
+		response = append(response, NewRecordSetResponse(set))
+	}
+	app.writeJSON(w, http.StatusOK, response)
+}
+
+// filteredRecords returns the records of the zone, filtered by the optional type and name query
+// parameters. It answers the request and reports false if the filter is invalid.
+func (app *App) filteredRecords(w http.ResponseWriter, r *http.Request) ([]dnsservice.Record, bool) {
+	recordType := strings.ToUpper(r.URL.Query().Get("type"))
+	name := r.URL.Query().Get("name")
+
+	if recordType != "" && !dnsservice.IsSupportedType(recordType) {
+		app.apiError(w, http.StatusBadRequest, "Unsupported record type")
+		return nil, false
+	}
+
+	client := app.dnsClient(r)
+	records := slices.DeleteFunc(client.GetRecords(), func(record dnsservice.Record) bool {
+		if recordType != "" && record.Data.RecordType() != recordType {
+			return true
+		}
+		return name != "" && !matchesName(record.Name, name, client.GetZone())
+	})
+	return records, true
+}
+
+func (app *App) APIGetRecordHandler(w http.ResponseWriter, r *http.Request) {
+	record := app.dnsClient(r).GetRecordByHash(chi.URLParam(r, "hash"))
+	if record == nil {
+		app.apiError(w, http.StatusNotFound, "No matching record found")
+		return
+	}
+	app.writeJSON(w, http.StatusOK, NewRecordResponse(*record))
+}
+
+// APICreateRecordHandler adds the record to the record set of its name and type. With
+// ?plan=true it returns the plan of adding the record instead.
+func (app *App) APICreateRecordHandler(w http.ResponseWriter, r *http.Request) {
+	record, err := app.recordFromRequest(w, r)
+	if err != nil {
+		app.apiError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	for _, existing := range app.dnsClient(r).GetRecords() {
+		if dnsservice.SameRecord(existing, *record) {
+			app.apiError(w, http.StatusConflict, fmt.Sprintf("The %s record %s of %s already exists", record.Data.RecordType(), record.Data.Value(), record.Name))
+			return
+		}
+	}
+	if planRequested(r) {
+		app.writePlan(w, r, dnsservice.ChangeSet{Add: []dnsservice.Record{*record}})
+		return
+	}
+	// the record joins the record set of its name and type
+	ctx, cancel := dnsContext(r)
+	defer cancel()
+	if err := app.dnsClient(r).AddRecord(ctx, *record); err != nil {
+		handleAPIDNSError(err, w, app)
+		return
+	}
+	app.writeJSON(w, http.StatusCreated, NewRecordResponse(*record))
+}
+
+// APIUpsertRecordHandler replaces the record set of the name and type of the record with
+// the record.
+func (app *App) APIUpsertRecordHandler(w http.ResponseWriter, r *http.Request) {
+	record, err := app.recordFromRequest(w, r)
+	if err != nil {
+		app.apiError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	set := dnsservice.RecordSet{Name: record.Name, Type: record.Data.RecordType(), TTL: record.TTL, Records: []dnsservice.Record{*record}}
+	ctx, cancel := dnsContext(r)
+	defer cancel()
+	if err := app.dnsClient(r).ReplaceRecordSet(ctx, set); err != nil {
+		handleAPIDNSError(err, w, app)
+		return
+	}
+	app.writeJSON(w, http.StatusOK, NewRecordResponse(*record))
+}
+
+// APIReplaceRecordSetHandler replaces all records of a record set. A set without records
+// deletes the record set.
+func (app *App) APIReplaceRecordSetHandler(w http.ResponseWriter, r *http.Request) {
+	var req RecordSetRequest
+	if err := app.decodeJSON(w, r, &req); err != nil {
+		app.apiError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	recordType := strings.ToUpper(req.Type)
+	t, ok := dnsservice.LookupRecordType(recordType)
+	if !ok {
+		app.apiError(w, http.StatusBadRequest, "Unsupported record type")
+		return
+	}
+	if t.Singleton && len(req.Records) > 1 {
+		app.apiError(w, http.StatusBadRequest, fmt.Sprintf("A %s record set can only hold a single record", recordType))
+		return
+	}
+	zone := app.dnsClient(r).GetZone()
+	name, err := dnsservice.ZoneFQDN(req.Name, zone)
+	if err != nil {
+		app.apiError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	set := dnsservice.RecordSet{Name: name, Type: recordType, TTL: req.TTL}
+	for i, raw := range req.Records {
+		data, err := decodeRecordData(recordType, raw)
+		if err != nil {
+			app.apiError(w, http.StatusBadRequest, fmt.Sprintf("record %d: %s", i, err))
+			return
+		}
+		record, err := dnsservice.NewRecordFromData(name, req.TTL, data, zone)
+		if err != nil {
+			app.apiError(w, http.StatusBadRequest, fmt.Sprintf("record %d: %s", i, err))
+			return
+		}
+		set.Records = append(set.Records, *record)
+	}
+
+	ctx, cancel := dnsContext(r)
+	defer cancel()
+	if err := app.dnsClient(r).ReplaceRecordSet(ctx, set); err != nil {
+		handleAPIDNSError(err, w, app)
+		return
+	}
+	app.writeJSON(w, http.StatusOK, NewRecordSetResponse(set))
+}
+
+// APIDeleteRecordHandler removes the record from its record set. With ?plan=true it returns the
+// plan of removing the record instead.
+func (app *App) APIDeleteRecordHandler(w http.ResponseWriter, r *http.Request) {
+	record := app.dnsClient(r).GetRecordByHash(chi.URLParam(r, "hash"))
+	if record == nil {
+		app.apiError(w, http.StatusNotFound, "No matching record found")
+		return
+	}
+	if planRequested(r) {
+		app.writePlan(w, r, dnsservice.ChangeSet{Remove: []dnsservice.Record{*record}})
+		return
+	}
+	ctx, cancel := dnsContext(r)
+	defer cancel()
+	if err := app.dnsClient(r).RemoveRecord(ctx, *record); err != nil {
+		handleAPIDNSError(err, w, app)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// APIApplyChangeSetHandler applies a batch of record additions and removals atomically.
+func (app *App) APIApplyChangeSetHandler(w http.ResponseWriter, r *http.Request) {
+	changes, ok := app.decodeChangeSet(w, r)
+	if !ok {
+		return
+	}
+
+	ctx, cancel := dnsContext(r)
+	defer cancel()
+	if err := app.dnsClient(r).ApplyChangeSet(ctx, changes); err != nil {
+		handleAPIDNSError(err, w, app)
+		return
+	}
+	app.writeJSON(w, http.StatusOK, NewChangeSetResponse(changes))
+}
+
+// APIPlanChangeSetHandler validates the change set in the request body and returns the plan of
+// applying it, whose token can be applied as long as the zone does not change.
+func (app *App) APIPlanChangeSetHandler(w http.ResponseWriter, r *http.Request) {
+	changes, ok := app.decodeChangeSet(w, r)
+	if !ok {
+		return
+	}
+	app.writePlan(w, r, changes)
+}
+
+// writePlan plans the change set and writes the plan, which is applied by APIApplyPlanHandler.
+func (app *App) writePlan(w http.ResponseWriter, r *http.Request, changes dnsservice.ChangeSet) {
+	ctx, cancel := dnsContext(r)
+	defer cancel()
+	plan, err := app.dnsClient(r).PlanChangeSet(ctx, changes)
+	if err != nil {
+		handleAPIDNSError(err, w, app)
+		return
+	}
+	app.writeJSON(w, http.StatusCreated, NewPlanResponse(plan))
+}
+
+func (app *App) APIApplyPlanHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := dnsContext(r)
+	defer cancel()
+	if err := app.dnsClient(r).ApplyPlan(ctx, chi.URLParam(r, "token")); err != nil {
+		handleAPIDNSError(err, w, app)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// decodeChangeSet reads a ChangeSetRequest from the request body. It writes the error response
+// and returns false if the change set is invalid.
+func (app *App) decodeChangeSet(w http.ResponseWriter, r *http.Request) (dnsservice.ChangeSet, bool) {
+	var changes dnsservice.ChangeSet
+	var req ChangeSetRequest
+	if err := app.decodeJSON(w, r, &req); err != nil {
+		app.apiError(w, http.StatusBadRequest, err.Error())
+		return changes, false
+	}
+	zone := app.dnsClient(r).GetZone()
+
+	for i, recordReq := range req.Remove {
+		// the TTL does not identify a record, but is required to build one
+		if recordReq.TTL == 0 {
+			recordReq.TTL = 1
+		}
+		record, err := recordFromRecordRequest(recordReq, zone)
+		if err != nil {
+			app.apiError(w, http.StatusBadRequest, fmt.Sprintf("remove %d: %s", i, err))
+			return changes, false
+		}
+		changes.Remove = append(changes.Remove, *record)
+	}
+	for i, recordReq := range req.Add {
+		record, err := recordFromRecordRequest(recordReq, zone)
+		if err != nil {
+			app.apiError(w, http.StatusBadRequest, fmt.Sprintf("add %d: %s", i, err))
+			return changes, false
+		}
+		changes.Add = append(changes.Add, *record)
+	}
+	if changes.IsEmpty() {
+		app.apiError(w, http.StatusBadRequest, "The change set is empty")
+		return changes, false
+	}
+	return changes, true
+}
+
+// recordFromRequest decodes a RecordRequest from the request body and builds the
+// corresponding record for the managed zone.
+func (app *App) recordFromRequest(w http.ResponseWriter, r *http.Request) (*dnsservice.Record, error) {
+	var req RecordRequest
+	if err := app.decodeJSON(w, r, &req); err != nil {
+		return nil, err
+	}
+	return recordFromRecordRequest(req, app.dnsClient(r).GetZone())
+}
+
+// recordFromRecordRequest builds the record described by req for the zone.
+func recordFromRecordRequest(req RecordRequest, zone string) (*dnsservice.Record, error) {
+	data, err := decodeRecordData(strings.ToUpper(req.Type), req.Data)
+	if err != nil {
+		return nil, err
+	}
+	return dnsservice.NewRecordFromData(req.Name, req.TTL, data, zone)
+}
+
+// decodeRecordData decodes the type specific fields of a record of the given type.
+func decodeRecordData(recordType string, raw json.RawMessage) (dnsservice.RecordData, error) {
+	data, err := dnsservice.NewRecordData(recordType)
+	if err != nil {
+		return nil, err
+	}
+	if len(raw) == 0 {
+		return nil, fmt.Errorf("missing record data")
+	}
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(data); err != nil {
+		return nil, fmt.Errorf("invalid %s record data: %w", data.RecordType(), err)
+	}
+	return data, nil
+}
+
+// matchesName reports whether the fqdn matches the given name, which can either be
+// a fully qualified name or a hostname relative to the zone.
+func matchesName(fqdn, name, zone string) bool {
+	if strings.HasSuffix(name, ".") {
+		return strings.EqualFold(fqdn, name)
+	}
+	if name == "@" {
+		return strings.EqualFold(fqdn, zone)
+	}
+	return strings.EqualFold(fqdn, name+"."+zone)
+}
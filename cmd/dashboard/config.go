@@ -8,12 +8,39 @@ import (
 	"github.com/spf13/viper"
 	"github.com/theadell/dnsify/internal/auth"
 	"github.com/theadell/dnsify/internal/dnsservice"
+	"github.com/theadell/dnsify/internal/externaldns"
+	"github.com/theadell/dnsify/internal/rbac"
 )
 
 type Config struct {
-	DNSClientConfig    dnsservice.DNSConfig    `mapstructure:"dns"`
+	DNSClientConfig    dnsservice.ZonesConfig  `mapstructure:"dns"`
 	HTTPServerConfig   HTTPServerConfig        `mapstructure:"httpServer"`
 	OAuth2ClientConfig auth.OAuth2ClientConfig `mapstructure:"oauth2Client"`
+	RBACConfig         rbac.Config             `mapstructure:"rbac"`
+	ACMEConfig         ACMEConfig              `mapstructure:"acme"`
+	ExternalDNSConfig  externaldns.Config      `mapstructure:"externalDNS"`
+	JournalConfig      JournalConfig           `mapstructure:"journal"`
+}
+
+// JournalConfig configures the journal the changes of all zones are recorded in.
+type JournalConfig struct {
+	// Path is the JSON lines file of the journal, ./journal.jsonl by default.
+	Path string `mapstructure:"path"`
+}
+
+// path returns the configured journal file or the default.
+func (c JournalConfig) path() string {
+	if c.Path == "" {
+		return "./journal.jsonl"
+	}
+	return c.Path
+}
+
+// ACMEConfig configures the ACME DNS-01 challenge endpoints.
+type ACMEConfig struct {
+	// ChallengeTimeout is the time in seconds after which challenge records that were not
+	// cleaned up are removed, 3600 by default.
+	ChallengeTimeout int `mapstructure:"challengeTimeout"`
 }
 
 type HTTPServerConfig struct {
@@ -58,12 +85,17 @@ func bindEnvVars(v *viper.Viper) {
 	v.BindEnv("dns.server.zone", "DNS_SERVER_ZONE")
 	v.BindEnv("dns.server.tsigKey", "DNS_SERVER_TSIGKEY")
 	v.BindEnv("dns.server.tsigSecret", "DNS_SERVER_TSIGSECRET")
+	v.BindEnv("dns.server.tsigAlgorithm", "DNS_SERVER_TSIGALGORITHM")
+	v.BindEnv("dns.server.sig0KeyFile", "DNS_SERVER_SIG0KEYFILE")
 	v.BindEnv("dns.client.syncInterval", "DNS_CLIENT_SYNCINTERVAL")
 	v.BindEnv("dns.client.healthCheckInterval", "DNS_CLIENT_HEALTHCHECKINTERVAL")
 	v.BindEnv("dns.client.ipv4", "DNS_CLIENT_IPV4")
 	v.BindEnv("dns.client.ipv6", "DNS_CLIENT_IPV6")
 	v.BindEnv("dns.client.guards.immutable", "DNS_CLIENT_GUARDS_IMMUTABLE")
 	v.BindEnv("dns.client.guards.admin_only", "DNS_CLIENT_GUARDS_ADMIN_ONLY")
+	v.BindEnv("dns.notify.listen", "DNS_NOTIFY_LISTEN")
+	v.BindEnv("dns.notify.allowedPrimaries", "DNS_NOTIFY_ALLOWEDPRIMARIES")
+	v.BindEnv("dns.notify.requireTsig", "DNS_NOTIFY_REQUIRETSIG")
 
 	v.BindEnv("httpServer.host", "HTTPSERVER_HOST")
 	v.BindEnv("httpServer.port", "HTTPSERVER_PORT")
@@ -80,4 +112,14 @@ func bindEnvVars(v *viper.Viper) {
 	v.BindEnv("oauth2Client.domain", "OAUTH2CLIENT_DOMAIN")
 	v.BindEnv("oauth2Client.authorizedDomains", "OAUTH2CLIENT_AUTHORIZEDDOMAINS")
 	v.BindEnv("oauth2Client.loginText", "OAUTH2CLIENT_LOGINTEXT")
+	v.BindEnv("oauth2Client.groupsClaim", "OAUTH2CLIENT_GROUPSCLAIM")
+
+	v.BindEnv("rbac.defaultRole", "RBAC_DEFAULTROLE")
+
+	v.BindEnv("acme.challengeTimeout", "ACME_CHALLENGETIMEOUT")
+
+	v.BindEnv("externalDNS.listen", "EXTERNALDNS_LISTEN")
+	v.BindEnv("externalDNS.role", "EXTERNALDNS_ROLE")
+
+	v.BindEnv("journal.path", "JOURNAL_PATH")
 }
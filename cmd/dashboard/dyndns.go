@@ -0,0 +1,125 @@
+package main
+
+import (
+	"errors"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+
+	"github.com/miekg/dns"
+	"github.com/theadell/dnsify/internal/dnsservice"
+)
+
+// Return codes of the dyndns2 protocol.
+const (
+	dynDNSGood    = "good"
+	dynDNSNoChg   = "nochg"
+	dynDNSBadAuth = "badauth"
+	dynDNSNotFQDN = "notfqdn"
+	dynDNSNoHost  = "nohost"
+	dynDNSNumHost = "numhost"
+	// dynDNSBadAgent answers malformed requests, like a myip that is not an address.
+	dynDNSBadAgent = "badagent"
+	dynDNSDNSErr   = "dnserr"
+)
+
+// dynDNSMaxHosts is the number of hostnames a single update may list.
+const dynDNSMaxHosts = 20
+
+// dynDNSUnauthorized answers update requests without valid credentials.
+func dynDNSUnauthorized(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("WWW-Authenticate", `Basic realm="DNSify"`)
+	writeDynDNS(w, http.StatusUnauthorized, dynDNSBadAuth)
+}
+
+// DynDNSUpdateHandler implements the update request of the dyndns2 protocol, spoken by routers and
+// NAS devices: /nic/update?hostname=home.example.com&myip=198.51.100.7. Hostnames are a comma
+// separated list and myip may list an IPv4 and an IPv6 address, it defaults to the address of the
+// caller. Every hostname gets a line with its return code.
+func (app *App) DynDNSUpdateHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	hostnames := strings.Split(query.Get("hostname"), ",")
+	if len(hostnames) > dynDNSMaxHosts {
+		writeDynDNS(w, http.StatusOK, dynDNSNumHost)
+		return
+	}
+	addrs, err := dynDNSAddresses(r)
+	if err != nil {
+		slog.Info("Rejected dyndns update with an invalid address", "error", err.Error())
+		writeDynDNS(w, http.StatusOK, dynDNSBadAgent)
+		return
+	}
+	ips := make([]string, 0, len(addrs))
+	for _, addr := range addrs {
+		ips = append(ips, addr.String())
+	}
+
+	ctx, cancel := dnsContext(r)
+	defer cancel()
+	results := make([]string, 0, len(hostnames))
+	for _, hostname := range hostnames {
+		hostname = strings.TrimSpace(hostname)
+		if _, ok := dns.IsDomainName(hostname); !ok || dns.CountLabel(hostname) < 2 {
+			results = append(results, dynDNSNotFQDN)
+			continue
+		}
+		name := strings.ToLower(dns.Fqdn(hostname))
+		client, err := app.zones.Lookup(name)
+		if err != nil {
+			results = append(results, dynDNSNoHost)
+			continue
+		}
+		changed, err := dnsservice.UpdateAddresses(ctx, client, name, addrs)
+		switch {
+		case errors.Is(err, dnsservice.ErrHostNotFound),
+			errors.Is(err, dnsservice.ErrNotAuthorized),
+			errors.Is(err, dnsservice.ErrImmutableRecord):
+			results = append(results, dynDNSNoHost)
+		case err != nil:
+			slog.Error("Failed to apply dyndns update", "hostname", name, "error", err.Error())
+			results = append(results, dynDNSDNSErr)
+		case changed:
+			results = append(results, dynDNSGood+" "+strings.Join(ips, ","))
+		default:
+			results = append(results, dynDNSNoChg+" "+strings.Join(ips, ","))
+		}
+	}
+	writeDynDNS(w, http.StatusOK, strings.Join(results, "\n"))
+}
+
+// dynDNSAddresses returns the addresses of myip and myipv6, or the address of the caller as set
+// by the RealIP middleware.
+func dynDNSAddresses(r *http.Request) ([]netip.Addr, error) {
+	var values []string
+	for _, param := range []string{"myip", "myipv6"} {
+		for _, value := range strings.Split(r.URL.Query().Get(param), ",") {
+			if value = strings.TrimSpace(value); value != "" {
+				values = append(values, value)
+			}
+		}
+	}
+	if len(values) == 0 {
+		host := r.RemoteAddr
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		values = append(values, host)
+	}
+	addrs := make([]netip.Addr, 0, len(values))
+	for _, value := range values {
+		addr, err := netip.ParseAddr(value)
+		if err != nil {
+			return nil, err
+		}
+		addrs = append(addrs, addr.Unmap().WithZone(""))
+	}
+	return addrs, nil
+}
+
+func writeDynDNS(w http.ResponseWriter, status int, body string) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.WriteHeader(status)
+	w.Write([]byte(body + "\n"))
+}
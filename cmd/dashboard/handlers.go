@@ -1,12 +1,16 @@
 package main
 
 import (
+	"errors"
+	"fmt"
 	"log/slog"
 	"net/http"
 	"slices"
+	"strings"
 	"time"
 
 	"github.com/go-chi/chi/v5"
+	"github.com/theadell/dnsify/internal/apikeymanager"
 	"github.com/theadell/dnsify/internal/auth"
 	"github.com/theadell/dnsify/internal/dnsservice"
 )
@@ -21,13 +25,19 @@ func (app *App) IndexHandler(w http.ResponseWriter, r *http.Request) {
 	app.render(w, http.StatusOK, "index", data)
 }
 func (app *App) DashboardHandler(w http.ResponseWriter, r *http.Request) {
-	records := app.dnsClient.GetRecords()
+	client := app.dnsClient(r)
+	records := client.GetRecords()
 	records = slices.DeleteFunc(records, func(r dnsservice.Record) bool {
 		return r.Data.RecordType() != "A"
 	})
+	basePath := zonePath(client.GetZone())
 	data := DashboardPageData{
-		Zone:    app.dnsClient.GetZone(),
-		Records: records,
+		Zone:        client.GetZone(),
+		Zones:       app.zoneLinks(client.GetZone()),
+		BasePath:    basePath,
+		Records:     NewRecordSetRows(r.Context(), client, records),
+		RecordTypes: dnsservice.RecordTypes(),
+		CanEdit:     canEdit(r.Context()),
 	}
 	app.render(w, http.StatusOK, "dashboard", data)
 }
@@ -44,8 +54,14 @@ func (app *App) CreateAPIKeyHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	scope := apikeymanager.Scope(r.FormValue("scope"))
+	if scope != apikeymanager.ScopeFull && scope != apikeymanager.ScopeACME {
+		app.clientError(w, http.StatusBadRequest, "Unknown API key scope")
+		return
+	}
+
 	user := app.sessionManager.GetString(r.Context(), "email")
-	key, err := app.keyManager.CreateKey(r.Context(), user, label)
+	key, err := app.keyManager.CreateScopedKey(r.Context(), user, label, scope, app.idp.UserGroups(r.Context()))
 	if err != nil {
 		app.serverError(w, err)
 		return
@@ -71,13 +87,15 @@ func (app *App) configHandler(w http.ResponseWriter, r *http.Request) {
 		app.clientError(w, http.StatusBadRequest, "Invalid or empty record id/hash was submitted")
 		return
 	}
-	record := app.dnsClient.GetRecordByHash(hash)
+	record := app.dnsClient(r).GetRecordByHash(hash)
 	if record == nil {
 		app.clientError(w, http.StatusBadRequest, "No matching record found")
 		return
 	}
-	aaaaRecord := app.dnsClient.GetRecordForFQDN(record.Name, "AAAA")
+	client := app.dnsClient(r)
+	aaaaRecord := client.GetRecordForFQDN(record.Name, "AAAA")
 	c := NewNginxConfig(*record, aaaaRecord, "http://localhost:8080")
+	c.BasePath = zonePath(client.GetZone())
 	app.render(w, http.StatusOK, "nginx-config", c)
 }
 func (app *App) configAdjusterHandler(w http.ResponseWriter, r *http.Request) {
@@ -92,7 +110,7 @@ func (app *App) configAdjusterHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	record := app.dnsClient.GetRecordByHash(hash)
+	record := app.dnsClient(r).GetRecordByHash(hash)
 	if record == nil {
 		app.clientError(w, http.StatusBadRequest, "No matching record found")
 		return
@@ -102,55 +120,182 @@ func (app *App) configAdjusterHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 func (app *App) GetRecordsHandler(w http.ResponseWriter, r *http.Request) {
-	recordType := r.URL.Query().Get("type")
-	if !slices.Contains(dnsservice.SupportedTypes, recordType) {
+	recordType := strings.ToUpper(r.URL.Query().Get("type"))
+	if !dnsservice.IsSupportedType(recordType) {
 		app.clientError(w, http.StatusBadRequest, "Unsupported record type")
 		return
 	}
-	records := app.dnsClient.GetRecords()
-	records = slices.DeleteFunc(records, func(r dnsservice.Record) bool {
-		return r.Data.RecordType() != recordType
+	app.renderRecordSetRows(w, r, app.dnsClient(r), recordType)
+}
+
+// renderRecordSetRows renders the rows of all record sets of the given type.
+func (app *App) renderRecordSetRows(w http.ResponseWriter, r *http.Request, client dnsservice.Service, recordType string) {
+	records := slices.DeleteFunc(client.GetRecords(), func(record dnsservice.Record) bool {
+		return record.Data.RecordType() != recordType
 	})
-	app.renderTemplateFragment(w, http.StatusOK, "dashboard", "record-rows", records)
+	app.renderTemplateFragment(w, http.StatusOK, "dashboard", "record-rows", NewRecordSetRows(r.Context(), client, records))
 }
 
+// AddRecordHandler adds the record of the form to its record set. With ?plan=true it renders the
+// plan of adding it instead.
 func (app *App) AddRecordHandler(w http.ResponseWriter, r *http.Request) {
 	if err := r.ParseForm(); err != nil {
 		app.clientError(w, http.StatusBadRequest)
 		return
 	}
+	client := app.dnsClient(r)
 	hostname, value, ttl, recordType := r.FormValue("hostname"), r.FormValue("value"), r.FormValue("ttl"), r.FormValue("type")
-	record, err := dnsservice.NewRecordFromRaw(recordType, hostname, value, ttl, app.dnsClient.GetZone())
+	record, err := dnsservice.NewRecordFromRaw(recordType, hostname, value, ttl, client.GetZone())
 	if err != nil {
 		app.clientError(w, http.StatusBadRequest, err.Error())
 		return
 	}
-	err = app.dnsClient.AddRecord(*record)
+	if planRequested(r) {
+		app.renderPlan(w, r, client, dnsservice.ChangeSet{Add: []dnsservice.Record{*record}})
+		return
+	}
+	ctx, cancel := dnsContext(r)
+	defer cancel()
+	err = client.AddRecord(ctx, *record)
 	if err != nil {
 		handleDNSError(err, w, app)
 		return
 	}
-	app.renderTemplateFragment(w, http.StatusOK, "dashboard", "record-row", &record)
+	// the record may have joined an existing record set, so all sets of its type are rendered
+	app.renderRecordSetRows(w, r, client, record.Data.RecordType())
+}
+
+// ApplyChangeSetHandler applies the rows of the change set form in one transaction and renders
+// the record sets of the type shown in the table.
+func (app *App) ApplyChangeSetHandler(w http.ResponseWriter, r *http.Request) {
+	client := app.dnsClient(r)
+	changes, err := changeSetFromForm(r, client.GetZone())
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	ctx, cancel := dnsContext(r)
+	defer cancel()
+	if err := client.ApplyChangeSet(ctx, changes); err != nil {
+		handleDNSError(err, w, app)
+		return
+	}
+	app.renderRecordSetRows(w, r, client, strings.ToUpper(r.FormValue("type")))
+}
+
+// PlanChangeSetHandler renders the plan of the change set form without applying it.
+func (app *App) PlanChangeSetHandler(w http.ResponseWriter, r *http.Request) {
+	client := app.dnsClient(r)
+	changes, err := changeSetFromForm(r, client.GetZone())
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	app.renderPlan(w, r, client, changes)
+}
+
+// planRequested reports whether a single record change should be planned rather than applied.
+func planRequested(r *http.Request) bool {
+	return r.URL.Query().Get("plan") == "true"
+}
+
+// renderPlan plans the change set and renders the plan, which is applied by ApplyPlanHandler.
+func (app *App) renderPlan(w http.ResponseWriter, r *http.Request, client dnsservice.Service, changes dnsservice.ChangeSet) {
+	ctx, cancel := dnsContext(r)
+	defer cancel()
+	plan, err := client.PlanChangeSet(ctx, changes)
+	if err != nil {
+		handleDNSError(err, w, app)
+		return
+	}
+	app.renderTemplateFragment(w, http.StatusOK, "dashboard", "change-plan", PlanView{
+		Plan:     plan,
+		BasePath: zonePath(client.GetZone()),
+	})
+}
+
+// ApplyPlanHandler applies a plan made by PlanChangeSetHandler and renders the record sets of
+// the active type.
+func (app *App) ApplyPlanHandler(w http.ResponseWriter, r *http.Request) {
+	client := app.dnsClient(r)
+	ctx, cancel := dnsContext(r)
+	defer cancel()
+	if err := client.ApplyPlan(ctx, chi.URLParam(r, "token")); err != nil {
+		handleDNSError(err, w, app)
+		return
+	}
+	app.renderRecordSetRows(w, r, client, strings.ToUpper(r.FormValue("type")))
+}
+
+// changeSetFromForm reads the rows of the change set form.
+func changeSetFromForm(r *http.Request, zone string) (dnsservice.ChangeSet, error) {
+	var changes dnsservice.ChangeSet
+	if err := r.ParseForm(); err != nil {
+		return changes, errors.New(http.StatusText(http.StatusBadRequest))
+	}
+	actions, types, hostnames, values, ttls := r.Form["change_action"], r.Form["change_type"], r.Form["change_hostname"], r.Form["change_value"], r.Form["change_ttl"]
+	if len(actions) == 0 || len(types) != len(actions) || len(hostnames) != len(actions) || len(values) != len(actions) || len(ttls) != len(actions) {
+		return changes, errors.New("Incomplete change set")
+	}
+
+	for i, action := range actions {
+		ttl := ttls[i]
+		if action == "remove" && ttl == "" {
+			// the TTL does not identify a record, but is required to build one
+			ttl = "1"
+		}
+		record, err := dnsservice.NewRecordFromRaw(strings.ToUpper(types[i]), hostnames[i], values[i], ttl, zone)
+		if err != nil {
+			return changes, fmt.Errorf("Row %d: %s", i+1, err)
+		}
+		switch action {
+		case "add":
+			changes.Add = append(changes.Add, *record)
+		case "remove":
+			changes.Remove = append(changes.Remove, *record)
+		default:
+			return changes, fmt.Errorf("Row %d: unknown action %q", i+1, action)
+		}
+	}
+	return changes, nil
 }
 
 func (app *App) notFoundHandler(w http.ResponseWriter, r *http.Request) {
 	app.render(w, http.StatusNotFound, "error", nil)
 }
 
+// DeleteRecordHandler removes a single record from its record set and renders the row of
+// the remaining set, which is empty if the set no longer exists. With ?plan=true it renders the
+// plan of removing the record instead.
 func (app *App) DeleteRecordHandler(w http.ResponseWriter, r *http.Request) {
-	hostname, value, ttl, recordType := r.FormValue("hostname"), r.FormValue("value"), r.FormValue("ttl"), r.FormValue("type")
-	record, err := dnsservice.NewRecordFromRaw(recordType, hostname, value, ttl, app.dnsClient.GetZone())
-	if err != nil {
-		app.clientError(w, http.StatusBadRequest, err.Error())
+	client := app.dnsClient(r)
+	record := client.GetRecordByHash(chi.URLParam(r, "hash"))
+	if record == nil {
+		app.clientError(w, http.StatusNotFound, "No matching record found")
+		return
+	}
+	if planRequested(r) {
+		app.renderPlan(w, r, client, dnsservice.ChangeSet{Remove: []dnsservice.Record{*record}})
 		return
 	}
-	err = app.dnsClient.RemoveRecord(*record)
+	ctx, cancel := dnsContext(r)
+	defer cancel()
+	err := client.RemoveRecord(ctx, *record)
 	if err != nil {
 		slog.Error("Failed to delete record")
 		handleDNSError(err, w, app)
 		return
 	}
-	w.WriteHeader(http.StatusOK)
+	remaining := slices.DeleteFunc(client.GetRecords(), func(r dnsservice.Record) bool {
+		return r.Name != record.Name || r.Data.RecordType() != record.Data.RecordType()
+	})
+	if len(remaining) == 0 {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	app.renderTemplateFragment(w, http.StatusOK, "dashboard", "record-rows", NewRecordSetRows(r.Context(), client, remaining))
 }
 
 func (app *App) StatusSSEHandler(w http.ResponseWriter, r *http.Request) {
@@ -172,13 +317,9 @@ func (app *App) StatusSSEHandler(w http.ResponseWriter, r *http.Request) {
 		slog.Error("couldn't find the `infobar` template")
 		return
 	}
-	sendUpdate := func() {
-		b, err := ConstructSSEMessage(ts, app.dnsClient.HealthCheck(), "message", id)
-		if err != nil {
-			slog.Error("Failed to execute infobar template", "error", err)
-			return
-		}
-		_, err = w.Write(b)
+	client := app.dnsClient(r)
+	send := func(b []byte) {
+		_, err := w.Write(b)
 		if err != nil {
 			slog.Error("Failed to write bytes to SSE connection", "error", err)
 			return
@@ -193,10 +334,22 @@ func (app *App) StatusSSEHandler(w http.ResponseWriter, r *http.Request) {
 
 		id++ // increment the message id
 	}
+	sendUpdate := func() {
+		b, err := ConstructSSEMessage(ts, client.HealthCheck(), "message", id)
+		if err != nil {
+			slog.Error("Failed to execute infobar template", "error", err)
+			return
+		}
+		send(b)
+	}
 
 	// Immediately send the current status when a client connects.
 	sendUpdate()
 
+	// Notify the client whenever a synchronization changed the records, e.g. after a NOTIFY.
+	changes, unsubscribe := client.Subscribe()
+	defer unsubscribe()
+
 	// Periodically send status updates at regular intervals.
 	ticker := time.NewTicker(time.Minute)
 	defer ticker.Stop()
@@ -205,6 +358,9 @@ func (app *App) StatusSSEHandler(w http.ResponseWriter, r *http.Request) {
 		select {
 		case <-ticker.C:
 			sendUpdate()
+		case <-changes:
+			send(ConstructSSEEvent(recordsChangedEvent, "", id))
+			sendUpdate()
 		case <-r.Context().Done():
 			return
 		}
@@ -1,16 +1,32 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"log/slog"
 	"net/http"
 	"runtime/debug"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/theadell/dnsify/internal/dnsservice"
+	"github.com/theadell/dnsify/internal/journal"
 )
 
+const maxJSONBodySize = 1 << 20
+
+// dnsRequestTimeout bounds the DNS exchanges of a single HTTP request.
+const dnsRequestTimeout = 15 * time.Second
+
+// dnsContext returns the context for the DNS exchanges of the request, which is canceled when
+// the client goes away or after dnsRequestTimeout.
+func dnsContext(r *http.Request) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(r.Context(), dnsRequestTimeout)
+}
+
 func stringToUint(s string) (uint, error) {
 	// First, convert the string to uint64
 	u64, err := strconv.ParseUint(s, 10, 64)
@@ -45,10 +61,12 @@ func (app *App) clientError(w http.ResponseWriter, status int, messages ...strin
 }
 
 func (app *App) createNginxConfigFromForm(r *http.Request, record *dnsservice.Record) *NginxConfig {
-	aaaaRecord := app.dnsClient.GetRecordForFQDN(record.Name, "AAAA")
+	client := app.dnsClient(r)
+	aaaaRecord := client.GetRecordForFQDN(record.Name, "AAAA")
 	listenAddress := r.FormValue("listen_address")
 
 	c := NewNginxConfig(*record, aaaaRecord, listenAddress)
+	c.BasePath = zonePath(client.GetZone())
 	c.UseGooglePublicDNS = app.parseFormBool(r, "google_public_dns")
 	c.UseCloudflareResolver = app.parseFormBool(r, "cloudflare_resolver")
 	c.EnableHSTS = app.parseFormBool(r, "strict_transport")
@@ -66,12 +84,92 @@ func (app *App) parseFormBool(r *http.Request, key string) bool {
 }
 
 func handleDNSError(err error, w http.ResponseWriter, app *App) {
-	switch err {
-	case dnsservice.ErrImmutableRecord:
+	switch {
+	case errors.Is(err, dnsservice.ErrImmutableRecord):
 		app.clientError(w, http.StatusBadRequest, "This record is read only")
-	case dnsservice.ErrNotAuthorized:
-		app.clientError(w, http.StatusUnauthorized, "You do not have the required permissions to perform this action.")
+	case errors.Is(err, dnsservice.ErrNotAuthorized):
+		app.clientError(w, http.StatusForbidden, "You do not have the required permissions to perform this action.")
+	case errors.Is(err, dnsservice.ErrPlanStale):
+		app.clientError(w, http.StatusConflict, "The zone was changed on the DNS server since the preview. Preview the changes again.")
+	case errors.Is(err, dnsservice.ErrPlanNotFound):
+		app.clientError(w, http.StatusNotFound, "The preview expired or was already applied.")
+	case errors.Is(err, journal.ErrEntryNotFound):
+		app.clientError(w, http.StatusNotFound, "No matching change found")
+	case errors.Is(err, dnsservice.ErrJournalDisabled):
+		app.clientError(w, http.StatusNotFound, "The change history is not available")
+	case errors.Is(err, dnsservice.ErrJournalIncomplete):
+		app.clientError(w, http.StatusConflict, "The change was not fully recorded and can't be rolled back.")
+	case errors.Is(err, dnsservice.ErrRecordConflict):
+		app.clientError(w, http.StatusConflict, "The record was changed on the DNS server in the meantime. Reload and try again.")
+	case errors.Is(err, dnsservice.ErrInvalidChangeSet):
+		app.clientError(w, http.StatusUnprocessableEntity, err.Error())
+	case errors.Is(err, context.DeadlineExceeded):
+		app.clientError(w, http.StatusGatewayTimeout, "The DNS server did not respond in time.")
+	case errors.Is(err, context.Canceled):
+		slog.Info("DNS request canceled by the client", "error", err.Error())
 	default:
 		app.serverError(w, err)
 	}
 }
+
+func (app *App) writeJSON(w http.ResponseWriter, status int, data any) {
+	b, err := json.Marshal(data)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(b)
+}
+
+func (app *App) apiError(w http.ResponseWriter, status int, message string) {
+	app.writeJSON(w, status, APIError{Error: message})
+}
+
+func (app *App) apiServerError(w http.ResponseWriter, err error) {
+	slog.Error("api server error encountered", "error", err.Error())
+	app.apiError(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+}
+
+func (app *App) decodeJSON(w http.ResponseWriter, r *http.Request, dst any) error {
+	r.Body = http.MaxBytesReader(w, r.Body, maxJSONBodySize)
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(dst); err != nil {
+		return fmt.Errorf("invalid request body: %w", err)
+	}
+	if dec.More() {
+		return errors.New("invalid request body: must contain a single JSON object")
+	}
+	return nil
+}
+
+func handleAPIDNSError(err error, w http.ResponseWriter, app *App) {
+	switch {
+	case errors.Is(err, dnsservice.ErrImmutableRecord):
+		app.apiError(w, http.StatusForbidden, "This record is read only")
+	case errors.Is(err, dnsservice.ErrNotAuthorized):
+		app.apiError(w, http.StatusForbidden, "You do not have the required permissions to perform this action.")
+	case errors.Is(err, dnsservice.ErrPlanStale):
+		app.apiError(w, http.StatusConflict, err.Error())
+	case errors.Is(err, dnsservice.ErrPlanNotFound):
+		app.apiError(w, http.StatusNotFound, "The plan expired or was already applied")
+	case errors.Is(err, journal.ErrEntryNotFound):
+		app.apiError(w, http.StatusNotFound, "No matching change found")
+	case errors.Is(err, dnsservice.ErrJournalDisabled):
+		app.apiError(w, http.StatusNotFound, "The change history is not available")
+	case errors.Is(err, dnsservice.ErrJournalIncomplete):
+		app.apiError(w, http.StatusConflict, err.Error())
+	case errors.Is(err, dnsservice.ErrRecordConflict):
+		app.apiError(w, http.StatusConflict, err.Error())
+	case errors.Is(err, dnsservice.ErrInvalidChangeSet):
+		app.apiError(w, http.StatusUnprocessableEntity, err.Error())
+	case errors.Is(err, context.DeadlineExceeded):
+		app.apiError(w, http.StatusGatewayTimeout, "The DNS server did not respond in time")
+	case errors.Is(err, context.Canceled):
+		slog.Info("DNS request canceled by the client", "error", err.Error())
+	default:
+		app.apiServerError(w, err)
+	}
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/miekg/dns"
+	"github.com/theadell/dnsify/internal/auth"
+	"github.com/theadell/dnsify/internal/journal"
+	"github.com/theadell/dnsify/internal/rbac"
+)
+
+// historyLimit is the number of journal entries the history page and the API return by default.
+const historyLimit = 100
+
+// HistoryPageData is rendered by the history page of a zone, optionally filtered by name.
+type HistoryPageData struct {
+	Zone     string
+	BasePath string
+	Name     string
+	Entries  []journal.Entry
+	CanEdit  bool
+}
+
+// withActor attributes the changes made by a request to the logged in user or, for API requests,
+// to the API key the request was authenticated with.
+func (app *App) withActor(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		actor := journal.Actor{SourceIP: r.RemoteAddr}
+		if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+			actor.SourceIP = host
+		}
+		if key, ok := auth.APIKeyFromContext(r.Context()); ok {
+			actor.Name = fmt.Sprintf("%s (API key %s)", key.UserID, key.Label)
+		} else {
+			actor.Name = app.sessionManager.GetString(r.Context(), "email")
+		}
+		next.ServeHTTP(w, r.WithContext(journal.WithActor(r.Context(), actor)))
+	})
+}
+
+// withRole resolves the role of the logged in user from their email address and groups or, for API
+// requests, the role of the user the API key belongs to with the groups recorded on the key.
+func (app *App) withRole(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var role rbac.Role
+		if key, ok := auth.APIKeyFromContext(r.Context()); ok {
+			role = app.policy.KeyRole(key.UserID, key.Groups)
+		} else {
+			role = app.policy.RoleOf(app.sessionManager.GetString(r.Context(), "email"), app.idp.UserGroups(r.Context()))
+		}
+		next.ServeHTTP(w, r.WithContext(rbac.WithRole(r.Context(), role)))
+	})
+}
+
+// historyName returns the name the history is filtered by, given relative to the zone or as
+// fully qualified name, or "" for the whole zone.
+func historyName(r *http.Request, zone string) string {
+	name := strings.TrimSpace(r.FormValue("name"))
+	switch {
+	case name == "":
+		return ""
+	case name == "@":
+		return zone
+	case strings.HasSuffix(name, "."):
+		return name
+	case dns.IsSubDomain(zone, dns.Fqdn(name)):
+		return dns.Fqdn(name)
+	default:
+		return name + "." + zone
+	}
+}
+
+func (app *App) historyPageData(r *http.Request) (HistoryPageData, error) {
+	client := app.dnsClient(r)
+	name := historyName(r, client.GetZone())
+	entries, err := client.History(r.Context(), name, historyLimit)
+	return HistoryPageData{
+		Zone:     client.GetZone(),
+		BasePath: zonePath(client.GetZone()),
+		Name:     name,
+		Entries:  entries,
+		CanEdit:  canEdit(r.Context()),
+	}, err
+}
+
+func (app *App) HistoryHandler(w http.ResponseWriter, r *http.Request) {
+	data, err := app.historyPageData(r)
+	if err != nil {
+		handleDNSError(err, w, app)
+		return
+	}
+	app.render(w, http.StatusOK, "history", data)
+}
+
+// RollbackHandler reverts a journal entry and renders the updated history.
+func (app *App) RollbackHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := dnsContext(r)
+	defer cancel()
+	if err := app.dnsClient(r).Rollback(ctx, chi.URLParam(r, "id")); err != nil {
+		handleDNSError(err, w, app)
+		return
+	}
+	data, err := app.historyPageData(r)
+	if err != nil {
+		handleDNSError(err, w, app)
+		return
+	}
+	app.renderTemplateFragment(w, http.StatusOK, "history", "history-entries", data)
+}
+
+func (app *App) APIHistoryHandler(w http.ResponseWriter, r *http.Request) {
+	limit := historyLimit
+	if s := r.URL.Query().Get("limit"); s != "" {
+		var err error
+		if limit, err = strconv.Atoi(s); err != nil || limit <= 0 {
+			app.apiError(w, http.StatusBadRequest, "limit must be a positive number")
+			return
+		}
+	}
+	client := app.dnsClient(r)
+	entries, err := client.History(r.Context(), historyName(r, client.GetZone()), limit)
+	if err != nil {
+		handleAPIDNSError(err, w, app)
+		return
+	}
+	if entries == nil {
+		entries = []journal.Entry{}
+	}
+	app.writeJSON(w, http.StatusOK, entries)
+}
+
+func (app *App) APIRollbackHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := dnsContext(r)
+	defer cancel()
+	if err := app.dnsClient(r).Rollback(ctx, chi.URLParam(r, "id")); err != nil {
+		handleAPIDNSError(err, w, app)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
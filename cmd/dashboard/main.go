@@ -9,11 +9,16 @@ import (
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 
 	"github.com/alexedwards/scs/v2"
+	"github.com/theadell/dnsify/internal/acme"
 	"github.com/theadell/dnsify/internal/apikeymanager"
 	"github.com/theadell/dnsify/internal/auth"
 	"github.com/theadell/dnsify/internal/dnsservice"
+	"github.com/theadell/dnsify/internal/externaldns"
+	"github.com/theadell/dnsify/internal/journal"
+	"github.com/theadell/dnsify/internal/rbac"
 	"github.com/theadell/dnsify/ui"
 )
 
@@ -22,8 +27,12 @@ type App struct {
 	sessionManager *scs.SessionManager
 	idp            *auth.Idp
 	keyManager     apikeymanager.APIKeyManager
+	policy         *rbac.Policy
 	templateCache  map[string]*template.Template
-	dnsClient      dnsservice.Service
+	zones          *dnsservice.Registry
+	notifyListener *dnsservice.NotifyListener
+	challenges     *acme.Challenges
+	externalDNS    *http.Server
 	server         *http.Server
 }
 
@@ -42,20 +51,43 @@ func main() {
 
 	oauth2Client := SetupIdp(cfg, sessionManager, useMockOAuth)
 
-	bindClient, err := setupDNSClient(cfg, useMockDNS)
+	zones, err := setupDNSRegistry(cfg, useMockDNS)
 	if err != nil {
-		log.Fatalf("Error setting up DNS client: %v", err)
+		log.Fatalf("Error setting up DNS clients: %v", err)
+	}
+	notifyListener, err := setupNotifyListener(cfg, zones)
+	if err != nil {
+		log.Fatalf("Error setting up NOTIFY listener: %v", err)
 	}
 	apikeymanager, err := apikeymanager.NewFileAPIKeyManager("./keys.json")
 	if err != nil {
 		log.Fatalf("Error setting up api keys manager: %v", err)
 	}
+	changeJournal, err := journal.NewFileJournal(cfg.JournalConfig.path())
+	if err != nil {
+		log.Fatalf("Error setting up change journal: %v", err)
+	}
+	zones.SetJournal(changeJournal)
+	policy, err := rbac.NewPolicy(cfg.RBACConfig)
+	if err != nil {
+		log.Fatalf("Error setting up roles: %v", err)
+	}
+	externalDNS, err := setupExternalDNS(cfg, zones)
+	if err != nil {
+		log.Fatalf("Error setting up ExternalDNS webhook: %v", err)
+	}
+	challenges := acme.NewChallenges(zones, time.Duration(cfg.ACMEConfig.ChallengeTimeout)*time.Second)
+	challenges.Start()
 	app := &App{
 		config:         cfg.HTTPServerConfig,
 		sessionManager: sessionManager,
 		idp:            oauth2Client,
 		keyManager:     apikeymanager,
-		dnsClient:      bindClient,
+		policy:         policy,
+		zones:          zones,
+		notifyListener: notifyListener,
+		challenges:     challenges,
+		externalDNS:    externalDNS,
 		templateCache:  loadTemplates(ui.TemplatesFS),
 	}
 
@@ -75,12 +107,56 @@ func SetupIdp(cfg *Config, sessionManager *scs.SessionManager, useMockOAuth bool
 	return auth.NewIdp(&cfg.OAuth2ClientConfig, sessionManager)
 }
 
-func setupDNSClient(cfg *Config, useMockDNS bool) (dnsservice.Service, error) {
-
+func setupDNSRegistry(cfg *Config, useMockDNS bool) (*dnsservice.Registry, error) {
+	zoneConfigs := cfg.DNSClientConfig.All()
 	if useMockDNS {
-		return dnsservice.NewMockClientWithTestRecords(), nil
+		if len(zoneConfigs) == 0 {
+			return dnsservice.NewRegistry(dnsservice.NewMockClientWithTestRecords())
+		}
+		mocks := make([]dnsservice.Service, 0, len(zoneConfigs))
+		for _, zc := range zoneConfigs {
+			mocks = append(mocks, dnsservice.NewMockClientForZone(zc.Zone))
+		}
+		return dnsservice.NewRegistry(mocks...)
+	}
+	return dnsservice.NewRegistryFromConfig(zoneConfigs)
+}
+
+// setupNotifyListener starts the DNS NOTIFY listener if one is configured.
+func setupNotifyListener(cfg *Config, zones *dnsservice.Registry) (*dnsservice.NotifyListener, error) {
+	if cfg.DNSClientConfig.Notify.Listen == "" {
+		return nil, nil
+	}
+	listener, err := dnsservice.NewNotifyListener(cfg.DNSClientConfig.Notify, zones)
+	if err != nil {
+		return nil, err
+	}
+	listener.Start()
+	return listener, nil
+}
+
+// setupExternalDNS starts the ExternalDNS webhook provider if it is configured.
+func setupExternalDNS(cfg *Config, zones *dnsservice.Registry) (*http.Server, error) {
+	if cfg.ExternalDNSConfig.Listen == "" {
+		return nil, nil
 	}
-	return dnsservice.NewClient(cfg.DNSClientConfig)
+	provider, err := externaldns.NewProvider(cfg.ExternalDNSConfig, zones)
+	if err != nil {
+		return nil, err
+	}
+	server := &http.Server{
+		Addr:         cfg.ExternalDNSConfig.Listen,
+		Handler:      provider,
+		ReadTimeout:  5 * time.Second,
+		WriteTimeout: time.Minute,
+	}
+	go func() {
+		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			slog.Error("ExternalDNS webhook stopped", "error", err.Error())
+		}
+	}()
+	slog.Info("Serving the ExternalDNS webhook", "addr", server.Addr)
+	return server, nil
 }
 
 func handleSignals(app *App) {
@@ -1,13 +1,16 @@
 package main
 
 import (
+	"encoding/json"
 	"strings"
+	"time"
 
 	"github.com/theadell/dnsify/internal/dnsservice"
 )
 
 type NginxConfig struct {
 	Hash                  string
+	BasePath              string
 	Domain                string
 	SSLCert               string
 	SSLKey                string
@@ -47,3 +50,151 @@ type HTMXDeleteDuplicateRowEvent struct {
 		Hash string `json:"hash"`
 	} `json:"deleteDuplicateRow"`
 }
+
+// RecordRequest is the JSON body accepted by the record endpoints of the API.
+// Data holds the type specific fields, e.g. {"ip": "192.0.2.1"} for an A record
+// or {"priority": 10, "mailServer": "mail.example.com."} for an MX record.
+type RecordRequest struct {
+	Type string          `json:"type"`
+	Name string          `json:"name"`
+	TTL  uint            `json:"ttl"`
+	Data json.RawMessage `json:"data"`
+}
+
+// RecordResponse is the JSON representation of a dnsservice.Record returned by the API.
+type RecordResponse struct {
+	Hash  string                `json:"hash"`
+	Type  string                `json:"type"`
+	Name  string                `json:"name"`
+	TTL   uint                  `json:"ttl"`
+	Value string                `json:"value"`
+	Data  dnsservice.RecordData `json:"data"`
+}
+
+func NewRecordResponse(record dnsservice.Record) RecordResponse {
+	return RecordResponse{
+		Hash:  record.Hash,
+		Type:  record.Data.RecordType(),
+		Name:  record.Name,
+		TTL:   record.TTL,
+		Value: record.Data.Value(),
+		Data:  record.Data,
+	}
+}
+
+// RecordSetRequest is the JSON body accepted by the record set endpoint of the API. Each entry
+// of Records holds the type specific fields of one record of the set.
+type RecordSetRequest struct {
+	Type    string            `json:"type"`
+	Name    string            `json:"name"`
+	TTL     uint              `json:"ttl"`
+	Records []json.RawMessage `json:"records"`
+}
+
+// RecordSetResponse is the JSON representation of a dnsservice.RecordSet returned by the API.
+type RecordSetResponse struct {
+	Type    string           `json:"type"`
+	Name    string           `json:"name"`
+	TTL     uint             `json:"ttl"`
+	Records []RecordResponse `json:"records"`
+}
+
+func NewRecordSetResponse(set dnsservice.RecordSet) RecordSetResponse {
+	records := make([]RecordResponse, 0, len(set.Records))
+	for _, record := range set.Records {
+		records = append(records, NewRecordResponse(record))
+	}
+	return RecordSetResponse{Type: set.Type, Name: set.Name, TTL: set.TTL, Records: records}
+}
+
+// ChangeSetRequest is the JSON body accepted by the change set endpoint of the API. The TTL of
+// records to remove is ignored.
+type ChangeSetRequest struct {
+	Add    []RecordRequest `json:"add"`
+	Remove []RecordRequest `json:"remove"`
+}
+
+// ChangeSetResponse is the JSON representation of an applied dnsservice.ChangeSet.
+type ChangeSetResponse struct {
+	Add    []RecordResponse `json:"add"`
+	Remove []RecordResponse `json:"remove"`
+}
+
+func NewChangeSetResponse(changes dnsservice.ChangeSet) ChangeSetResponse {
+	response := ChangeSetResponse{
+		Add:    make([]RecordResponse, 0, len(changes.Add)),
+		Remove: make([]RecordResponse, 0, len(changes.Remove)),
+	}
+	for _, record := range changes.Add {
+		response.Add = append(response.Add, NewRecordResponse(record))
+	}
+	for _, record := range changes.Remove {
+		response.Remove = append(response.Remove, NewRecordResponse(record))
+	}
+	return response
+}
+
+// PlanResponse is the JSON representation of a dnsservice.Plan. Diff is a human readable
+// summary, Operations lists the prerequisites and updates of the UPDATE message.
+type PlanResponse struct {
+	ChangeSetResponse
+	Token      string    `json:"token"`
+	Zone       string    `json:"zone"`
+	Serial     uint32    `json:"serial"`
+	Operations []string  `json:"operations"`
+	Diff       string    `json:"diff"`
+	ExpiresAt  time.Time `json:"expiresAt"`
+}
+
+func NewPlanResponse(plan dnsservice.Plan) PlanResponse {
+	response := PlanResponse{
+		ChangeSetResponse: NewChangeSetResponse(plan.ChangeSet),
+		Token:             plan.Token,
+		Zone:              plan.Zone,
+		Serial:            plan.Serial,
+		Operations:        plan.Operations,
+		Diff:              plan.String(),
+		ExpiresAt:         plan.ExpiresAt,
+	}
+	if response.Operations == nil {
+		response.Operations = []string{}
+	}
+	return response
+}
+
+// PlanView is rendered by the change-plan fragment of the dashboard.
+type PlanView struct {
+	dnsservice.Plan
+	BasePath string
+}
+
+// ZoneDiffResponse is the JSON representation of the changes of a zone file import. A preview
+// has the token of the plan that applies the changes.
+type ZoneDiffResponse struct {
+	ChangeSetResponse
+	Skipped     []RecordResponse `json:"skipped"`
+	Unsupported []string         `json:"unsupported"`
+	Applied     bool             `json:"applied"`
+	Token       string           `json:"token,omitempty"`
+	ExpiresAt   *time.Time       `json:"expiresAt,omitempty"`
+}
+
+func NewZoneDiffResponse(diff dnsservice.ZoneDiff, unsupported []string, applied bool) ZoneDiffResponse {
+	response := ZoneDiffResponse{
+		ChangeSetResponse: NewChangeSetResponse(diff.ChangeSet),
+		Skipped:           make([]RecordResponse, 0, len(diff.Skipped)),
+		Unsupported:       unsupported,
+		Applied:           applied,
+	}
+	for _, record := range diff.Skipped {
+		response.Skipped = append(response.Skipped, NewRecordResponse(record))
+	}
+	if response.Unsupported == nil {
+		response.Unsupported = []string{}
+	}
+	return response
+}
+
+type APIError struct {
+	Error string `json:"error"`
+}
@@ -5,6 +5,7 @@ import (
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
+	"github.com/theadell/dnsify/internal/apikeymanager"
 	"github.com/theadell/dnsify/internal/auth"
 	"github.com/theadell/dnsify/ui"
 )
@@ -33,23 +34,40 @@ func (app *App) Routes() http.Handler {
 	// protected routes
 	htmlRouter.Group(func(r chi.Router) {
 		r.Use(app.idp.RequireAuthentication)
+		r.Use(app.withActor)
+		r.Use(app.withRole)
 
 		r.Post("/logout", app.idp.LogoutHandler)
 
-		r.HandleFunc("/status", app.StatusSSEHandler)
 		r.Route("/dashboard", func(r chi.Router) {
 			r.Get("/", app.DashboardHandler)
 			r.Get("/apikeys", app.SettingsHandler)
 			r.Post("/apikeys", app.CreateAPIKeyHandler)
 			r.Delete("/apikeys/{label}", app.DeleteAPIKeyHandler)
+		})
+
+		// zone scoped routes
+		r.Route("/zones/{zone}", func(r chi.Router) {
+			r.Use(app.ZoneCtx(app.notFoundHandler))
+			r.Get("/", app.DashboardHandler)
+			r.HandleFunc("/status", app.StatusSSEHandler)
 			r.Post("/config/nginx", app.configHandler)
 			r.Put("/config/nginx", app.configAdjusterHandler)
-		})
+			r.Post("/changes", app.ApplyChangeSetHandler)
+			r.Post("/changes/plan", app.PlanChangeSetHandler)
+			r.Post("/plans/{token}/apply", app.ApplyPlanHandler)
+			r.Get("/zonefile", app.ZoneFilePageHandler)
+			r.Get("/zonefile/download", app.ExportZoneFileHandler)
+			r.Post("/zonefile/preview", app.PreviewZoneFileHandler)
+			r.Post("/zonefile/apply", app.ApplyZoneFileHandler)
+			r.Get("/history", app.HistoryHandler)
+			r.Post("/history/{id}/rollback", app.RollbackHandler)
 
-		r.Route("/records", func(r chi.Router) {
-			r.Get("/", app.GetRecordsHandler)
-			r.Post("/", app.AddRecordHandler)
-			r.Delete("/", app.DeleteRecordHandler)
+			r.Route("/records", func(r chi.Router) {
+				r.Get("/", app.GetRecordsHandler)
+				r.Post("/", app.AddRecordHandler)
+				r.Delete("/{hash}", app.DeleteRecordHandler)
+			})
 		})
 	})
 
@@ -58,13 +76,73 @@ func (app *App) Routes() http.Handler {
 	// JSON Api
 	apiRouter := chi.NewRouter()
 	apiRouter.Use(auth.APIKeyValidatorMiddleware(app.keyManager))
-	testHandler := func(w http.ResponseWriter, r *http.Request) {
-		w.WriteHeader(http.StatusOK)
+	apiRouter.Use(auth.RequireAPIKeyScope(app.apiKeyScopeDenied, apikeymanager.ScopeFull))
+	apiRouter.Use(app.withActor)
+	apiRouter.Use(app.withRole)
+	apiRecordRoutes := func(r chi.Router) {
+		r.Get("/", app.APIListRecordsHandler)
+		r.Post("/", app.APICreateRecordHandler)
+		r.Put("/", app.APIUpsertRecordHandler)
+		r.Get("/{hash}", app.APIGetRecordHandler)
+		r.Delete("/{hash}", app.APIDeleteRecordHandler)
 	}
-	apiRouter.Get("/", testHandler)
+	apiRouter.Route("/v1", func(r chi.Router) {
+		// records of the default zone
+		r.Route("/records", apiRecordRoutes)
+		r.Get("/rrsets", app.APIListRecordSetsHandler)
+		r.Put("/rrsets", app.APIReplaceRecordSetHandler)
+		r.Post("/changes", app.APIApplyChangeSetHandler)
+		r.Post("/plans", app.APIPlanChangeSetHandler)
+		r.Post("/plans/{token}/apply", app.APIApplyPlanHandler)
+		r.Get("/zonefile", app.ExportZoneFileHandler)
+		r.Post("/zonefile", app.APIImportZoneFileHandler)
+		r.Get("/history", app.APIHistoryHandler)
+		r.Post("/history/{id}/rollback", app.APIRollbackHandler)
+
+		r.Get("/zones", app.APIListZonesHandler)
+		r.Route("/zones/{zone}", func(r chi.Router) {
+			r.Use(app.ZoneCtx(app.apiZoneNotFound))
+			r.Route("/records", apiRecordRoutes)
+			r.Get("/rrsets", app.APIListRecordSetsHandler)
+			r.Put("/rrsets", app.APIReplaceRecordSetHandler)
+			r.Post("/changes", app.APIApplyChangeSetHandler)
+			r.Post("/plans", app.APIPlanChangeSetHandler)
+			r.Post("/plans/{token}/apply", app.APIApplyPlanHandler)
+			r.Get("/zonefile", app.ExportZoneFileHandler)
+			r.Post("/zonefile", app.APIImportZoneFileHandler)
+			r.Get("/history", app.APIHistoryHandler)
+			r.Post("/history/{id}/rollback", app.APIRollbackHandler)
+		})
+	})
+
+	// DynDNS2 updates of routers and NAS devices
+	dynDNSRouter := chi.NewRouter()
+	dynDNSRouter.Use(auth.APIKeyBasicAuthMiddleware(app.keyManager, dynDNSUnauthorized))
+	dynDNSRouter.Use(auth.RequireAPIKeyScope(dynDNSUnauthorized, apikeymanager.ScopeFull))
+	dynDNSRouter.Use(app.withActor)
+	dynDNSRouter.Use(app.withRole)
+	dynDNSRouter.Get("/update", app.DynDNSUpdateHandler)
+
+	// ACME DNS-01 challenges of lego's httpreq provider and acme-dns clients
+	acmeRouter := chi.NewRouter()
+	acmeRouter.Group(func(r chi.Router) {
+		r.Use(auth.APIKeyBasicAuthMiddleware(app.keyManager, app.acmeUnauthorized))
+		r.Use(app.withActor)
+		r.Use(app.withRole)
+		r.Post("/present", app.HTTPReqPresentHandler)
+		r.Post("/cleanup", app.HTTPReqCleanupHandler)
+	})
+	acmeRouter.Group(func(r chi.Router) {
+		r.Use(auth.APIKeyHeaderAuthMiddleware(app.keyManager, "X-Api-User", "X-Api-Key", app.acmeUnauthorized))
+		r.Use(app.withActor)
+		r.Use(app.withRole)
+		r.Post("/update", app.ACMEDNSUpdateHandler)
+	})
 
 	router.Mount("/", htmlRouter)
 	router.Mount("/api", apiRouter)
+	router.Mount("/nic", dynDNSRouter)
+	router.Mount("/acme", acmeRouter)
 
 	return router
 }
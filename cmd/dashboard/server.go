@@ -29,6 +29,21 @@ func (app *App) GracefulShutdown() {
 		log.Fatalf("Server Shutdown Failed:%+v", err)
 	}
 
-	// Close the DNS client
-	app.dnsClient.Close()
+	// Stop accepting NOTIFY messages
+	if app.notifyListener != nil {
+		app.notifyListener.Close()
+	}
+
+	// Stop serving the ExternalDNS webhook
+	if app.externalDNS != nil {
+		if err := app.externalDNS.Shutdown(ctx); err != nil {
+			log.Printf("ExternalDNS webhook shutdown failed: %v", err)
+		}
+	}
+
+	// Stop removing expired ACME challenges
+	app.challenges.Close()
+
+	// Close the DNS clients of all zones
+	app.zones.Close()
 }
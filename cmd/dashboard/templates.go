@@ -2,6 +2,7 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"embed"
 	"fmt"
 	"html/template"
@@ -12,6 +13,8 @@ import (
 
 	"github.com/theadell/dnsify/internal/auth"
 	"github.com/theadell/dnsify/internal/dnsservice"
+	"github.com/theadell/dnsify/internal/externaldns"
+	"github.com/theadell/dnsify/internal/rbac"
 )
 
 func loadTemplates(tmplFS embed.FS) map[string]*template.Template {
@@ -136,19 +139,88 @@ func ConstructSSEMessage(tmpl *template.Template, data any, eventName string, co
 		return nil, fmt.Errorf("Failed to execute template: %v", err)
 	}
 
-	lines := strings.Split(buf.String(), "\n")
+	return ConstructSSEEvent(eventName, buf.String(), counter), nil
+}
+
+// recordsChangedEvent is sent to dashboards when the records of their zone changed on the server.
+const recordsChangedEvent = "records-changed"
+
+func ConstructSSEEvent(eventName string, data string, counter int) []byte {
+	lines := strings.Split(data, "\n")
 	message := fmt.Sprintf("id: %d\nevent: %s\n", counter, eventName)
 	for _, line := range lines {
 		message += fmt.Sprintf("data: %s\n", line)
 	}
 	message += "\n"
 
-	return []byte(message), nil
+	return []byte(message)
 }
 
 type DashboardPageData struct {
-	Zone    string
-	Records []dnsservice.Record
+	Zone        string
+	Zones       []ZoneLink
+	BasePath    string
+	Records     []RecordSetRow
+	RecordTypes []dnsservice.RecordType
+	// CanEdit is false for viewers, who are not shown the forms that change records.
+	CanEdit bool
+}
+
+// ZoneLink is an entry of the zone switcher on the dashboard.
+type ZoneLink struct {
+	Zone   string
+	Path   string
+	Active bool
+}
+
+// RecordSetRow is a record set rendered as a row of the records table, listing each of its
+// records. BasePath is the zone scoped path the row actions are sent to. The actions are only shown
+// if the set is Editable by the user. Owner is the ExternalDNS owner ID of a record set managed by a
+// cluster.
+type RecordSetRow struct {
+	dnsservice.RecordSet
+	BasePath string
+	Editable bool
+	Owner    string
+}
+
+// Description returns the phrase the values of the records are introduced with, e.g. "resolves to".
+func (row RecordSetRow) Description() string {
+	t, _ := dnsservice.LookupRecordType(row.Type)
+	return t.Description
+}
+
+// NewRecordSetRows groups the records of the client's zone into record sets and returns a row for
+// each set.
+func NewRecordSetRows(ctx context.Context, client dnsservice.Service, records []dnsservice.Record) []RecordSetRow {
+	sets := dnsservice.GroupRecordSets(records)
+	basePath := zonePath(client.GetZone())
+	owners := externaldns.Owners(client.GetRecords())
+	rows := make([]RecordSetRow, 0, len(sets))
+	for _, set := range sets {
+		rows = append(rows, RecordSetRow{
+			RecordSet: set,
+			BasePath:  basePath,
+			Editable:  client.Authorize(ctx, set.Name, set.Type) == nil,
+			Owner:     owners.Owner(set.Name, set.Type),
+		})
+	}
+	return rows
+}
+
+// canEdit reports whether the role of the request may change records at all.
+func canEdit(ctx context.Context) bool {
+	role, ok := rbac.RoleFromContext(ctx)
+	return !ok || role.CanEdit()
+}
+
+func (app *App) zoneLinks(active string) []ZoneLink {
+	zones := app.zones.Zones()
+	links := make([]ZoneLink, 0, len(zones))
+	for _, zone := range zones {
+		links = append(links, ZoneLink{Zone: zone, Path: zonePath(zone), Active: strings.EqualFold(zone, active)})
+	}
+	return links
 }
 
 type LoginTemplateData struct {
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/theadell/dnsify/internal/dnsservice"
+)
+
+// maxZoneFileSize limits the size of uploaded zone files.
+const maxZoneFileSize = 4 << 20
+
+// ZoneFilePageData is rendered by the zone file import and export page.
+type ZoneFilePageData struct {
+	Zone     string
+	BasePath string
+	CanEdit  bool
+}
+
+// ZoneDiffView is the preview of a zone file import. Token is the plan of the previewed changes,
+// which is applied to import the zone file. It is empty if there is nothing to apply or the user
+// can't edit the zone.
+type ZoneDiffView struct {
+	dnsservice.ZoneDiff
+	BasePath    string
+	Token       string
+	Unsupported []string
+}
+
+// zoneFileName returns the file name zone files of the zone are downloaded as.
+func zoneFileName(zone string) string {
+	return strings.TrimSuffix(zone, ".") + ".zone"
+}
+
+// readZoneFile parses a zone file of the zone the request is scoped to.
+func (app *App) readZoneFile(r *http.Request, content io.Reader) ([]dnsservice.Record, []string, error) {
+	records, unsupported, err := dnsservice.ParseZoneFile(content, app.dnsClient(r).GetZone())
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid zone file: %w", err)
+	}
+	return records, unsupported, nil
+}
+
+// ExportZoneFileHandler downloads the cached zone as a master file.
+func (app *App) ExportZoneFileHandler(w http.ResponseWriter, r *http.Request) {
+	client := app.dnsClient(r)
+	var buf strings.Builder
+	if err := client.ExportZone(&buf); err != nil {
+		app.serverError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "text/dns; charset=utf-8")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", zoneFileName(client.GetZone())))
+	io.WriteString(w, buf.String())
+}
+
+func (app *App) ZoneFilePageHandler(w http.ResponseWriter, r *http.Request) {
+	zone := app.dnsClient(r).GetZone()
+	app.render(w, http.StatusOK, "zonefile", ZoneFilePageData{Zone: zone, BasePath: zonePath(zone), CanEdit: canEdit(r.Context())})
+}
+
+// PreviewZoneFileHandler renders the changes an uploaded zone file would make to the zone.
+func (app *App) PreviewZoneFileHandler(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxZoneFileSize)
+	file, _, err := r.FormFile("zonefile")
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest, "Select a zone file to import")
+		return
+	}
+	defer file.Close()
+	content, err := io.ReadAll(file)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	records, unsupported, err := app.readZoneFile(r, strings.NewReader(string(content)))
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	client := app.dnsClient(r)
+	view := ZoneDiffView{
+		ZoneDiff:    client.DiffZone(records),
+		BasePath:    zonePath(client.GetZone()),
+		Unsupported: unsupported,
+	}
+	if !view.IsEmpty() && canEdit(r.Context()) {
+		ctx, cancel := dnsContext(r)
+		defer cancel()
+		plan, err := client.PlanChangeSet(ctx, view.ChangeSet)
+		if err != nil {
+			handleDNSError(err, w, app)
+			return
+		}
+		view.Token = plan.Token
+	}
+	app.renderTemplateFragment(w, http.StatusOK, "zonefile", "zone-diff", view)
+}
+
+// ApplyZoneFileHandler applies the plan of a previewed zone file, so exactly the previewed
+// changes are made. It fails with a conflict if the zone changed since the preview.
+func (app *App) ApplyZoneFileHandler(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+	ctx, cancel := dnsContext(r)
+	defer cancel()
+	if err := app.dnsClient(r).ApplyPlan(ctx, r.FormValue("token")); err != nil {
+		handleDNSError(err, w, app)
+		return
+	}
+	app.renderTemplateFragment(w, http.StatusOK, "zonefile", "zone-import-applied", nil)
+}
+
+// APIImportZoneFileHandler imports the master file in the request body. With ?preview=true the
+// changes are only planned and returned with the token of the plan, which applies exactly them.
+func (app *App) APIImportZoneFileHandler(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxZoneFileSize)
+	records, unsupported, err := app.readZoneFile(r, r.Body)
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			app.apiError(w, http.StatusRequestEntityTooLarge, "The zone file is too large")
+			return
+		}
+		app.apiError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	client := app.dnsClient(r)
+	diff := client.DiffZone(records)
+	preview := r.URL.Query().Get("preview") == "true"
+	response := NewZoneDiffResponse(diff, unsupported, !preview)
+	if !diff.IsEmpty() {
+		ctx, cancel := dnsContext(r)
+		defer cancel()
+		if preview {
+			plan, err := client.PlanChangeSet(ctx, diff.ChangeSet)
+			if err != nil {
+				handleAPIDNSError(err, w, app)
+				return
+			}
+			response.Token, response.ExpiresAt = plan.Token, &plan.ExpiresAt
+		} else if err := client.ApplyChangeSet(ctx, diff.ChangeSet); err != nil {
+			handleAPIDNSError(err, w, app)
+			return
+		}
+	}
+	app.writeJSON(w, http.StatusOK, response)
+}
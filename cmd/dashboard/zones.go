@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/theadell/dnsify/internal/dnsservice"
+)
+
+type contextKey string
+
+const zoneContextKey contextKey = "zone"
+
+// ZoneCtx resolves the {zone} URL parameter against the zone registry and stores the
+// matching service in the request context. Requests without a zone parameter are served
+// by the default zone. Unknown zones are answered with notFound.
+func (app *App) ZoneCtx(notFound http.HandlerFunc) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			zone := chi.URLParam(r, "zone")
+			if zone == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+			service, err := app.zones.Get(zone)
+			if err != nil {
+				notFound(w, r)
+				return
+			}
+			ctx := context.WithValue(r.Context(), zoneContextKey, service)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// dnsClient returns the DNS service of the zone the request is scoped to.
+func (app *App) dnsClient(r *http.Request) dnsservice.Service {
+	if service, ok := r.Context().Value(zoneContextKey).(dnsservice.Service); ok {
+		return service
+	}
+	return app.zones.Default()
+}
+
+// zonePath returns the base path of the zone scoped HTML routes.
+func zonePath(zone string) string {
+	return "/zones/" + strings.TrimSuffix(zone, ".")
+}
+
+func (app *App) apiZoneNotFound(w http.ResponseWriter, r *http.Request) {
+	app.apiError(w, http.StatusNotFound, "Zone not found")
+}
+
+func (app *App) APIListZonesHandler(w http.ResponseWriter, r *http.Request) {
+	app.writeJSON(w, http.StatusOK, app.zones.Zones())
+}
@@ -0,0 +1,229 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/spf13/viper"
+	"github.com/theadell/dnsify/internal/dnsservice"
+)
+
+// exitDrift is the exit code of apply -check if the zone differs from the desired state.
+const exitDrift = 3
+
+// desiredState is the document read by apply, e.g.
+//
+//	zone: example.com.
+//	ttl: 3600
+//	records:
+//	  - name: www
+//	    type: A
+//	    ttl: 300
+//	    values: [192.0.2.1, 192.0.2.2]
+//	  - name: "@"
+//	    type: MX
+//	    value: "10:mail.example.com."
+//
+// Values use the formats of the dashboard form, e.g. "priority:mailserver" for MX records.
+type desiredState struct {
+	Zone string `mapstructure:"zone"`
+	// TTL is the default TTL of record sets that do not specify one.
+	TTL     uint32             `mapstructure:"ttl"`
+	Records []desiredRecordSet `mapstructure:"records"`
+}
+
+type desiredRecordSet struct {
+	Name   string   `mapstructure:"name"`
+	Type   string   `mapstructure:"type"`
+	TTL    uint32   `mapstructure:"ttl"`
+	Value  string   `mapstructure:"value"`
+	Values []string `mapstructure:"values"`
+}
+
+func runApply(args []string) int {
+	flags := flag.NewFlagSet("apply", flag.ContinueOnError)
+	file := flags.String("f", "", "desired state document of the zone (YAML)")
+	configFile := flags.String("config", "config.yaml", "DNSify configuration with the DNS server and TSIG keys of the zone")
+	prune := flags.Bool("prune", false, "remove records of record sets the document does not declare")
+	check := flags.Bool("check", false, fmt.Sprintf("only report the differences, exit with %d if there are any", exitDrift))
+	timeout := flags.Duration("timeout", 30*time.Second, "timeout of the zone transfer and the update")
+	verbose := flags.Bool("v", false, "log the communication with the DNS server")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: dnsify apply -f zone.yaml [flags]\n\nReconciles a zone with a desired state document using a single dynamic update.\nRecords of guarded names are neither changed nor removed.\n\nFlags:")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if *file == "" || flags.NArg() != 0 {
+		flags.Usage()
+		return 2
+	}
+	level := slog.LevelWarn
+	if *verbose {
+		level = slog.LevelDebug
+	}
+	slog.SetDefault(slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: level})))
+
+	state, err := loadDesiredState(*file)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "dnsify apply: %v\n", err)
+		return 1
+	}
+	config, err := loadZoneConfig(*configFile, state.Zone)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "dnsify apply: %v\n", err)
+		return 1
+	}
+	desired, err := state.records(dns.Fqdn(config.Zone))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "dnsify apply: %s: %v\n", *file, err)
+		return 1
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+	// the client transfers the zone via AXFR when it is created
+	client, err := dnsservice.NewClientContext(ctx, config)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "dnsify apply: %v\n", err)
+		return 1
+	}
+	defer client.Close()
+
+	code, err := reconcile(ctx, os.Stdout, client, desired, applyOptions{prune: *prune, check: *check, source: *file})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "dnsify apply: %v\n", err)
+	}
+	return code
+}
+
+// applyOptions are the flags of apply that decide what reconcile changes.
+type applyOptions struct {
+	prune bool
+	check bool
+	// source names the desired state document in the output.
+	source string
+}
+
+// reconcile prints the differences between the zone and the desired records and applies them
+// unless only checking. It returns the exit code of apply.
+func reconcile(ctx context.Context, w io.Writer, client dnsservice.Service, desired []dnsservice.Record, opts applyOptions) (int, error) {
+	diff := client.DiffZone(desired)
+	if !opts.prune {
+		diff.ChangeSet = dnsservice.RetainUndeclared(diff.ChangeSet, desired)
+	}
+	printDiff(w, diff)
+	if diff.IsEmpty() {
+		fmt.Fprintf(w, "%s is up to date.\n", client.GetZone())
+		return 0, nil
+	}
+	if opts.check {
+		fmt.Fprintf(w, "%s differs from %s: %d to add, %d to remove.\n", client.GetZone(), opts.source, len(diff.Add), len(diff.Remove))
+		return exitDrift, nil
+	}
+	if err := client.ApplyChangeSet(ctx, diff.ChangeSet); err != nil {
+		return 1, err
+	}
+	fmt.Fprintf(w, "%s updated: %d added, %d removed.\n", client.GetZone(), len(diff.Add), len(diff.Remove))
+	return 0, nil
+}
+
+func loadDesiredState(file string) (desiredState, error) {
+	v := viper.New()
+	v.SetConfigFile(file)
+	v.SetConfigType("yaml")
+	var state desiredState
+	if err := v.ReadInConfig(); err != nil {
+		return state, err
+	}
+	if err := v.Unmarshal(&state); err != nil {
+		return state, fmt.Errorf("%s: %w", file, err)
+	}
+	return state, nil
+}
+
+// records returns the records of the document. Names are relative to the zone, "@" is the apex.
+func (s desiredState) records(zone string) ([]dnsservice.Record, error) {
+	var records []dnsservice.Record
+	for i, set := range s.Records {
+		ttl := set.TTL
+		if ttl == 0 {
+			ttl = s.TTL
+		}
+		if ttl == 0 {
+			ttl = 3600
+		}
+		values := set.Values
+		if set.Value != "" {
+			values = append([]string{set.Value}, values...)
+		}
+		if set.Name == "" || set.Type == "" || len(values) == 0 {
+			return nil, fmt.Errorf("record set %d: name, type and at least one value must be specified", i+1)
+		}
+		for _, value := range values {
+			record, err := dnsservice.NewRecordFromRaw(strings.ToUpper(set.Type), set.Name, value, strconv.FormatUint(uint64(ttl), 10), zone)
+			if err != nil {
+				return nil, fmt.Errorf("%s %s: %w", set.Type, set.Name, err)
+			}
+			records = append(records, *record)
+		}
+	}
+	return records, nil
+}
+
+// loadZoneConfig reads the configuration of the zone from the DNSify configuration. The zone
+// may be omitted if only one zone is configured.
+func loadZoneConfig(file, zone string) (dnsservice.DNSConfig, error) {
+	v := viper.New()
+	v.SetConfigFile(file)
+	v.SetConfigType("yaml")
+	v.SetEnvPrefix("DNSIFY")
+	v.SetEnvKeyReplacer(strings.NewReplacer(".", "_"))
+	v.AutomaticEnv()
+	for _, key := range []string{"addr", "zone", "tsigKey", "tsigSecret", "tsigAlgorithm", "sig0KeyFile"} {
+		v.BindEnv("dns.server."+key, "DNS_SERVER_"+strings.ToUpper(key))
+	}
+	if err := v.ReadInConfig(); err != nil {
+		return dnsservice.DNSConfig{}, err
+	}
+	var config dnsservice.ZonesConfig
+	if err := v.UnmarshalKey("dns", &config); err != nil {
+		return dnsservice.DNSConfig{}, fmt.Errorf("%s: %w", file, err)
+	}
+
+	zones := config.All()
+	if zone == "" {
+		if len(zones) != 1 {
+			return dnsservice.DNSConfig{}, errors.New("the document must specify the zone if several zones are configured")
+		}
+		return zones[0], nil
+	}
+	for _, c := range zones {
+		if strings.EqualFold(dns.Fqdn(c.Zone), dns.Fqdn(zone)) {
+			return c, nil
+		}
+	}
+	return dnsservice.DNSConfig{}, fmt.Errorf("zone %s is not configured in %s", zone, file)
+}
+
+func printDiff(w io.Writer, diff dnsservice.ZoneDiff) {
+	for _, record := range diff.Remove {
+		fmt.Fprintf(w, "- %s IN %s\n", record.Name, record.Data)
+	}
+	for _, record := range diff.Add {
+		fmt.Fprintf(w, "+ %s\n", record)
+	}
+	for _, record := range diff.Skipped {
+		fmt.Fprintf(w, "! %s (guarded, skipped)\n", record)
+	}
+}
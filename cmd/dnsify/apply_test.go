@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/theadell/dnsify/internal/dnsservice"
+)
+
+func TestDesiredStateRecords(t *testing.T) {
+	state := desiredState{
+		TTL: 600,
+		Records: []desiredRecordSet{
+			{Name: "www", Type: "a", TTL: 300, Values: []string{"192.0.2.1", "192.0.2.2"}},
+			{Name: "@", Type: "MX", Value: "10:mail.example.com."},
+		},
+	}
+	records, err := state.records("example.com.")
+	if err != nil {
+		t.Fatalf("records() error = %v", err)
+	}
+	var got []string
+	for _, record := range records {
+		got = append(got, record.String())
+	}
+	want := []string{
+		"www.example.com. 300 IN A 192.0.2.1",
+		"www.example.com. 300 IN A 192.0.2.2",
+		"example.com. 600 IN MX 10 mail.example.com.",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("records() = %q, want %q", got, want)
+	}
+
+	// record sets without a TTL fall back to the default of the document, then to an hour
+	records, err = desiredState{Records: []desiredRecordSet{{Name: "www", Type: "A", Value: "192.0.2.1"}}}.records("example.com.")
+	if err != nil || len(records) != 1 || records[0].TTL != 3600 {
+		t.Errorf("records() = %v, %v; want a record with a TTL of 3600", records, err)
+	}
+
+	for _, invalid := range []desiredRecordSet{
+		{Type: "A", Value: "192.0.2.1"},
+		{Name: "www", Value: "192.0.2.1"},
+		{Name: "www", Type: "A"},
+		{Name: "www", Type: "A", Value: "not an address"},
+		{Name: "www", Type: "NAPTR", Value: "x"},
+	} {
+		if _, err := (desiredState{Records: []desiredRecordSet{invalid}}).records("example.com."); err == nil {
+			t.Errorf("records(%+v) succeeded, want an error", invalid)
+		}
+	}
+}
+
+func mustRecords(t *testing.T, sets ...desiredRecordSet) []dnsservice.Record {
+	t.Helper()
+	records, err := desiredState{Records: sets}.records("example.com.")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return records
+}
+
+// hasRecord reports whether the zone has a record of the name, type and value.
+func hasRecord(client dnsservice.Service, name, recordType, value string) bool {
+	for _, record := range client.GetRecords() {
+		if record.Name == name && record.Data.RecordType() == recordType && record.Data.Value() == value {
+			return true
+		}
+	}
+	return false
+}
+
+func TestReconcile(t *testing.T) {
+	ctx := context.Background()
+	// the mock zone has A and AAAA record sets for foo and bar with a TTL of 100
+	desired := mustRecords(t,
+		desiredRecordSet{Name: "foo", Type: "A", TTL: 100, Value: "192.168.1.1"},
+		desiredRecordSet{Name: "foo", Type: "AAAA", TTL: 100, Value: "::1"},
+		desiredRecordSet{Name: "www", Type: "A", TTL: 300, Value: "192.0.2.1"},
+	)
+
+	t.Run("check", func(t *testing.T) {
+		client := dnsservice.NewMockClientForZone("example.com.")
+		var out strings.Builder
+		code, err := reconcile(ctx, &out, client, desired, applyOptions{check: true, source: "zone.yaml"})
+		if err != nil || code != exitDrift {
+			t.Fatalf("reconcile() = %d, %v; want %d", code, err, exitDrift)
+		}
+		if !strings.Contains(out.String(), "+ www.example.com. 300 IN A 192.0.2.1") || !strings.Contains(out.String(), "1 to add, 0 to remove") {
+			t.Errorf("unexpected output %q", out.String())
+		}
+		if hasRecord(client, "www.example.com.", "A", "192.0.2.1") {
+			t.Error("check must not change the zone")
+		}
+	})
+
+	t.Run("apply keeps undeclared record sets", func(t *testing.T) {
+		client := dnsservice.NewMockClientForZone("example.com.")
+		var out strings.Builder
+		if code, err := reconcile(ctx, &out, client, desired, applyOptions{}); err != nil || code != 0 {
+			t.Fatalf("reconcile() = %d, %v; want 0", code, err)
+		}
+		if !hasRecord(client, "www.example.com.", "A", "192.0.2.1") || !hasRecord(client, "bar.example.com.", "A", "192.168.1.1") {
+			t.Errorf("expected www to be added and bar to be kept, got %v", client.GetRecords())
+		}
+		if code, err := reconcile(ctx, &out, client, desired, applyOptions{check: true}); err != nil || code != 0 {
+			t.Errorf("reconcile() = %d, %v; want an up to date zone", code, err)
+		}
+	})
+
+	t.Run("prune", func(t *testing.T) {
+		client := dnsservice.NewMockClientForZone("example.com.")
+		var out strings.Builder
+		if code, err := reconcile(ctx, &out, client, desired, applyOptions{prune: true}); err != nil || code != 0 {
+			t.Fatalf("reconcile() = %d, %v; want 0", code, err)
+		}
+		if hasRecord(client, "bar.example.com.", "A", "192.168.1.1") || !hasRecord(client, "foo.example.com.", "AAAA", "::1") {
+			t.Errorf("expected bar to be removed and foo to be kept, got %v", client.GetRecords())
+		}
+		if !strings.Contains(out.String(), "- bar.example.com. IN A 192.168.1.1") {
+			t.Errorf("expected the removal in the output, got %q", out.String())
+		}
+	})
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/miekg/dns"
+	"github.com/theadell/dnsify/internal/dnsservice"
+)
+
+func runGuards(args []string) int {
+	flags := flag.NewFlagSet("guards", flag.ContinueOnError)
+	configFile := flags.String("config", "config.yaml", "DNSify configuration with the guards of the zone")
+	zone := flags.String("zone", "", "zone of the record, may be omitted if only one zone is configured")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: dnsify guards test [flags] <type> <name>\n\nExplains which guards of the zone match a record set. The name is relative to the\nzone unless it ends with a dot, @ is the apex.\n\nFlags:")
+		flags.PrintDefaults()
+	}
+	if len(args) == 0 || args[0] != "test" {
+		flags.Usage()
+		return 2
+	}
+	if err := flags.Parse(args[1:]); err != nil {
+		return 2
+	}
+	if flags.NArg() != 2 {
+		flags.Usage()
+		return 2
+	}
+	recordType := strings.ToUpper(flags.Arg(0))
+	if _, ok := dnsservice.LookupRecordType(recordType); !ok {
+		fmt.Fprintf(os.Stderr, "dnsify guards: unsupported record type %q\n", flags.Arg(0))
+		return 2
+	}
+
+	config, err := loadZoneConfig(*configFile, *zone)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "dnsify guards: %v\n", err)
+		return 1
+	}
+	zoneName := dns.Fqdn(config.Zone)
+	guards, err := dnsservice.ParseGuards(config.Guards, zoneName)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "dnsify guards: %v\n", err)
+	}
+	fqdn := guardedName(flags.Arg(1), zoneName)
+
+	fmt.Printf("%s %s\n", recordType, fqdn)
+	explainGuards("immutable", guards.Immutable, recordType, fqdn)
+	explainGuards("admin_only", guards.AdminOnly, recordType, fqdn)
+	return 0
+}
+
+// guardedName returns the FQDN of a name relative to the zone.
+func guardedName(name, zone string) string {
+	switch {
+	case name == "@":
+		return zone
+	case strings.HasSuffix(name, "."):
+		return name
+	default:
+		return name + "." + zone
+	}
+}
+
+// explainGuards prints every guard of the list up to the first one matching the record set, and
+// the resulting decision.
+func explainGuards(list string, guards dnsservice.GuardList, recordType, fqdn string) {
+	fmt.Printf("\n%s:\n", list)
+	guard, index, matched := guards.Match(recordType, fqdn)
+	for i, g := range guards {
+		result := "no match"
+		switch {
+		case i == index:
+			result = "match"
+		case matched && i > index:
+			result = "not evaluated"
+		}
+		fmt.Printf("  %2d  %-40s %s\n", i+1, g, result)
+	}
+	switch {
+	case len(guards) == 0:
+		fmt.Printf("  no guards, the record set is not %s\n", list)
+	case !matched:
+		fmt.Printf("  no guard matched, the record set is not %s\n", list)
+	case guard.Allow:
+		fmt.Printf("  allowed by guard %d, the record set is not %s\n", index+1, list)
+	default:
+		fmt.Printf("  denied by guard %d, the record set is %s\n", index+1, list)
+	}
+}
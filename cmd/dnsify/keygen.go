@@ -0,0 +1,44 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/theadell/dnsify/internal/dnsservice"
+)
+
+func runKeygen(args []string) int {
+	flags := flag.NewFlagSet("keygen", flag.ContinueOnError)
+	algorithm := flags.String("algorithm", "ed25519", "key algorithm, one of "+strings.Join(dnsservice.SIG0Algorithms(), ", "))
+	dir := flags.String("dir", ".", "directory to write the key files to")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: dnsify keygen [flags] <key name>\n\nGenerates a SIG(0) key pair in the format of dnssec-keygen and prints the KEY record to publish.\n\nFlags:")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return 2
+	}
+
+	key, err := dnsservice.GenerateSIG0Key(flags.Arg(0), *algorithm)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "dnsify keygen: %v\n", err)
+		return 1
+	}
+	privateFile, err := key.WriteFiles(*dir)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "dnsify keygen: %v\n", err)
+		return 1
+	}
+
+	fmt.Fprintf(os.Stderr, "Wrote %s, set dns.server.sig0KeyFile to its path.\n", privateFile)
+	fmt.Fprintf(os.Stderr, "Publish the KEY record in the zone and grant it an update-policy, e.g.\n")
+	fmt.Fprintf(os.Stderr, "  update-policy { grant %s zonesub A AAAA CNAME TXT; };\n\n", key.Key.Hdr.Name)
+	fmt.Println(key.Key.String())
+	return 0
+}
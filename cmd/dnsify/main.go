@@ -0,0 +1,43 @@
+// Command dnsify is the command line companion of the DNSify dashboard.
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+// command is a subcommand of dnsify. run receives the arguments after the command name and
+// returns the exit code.
+type command struct {
+	name  string
+	usage string
+	run   func(args []string) int
+}
+
+var commands = []command{
+	{name: "keygen", usage: "generate a SIG(0) key pair and print the KEY record to publish", run: runKeygen},
+	{name: "apply", usage: "reconcile a zone with a desired state document", run: runApply},
+	{name: "guards", usage: "explain which guards match a record set (guards test <type> <name>)", run: runGuards},
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+	for _, cmd := range commands {
+		if cmd.name == os.Args[1] {
+			os.Exit(cmd.run(os.Args[2:]))
+		}
+	}
+	fmt.Fprintf(os.Stderr, "dnsify: unknown command %q\n", os.Args[1])
+	usage()
+	os.Exit(2)
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "Usage: dnsify <command> [flags]\n\nCommands:")
+	for _, cmd := range commands {
+		fmt.Fprintf(os.Stderr, "  %-10s %s\n", cmd.name, cmd.usage)
+	}
+}
@@ -0,0 +1,334 @@
+// Package acme publishes the TXT records of ACME DNS-01 challenges (RFC 8555, section 8.4) for
+// certificate clients. Challenge records are tracked from the moment they are presented, or from
+// their journal entry if they were presented before a restart, and removed once they were not
+// cleaned up within a timeout, e.g. because the client crashed.
+package acme
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/theadell/dnsify/internal/dnsservice"
+	"github.com/theadell/dnsify/internal/journal"
+	"github.com/theadell/dnsify/internal/rbac"
+)
+
+// ChallengeLabel is the label DNS-01 challenge records are published under.
+const ChallengeLabel = "_acme-challenge"
+
+// ChallengeTTL is the TTL of challenge records.
+const ChallengeTTL = 60
+
+// DefaultTimeout is the time after which challenge records that were not cleaned up are removed.
+const DefaultTimeout = time.Hour
+
+// actorSuffix marks the journal entries of challenge records presented through Challenges, which
+// tells them apart from TXT records added by other means.
+const actorSuffix = " (ACME)"
+
+// cleanupActor is the actor the removal of expired challenge records is recorded with.
+const cleanupActor = "ACME challenge cleanup"
+
+// maxChallengeRecords is the number of records Update keeps per name, two allow a certificate
+// for a domain and its wildcard to be validated at the same time.
+const maxChallengeRecords = 2
+
+var (
+	// ErrNotChallenge is returned for names that are not DNS-01 challenge names.
+	ErrNotChallenge = errors.New("not an ACME challenge name")
+	// ErrInvalidChallenge is returned for challenge values that are not valid TXT records.
+	ErrInvalidChallenge = errors.New("invalid challenge")
+)
+
+// ChallengeName returns the name the challenge of a domain is published under, e.g.
+// _acme-challenge.www.example.com. for www.example.com and *.www.example.com.
+func ChallengeName(domain string) string {
+	domain = strings.TrimPrefix(dns.Fqdn(strings.ToLower(domain)), "*.")
+	if isChallengeName(domain) {
+		return domain
+	}
+	return ChallengeLabel + "." + domain
+}
+
+// KeyAuthorizationDigest returns the TXT value of a challenge from its key authorization.
+func KeyAuthorizationDigest(keyAuth string) string {
+	digest := sha256.Sum256([]byte(keyAuth))
+	return base64.RawURLEncoding.EncodeToString(digest[:])
+}
+
+func isChallengeName(fqdn string) bool {
+	return strings.HasPrefix(strings.ToLower(fqdn), ChallengeLabel+".")
+}
+
+type challenge struct {
+	zone    dnsservice.Service
+	record  dnsservice.Record
+	created time.Time
+}
+
+// Challenges publishes challenge records in the zones of a registry.
+type Challenges struct {
+	zones   *dnsservice.Registry
+	timeout time.Duration
+	now     func() time.Time
+
+	mutex      sync.Mutex
+	challenges []challenge
+
+	ctx    context.Context // canceled on Close, stops the cleanup
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// NewChallenges returns Challenges for the zones of the registry that removes challenge records
+// after the timeout, DefaultTimeout if it is zero.
+func NewChallenges(zones *dnsservice.Registry, timeout time.Duration) *Challenges {
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	c := &Challenges{zones: zones, timeout: timeout, now: time.Now}
+	c.ctx, c.cancel = context.WithCancel(context.Background())
+	return c
+}
+
+// Start removes expired challenge records periodically until Close is called.
+func (c *Challenges) Start() {
+	interval := min(c.timeout/4, time.Minute)
+	c.wg.Add(1)
+	go func() {
+		defer c.wg.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-c.ctx.Done():
+				return
+			case <-ticker.C:
+				c.removeExpired(c.ctx)
+			}
+		}
+	}()
+}
+
+// Close stops the cleanup. Challenge records that are still published are left in place.
+func (c *Challenges) Close() {
+	c.cancel()
+	c.wg.Wait()
+}
+
+// Present publishes a challenge record. The name must be a challenge name, e.g.
+// _acme-challenge.www.example.com.
+func (c *Challenges) Present(ctx context.Context, fqdn, value string) error {
+	zone, record, err := c.challengeRecord(fqdn, value)
+	if err != nil {
+		return err
+	}
+	if actor := journal.ActorFromContext(ctx); !strings.HasSuffix(actor.Name, actorSuffix) {
+		actor.Name += actorSuffix
+		ctx = journal.WithActor(ctx, actor)
+	}
+	if err := zone.AddRecord(ctx, record); err != nil {
+		return err
+	}
+	c.track(zone, record)
+	return nil
+}
+
+// CleanUp removes a challenge record.
+func (c *Challenges) CleanUp(ctx context.Context, fqdn, value string) error {
+	zone, record, err := c.challengeRecord(fqdn, value)
+	if err != nil {
+		return err
+	}
+	if !slices.ContainsFunc(zone.GetRecords(), func(r dnsservice.Record) bool { return dnsservice.SameRecord(r, record) }) {
+		c.untrack(record)
+		return nil
+	}
+	if err := zone.RemoveRecord(ctx, record); err != nil {
+		return err
+	}
+	c.untrack(record)
+	return nil
+}
+
+// Update publishes a challenge record the way acme-dns does, keeping only the most recent records
+// of the name instead of waiting for a cleanup.
+func (c *Challenges) Update(ctx context.Context, fqdn, value string) error {
+	if err := c.Present(ctx, fqdn, value); err != nil {
+		return err
+	}
+	zone, record, _ := c.challengeRecord(fqdn, value)
+	for _, old := range c.outdated(zone, record.Name) {
+		if err := zone.RemoveRecord(ctx, old); err != nil {
+			return fmt.Errorf("failed to remove the previous challenge record: %w", err)
+		}
+		c.untrack(old)
+	}
+	return nil
+}
+
+// challengeRecord returns the challenge record and the zone it belongs to.
+func (c *Challenges) challengeRecord(fqdn, value string) (dnsservice.Service, dnsservice.Record, error) {
+	fqdn = strings.ToLower(dns.Fqdn(fqdn))
+	if !isChallengeName(fqdn) {
+		return nil, dnsservice.Record{}, fmt.Errorf("%w: %s", ErrNotChallenge, fqdn)
+	}
+	zone, err := c.zones.Lookup(fqdn)
+	if err != nil {
+		return nil, dnsservice.Record{}, err
+	}
+	record, err := dnsservice.NewRecordFromData(fqdn, ChallengeTTL, &dnsservice.TXTRecord{Text: value}, zone.GetZone())
+	if err != nil {
+		return nil, dnsservice.Record{}, fmt.Errorf("%w: %v", ErrInvalidChallenge, err)
+	}
+	return zone, *record, nil
+}
+
+// outdated returns the challenge records of the name beyond the most recent ones, oldest first.
+// Records that are not tracked, e.g. published before a restart, are the oldest.
+func (c *Challenges) outdated(zone dnsservice.Service, fqdn string) []dnsservice.Record {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	type dated struct {
+		record  dnsservice.Record
+		created time.Time
+	}
+	var records []dated
+	for _, record := range zone.GetRecords() {
+		if record.Data.RecordType() != "TXT" || !strings.EqualFold(record.Name, fqdn) {
+			continue
+		}
+		entry := dated{record: record}
+		for _, ch := range c.challenges {
+			if dnsservice.SameRecord(ch.record, record) {
+				entry.created = ch.created
+			}
+		}
+		records = append(records, entry)
+	}
+	if len(records) <= maxChallengeRecords {
+		return nil
+	}
+	slices.SortStableFunc(records, func(a, b dated) int { return a.created.Compare(b.created) })
+	outdated := make([]dnsservice.Record, 0, len(records)-maxChallengeRecords)
+	for _, entry := range records[:len(records)-maxChallengeRecords] {
+		outdated = append(outdated, entry.record)
+	}
+	return outdated
+}
+
+func (c *Challenges) track(zone dnsservice.Service, record dnsservice.Record) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.challenges = slices.DeleteFunc(c.challenges, func(ch challenge) bool { return dnsservice.SameRecord(ch.record, record) })
+	c.challenges = append(c.challenges, challenge{zone: zone, record: record, created: c.now()})
+}
+
+func (c *Challenges) untrack(record dnsservice.Record) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.challenges = slices.DeleteFunc(c.challenges, func(ch challenge) bool { return dnsservice.SameRecord(ch.record, record) })
+}
+
+// isTracked reports whether the challenge record is tracked.
+func (c *Challenges) isTracked(record dnsservice.Record) bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return slices.ContainsFunc(c.challenges, func(ch challenge) bool { return dnsservice.SameRecord(ch.record, record) })
+}
+
+// discover tracks the challenge records of the zones that are not tracked yet, but were presented
+// through Challenges before a restart according to the journal. They are aged from their journal
+// entry. Other TXT records of challenge names, e.g. added by hand or by another ACME client, are
+// left alone.
+func (c *Challenges) discover(ctx context.Context) {
+	for _, zone := range c.zones.Services() {
+		for _, record := range zone.GetRecords() {
+			if record.Data.RecordType() != "TXT" || record.TTL != ChallengeTTL || !isChallengeName(record.Name) || c.isTracked(record) {
+				continue
+			}
+			created, ok := presentedAt(ctx, zone, record)
+			if !ok {
+				continue
+			}
+			c.mutex.Lock()
+			if !slices.ContainsFunc(c.challenges, func(ch challenge) bool { return dnsservice.SameRecord(ch.record, record) }) {
+				c.challenges = append(c.challenges, challenge{zone: zone, record: record, created: created})
+			}
+			c.mutex.Unlock()
+		}
+	}
+}
+
+// presentedAt returns the time of the newest journal entry of the zone in which Challenges added
+// the challenge record.
+func presentedAt(ctx context.Context, zone dnsservice.Service, record dnsservice.Record) (time.Time, bool) {
+	entries, err := zone.History(ctx, record.Name, 0)
+	if err != nil {
+		return time.Time{}, false
+	}
+	for _, entry := range entries {
+		if !strings.HasSuffix(entry.Actor, actorSuffix) {
+			continue
+		}
+		for _, change := range entry.Changes {
+			if change.Type == "TXT" && containsChallenge(change.After, record) && !containsChallenge(change.Before, record) {
+				return entry.Time, true
+			}
+		}
+	}
+	return time.Time{}, false
+}
+
+// containsChallenge reports whether the journal records in presentation format contain the
+// challenge record.
+func containsChallenge(rrs []string, record dnsservice.Record) bool {
+	for _, s := range rrs {
+		rr, err := dns.NewRR(s)
+		if err != nil {
+			continue
+		}
+		if txt, ok := rr.(*dns.TXT); ok && strings.EqualFold(txt.Hdr.Name, record.Name) && strings.Join(txt.Txt, "") == record.Data.Value() {
+			return true
+		}
+	}
+	return false
+}
+
+// removeExpired removes the challenge records that were presented longer than the timeout ago,
+// including those presented before a restart. The removals are made with the editor role, so
+// admin_only guards stay in force.
+func (c *Challenges) removeExpired(ctx context.Context) {
+	c.discover(ctx)
+	c.mutex.Lock()
+	var expired []challenge
+	for _, ch := range c.challenges {
+		if c.now().Sub(ch.created) >= c.timeout {
+			expired = append(expired, ch)
+		}
+	}
+	c.mutex.Unlock()
+
+	ctx = journal.WithActor(ctx, journal.Actor{Name: cleanupActor})
+	ctx = rbac.WithRole(ctx, rbac.RoleEditor)
+	for _, ch := range expired {
+		present := slices.ContainsFunc(ch.zone.GetRecords(), func(r dnsservice.Record) bool { return dnsservice.SameRecord(r, ch.record) })
+		if present {
+			if err := ch.zone.RemoveRecord(ctx, ch.record); err != nil {
+				slog.Error("Failed to remove an expired ACME challenge", "name", ch.record.Name, "error", err.Error())
+				continue
+			}
+			slog.Info("Removed an expired ACME challenge", "name", ch.record.Name)
+		}
+		c.untrack(ch.record)
+	}
+}
@@ -0,0 +1,175 @@
+package acme
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/theadell/dnsify/internal/dnsservice"
+	"github.com/theadell/dnsify/internal/journal"
+)
+
+func newTestChallenges(t *testing.T) (*Challenges, dnsservice.Service, *time.Time) {
+	t.Helper()
+	zone := dnsservice.NewMockClientForZone("example.com.")
+	registry, err := dnsservice.NewRegistry(zone)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	c := NewChallenges(registry, time.Hour)
+	c.now = func() time.Time { return now }
+	return c, zone, &now
+}
+
+func challengeValues(zone dnsservice.Service, fqdn string) []string {
+	var values []string
+	for _, record := range zone.GetRecords() {
+		if record.Name == fqdn && record.Data.RecordType() == "TXT" {
+			values = append(values, record.Data.Value())
+		}
+	}
+	return values
+}
+
+func TestChallengeName(t *testing.T) {
+	tests := map[string]string{
+		"www.example.com":                  "_acme-challenge.www.example.com.",
+		"*.Example.com.":                   "_acme-challenge.example.com.",
+		"_acme-challenge.www.example.com.": "_acme-challenge.www.example.com.",
+	}
+	for domain, want := range tests {
+		if got := ChallengeName(domain); got != want {
+			t.Errorf("ChallengeName(%q) = %s, want %s", domain, got, want)
+		}
+	}
+}
+
+func TestPresentAndCleanUp(t *testing.T) {
+	c, zone, _ := newTestChallenges(t)
+	ctx := context.Background()
+	const fqdn = "_acme-challenge.www.example.com."
+
+	if err := c.Present(ctx, fqdn, "token1"); err != nil {
+		t.Fatalf("Present() error = %v", err)
+	}
+	if err := c.Present(ctx, fqdn, "token2"); err != nil {
+		t.Fatalf("Present() error = %v", err)
+	}
+	if values := challengeValues(zone, fqdn); len(values) != 2 {
+		t.Fatalf("expected both challenges to be published, got %v", values)
+	}
+	if err := c.CleanUp(ctx, fqdn, "token1"); err != nil {
+		t.Fatalf("CleanUp() error = %v", err)
+	}
+	if err := c.CleanUp(ctx, fqdn, "token1"); err != nil {
+		t.Errorf("expected cleaning up twice to succeed, got %v", err)
+	}
+	if values := challengeValues(zone, fqdn); len(values) != 1 || values[0] != "token2" {
+		t.Errorf("expected only token2 to remain, got %v", values)
+	}
+
+	if err := c.Present(ctx, "www.example.com.", "token"); !errors.Is(err, ErrNotChallenge) {
+		t.Errorf("expected other names to be rejected, got %v", err)
+	}
+	if err := c.Present(ctx, "_acme-challenge.example.org.", "token"); !errors.Is(err, dnsservice.ErrZoneNotFound) {
+		t.Errorf("expected names outside the zones to be rejected, got %v", err)
+	}
+}
+
+func TestUpdateKeepsRecentChallenges(t *testing.T) {
+	c, zone, now := newTestChallenges(t)
+	ctx := context.Background()
+	const fqdn = "_acme-challenge.example.com."
+
+	for _, value := range []string{"first", "second", "third"} {
+		*now = now.Add(time.Minute)
+		if err := c.Update(ctx, fqdn, value); err != nil {
+			t.Fatalf("Update(%s) error = %v", value, err)
+		}
+	}
+	values := challengeValues(zone, fqdn)
+	if len(values) != 2 || values[0] == "first" || values[1] == "first" {
+		t.Errorf("expected the two most recent challenges, got %v", values)
+	}
+}
+
+func TestRemoveExpired(t *testing.T) {
+	c, zone, now := newTestChallenges(t)
+	ctx := context.Background()
+	const fqdn = "_acme-challenge.example.com."
+
+	if err := c.Present(ctx, fqdn, "old"); err != nil {
+		t.Fatal(err)
+	}
+	*now = now.Add(30 * time.Minute)
+	if err := c.Present(ctx, fqdn, "new"); err != nil {
+		t.Fatal(err)
+	}
+	*now = now.Add(45 * time.Minute)
+	c.removeExpired(ctx)
+
+	if values := challengeValues(zone, fqdn); len(values) != 1 || values[0] != "new" {
+		t.Errorf("expected only the expired challenge to be removed, got %v", values)
+	}
+}
+
+func TestRemoveExpiredKeepsUnknownRecords(t *testing.T) {
+	c, zone, now := newTestChallenges(t)
+	ctx := context.Background()
+	const fqdn = "_acme-challenge.www.example.com."
+
+	// neither presented nor recorded in a journal, e.g. added by hand or by another ACME client
+	if err := zone.AddRecord(ctx, dnsservice.NewRecord(fqdn, ChallengeTTL, &dnsservice.TXTRecord{Text: "unknown"})); err != nil {
+		t.Fatal(err)
+	}
+	const manual = "_acme-challenge.api.example.com."
+	if err := zone.AddRecord(ctx, dnsservice.NewRecord(manual, 300, &dnsservice.TXTRecord{Text: "manual"})); err != nil {
+		t.Fatal(err)
+	}
+	*now = now.Add(2 * time.Hour)
+	c.removeExpired(ctx)
+	if values := challengeValues(zone, fqdn); len(values) != 1 {
+		t.Errorf("expected the unknown record to be kept, got %v", values)
+	}
+	if values := challengeValues(zone, manual); len(values) != 1 {
+		t.Errorf("expected the record with another TTL to be kept, got %v", values)
+	}
+}
+
+func TestRemoveExpiredAgesFromJournal(t *testing.T) {
+	zone := dnsservice.NewMockClientForZone("example.com.")
+	registry, err := dnsservice.NewRegistry(zone)
+	if err != nil {
+		t.Fatal(err)
+	}
+	j, err := journal.NewFileJournal(filepath.Join(t.TempDir(), "journal.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	registry.SetJournal(j)
+	ctx := journal.WithActor(context.Background(), journal.Actor{Name: "certbot"})
+	const presented = "_acme-challenge.example.com."
+	const manual = "_acme-challenge.www.example.com."
+
+	// presented before a restart
+	if err := NewChallenges(registry, time.Hour).Present(ctx, presented, "leftover"); err != nil {
+		t.Fatal(err)
+	}
+	// journaled, but not added through the ACME endpoints
+	if err := zone.AddRecord(ctx, dnsservice.NewRecord(manual, ChallengeTTL, &dnsservice.TXTRecord{Text: "manual"})); err != nil {
+		t.Fatal(err)
+	}
+
+	c := NewChallenges(registry, time.Hour)
+	c.now = func() time.Time { return time.Now().Add(time.Hour) }
+	c.removeExpired(ctx)
+	if values := challengeValues(zone, presented); len(values) != 0 {
+		t.Errorf("expected the challenge to be aged from its journal entry, got %v", values)
+	}
+	if values := challengeValues(zone, manual); len(values) != 1 {
+		t.Errorf("expected the record added by other means to be kept, got %v", values)
+	}
+}
@@ -10,18 +10,37 @@ import (
 
 var ErrInvalidApiKey = errors.New("invalid api key")
 
+// Scope limits what an API key may be used for.
+type Scope string
+
+const (
+	// ScopeFull keys may use the whole API.
+	ScopeFull Scope = ""
+	// ScopeACME keys may only publish ACME DNS-01 challenges.
+	ScopeACME Scope = "acme"
+)
+
 type APIKey struct {
-	UserID    string    `json:"userId"`
-	Label     string    `json:"label"`
-	Key       string    `json:"apiKey"`
+	UserID string `json:"userId"`
+	Label  string `json:"label"`
+	Key    string `json:"apiKey"`
+	Scope  Scope  `json:"scope,omitempty"`
+	// Groups are the identity provider groups of the user when the key was created, the key acts
+	// with the role they grant. They are nil for keys created before groups were recorded.
+	Groups    []string  `json:"groups"`
 	CreatedAt time.Time `json:"createdAt"`
 }
 
 type APIKeyManager interface {
 	CreateKey(ctx context.Context, userID, label string) (APIKey, error)
+	// CreateScopedKey creates a key limited to the scope that acts with the role of the user's
+	// groups.
+	CreateScopedKey(ctx context.Context, userID, label string, scope Scope, groups []string) (APIKey, error)
 	GetKeys(ctx context.Context, userID string) ([]APIKey, error)
 	DeleteKey(ctx context.Context, userID, label string) error
 	ValidateKey(ctx context.Context, key string) error
+	// LookupKey returns the API key with the given key value, or ErrInvalidApiKey.
+	LookupKey(ctx context.Context, key string) (APIKey, error)
 }
 
 func generateSecureKey(length int) (string, error) {
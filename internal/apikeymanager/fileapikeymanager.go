@@ -54,6 +54,10 @@ func (m *fileAPIKeyManager) saveKeys() error {
 }
 
 func (m *fileAPIKeyManager) CreateKey(ctx context.Context, userID, label string) (APIKey, error) {
+	return m.CreateScopedKey(ctx, userID, label, ScopeFull, nil)
+}
+
+func (m *fileAPIKeyManager) CreateScopedKey(ctx context.Context, userID, label string, scope Scope, groups []string) (APIKey, error) {
 	m.mutex.Lock()
 	defer m.mutex.Unlock()
 
@@ -66,7 +70,9 @@ func (m *fileAPIKeyManager) CreateKey(ctx context.Context, userID, label string)
 	if err != nil {
 		return APIKey{}, err
 	}
-	newKey := APIKey{UserID: userID, Label: label, Key: key, CreatedAt: time.Now()}
+	// an empty list records that the user had no groups, unlike the nil groups of old keys
+	groups = append(make([]string, 0, len(groups)), groups...)
+	newKey := APIKey{UserID: userID, Label: label, Key: key, Scope: scope, Groups: groups, CreatedAt: time.Now()}
 	m.keys[userID] = append(m.keys[userID], newKey)
 
 	if err := m.saveKeys(); err != nil {
@@ -98,20 +104,25 @@ func (m *fileAPIKeyManager) DeleteKey(ctx context.Context, userID, label string)
 }
 
 func (m *fileAPIKeyManager) ValidateKey(ctx context.Context, key string) error {
+	_, err := m.LookupKey(ctx, key)
+	return err
+}
+
+func (m *fileAPIKeyManager) LookupKey(ctx context.Context, key string) (APIKey, error) {
 	m.mutex.RLock()
 	defer m.mutex.RUnlock()
 
 	select {
 	case <-ctx.Done():
-		return ctx.Err()
+		return APIKey{}, ctx.Err()
 	default:
 		for _, apiKeys := range m.keys {
 			for _, apiKey := range apiKeys {
 				if apiKey.Key == key {
-					return nil
+					return apiKey, nil
 				}
 			}
 		}
 	}
-	return ErrInvalidApiKey
+	return APIKey{}, ErrInvalidApiKey
 }
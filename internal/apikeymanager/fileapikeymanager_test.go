@@ -174,3 +174,44 @@ func TestAPIKeyManagerMixedReadWrite(t *testing.T) {
 	wg.Wait()
 
 }
+
+func TestLookupKey(t *testing.T) {
+	manager := &fileAPIKeyManager{
+		keys: map[string][]APIKey{
+			"user1": {{UserID: "user1", Label: "deploy", Key: "key1"}},
+		},
+	}
+
+	key, err := manager.LookupKey(context.Background(), "key1")
+	if err != nil || key.Label != "deploy" || key.UserID != "user1" {
+		t.Errorf("LookupKey() = %+v, %v; want the deploy key of user1", key, err)
+	}
+	if _, err := manager.LookupKey(context.Background(), "unknown"); err != ErrInvalidApiKey {
+		t.Errorf("LookupKey() error = %v, want %v", err, ErrInvalidApiKey)
+	}
+}
+
+func TestCreateScopedKeyRecordsGroups(t *testing.T) {
+	path := t.TempDir() + "/keys.json"
+	manager, err := NewFileAPIKeyManager(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	if _, err := manager.CreateScopedKey(ctx, "user1", "support", ScopeFull, []string{"support"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := manager.CreateScopedKey(ctx, "user1", "nogroups", ScopeFull, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	// the groups survive a restart, and a user without groups is told apart from an old key
+	manager, err = NewFileAPIKeyManager(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys, _ := manager.GetKeys(ctx, "user1")
+	if len(keys) != 2 || !reflect.DeepEqual(keys[0].Groups, []string{"support"}) || keys[1].Groups == nil || len(keys[1].Groups) != 0 {
+		t.Errorf("unexpected groups of the keys %+v", keys)
+	}
+}
@@ -1,6 +1,7 @@
 package auth
 
 import (
+	"context"
 	"errors"
 	"log/slog"
 	"net/http"
@@ -18,6 +19,7 @@ const (
 	idTokenKey                    = "id_token"
 	emailKey                      = "email"
 	nameKey                       = "name"
+	groupsKey                     = "groups"
 	authenticatedKey              = "authenticated"
 	subjectKey                    = "sub"
 	LoginErrKey                   = "loginError"
@@ -110,9 +112,16 @@ func (idp *Idp) HandleSignInCallback(w http.ResponseWriter, r *http.Request) {
 	idp.sessionManager.Put(r.Context(), authenticatedKey, true)
 	idp.sessionManager.Put(r.Context(), emailKey, idToken.GetString(emailKey))
 	idp.sessionManager.Put(r.Context(), subjectKey, idToken.GetString(subjectKey))
+	idp.sessionManager.Put(r.Context(), groupsKey, idToken.GetStrings(idp.groupsClaim))
 	http.Redirect(w, r, "/dashboard", http.StatusSeeOther)
 }
 
+// UserGroups returns the groups of the logged in user as listed in the groups claim of their ID token.
+func (idp *Idp) UserGroups(ctx context.Context) []string {
+	groups, _ := idp.sessionManager.Get(ctx, groupsKey).([]string)
+	return groups
+}
+
 func (idp *Idp) LogoutHandler(w http.ResponseWriter, r *http.Request) {
 	err := idp.sessionManager.Destroy(r.Context())
 	if err != nil {
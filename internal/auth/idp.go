@@ -18,6 +18,7 @@ type Idp struct {
 	provider        string
 	restrictAccess  bool
 	whiteList       []string
+	groupsClaim     string
 	sessionManager  *scs.SessionManager
 	LoginPromptData LoginPromptData
 }
@@ -34,6 +35,8 @@ type OAuth2ClientConfig struct {
 	Tenant            string
 	Domain            string
 	LoginText         string
+	// GroupsClaim is the claim of the ID token that lists the groups of the user, "groups" by default.
+	GroupsClaim string `mapstructure:"groupsClaim"`
 }
 
 func NewIdp(config *OAuth2ClientConfig, sessionManager *scs.SessionManager) *Idp {
@@ -88,12 +91,16 @@ func NewIdp(config *OAuth2ClientConfig, sessionManager *scs.SessionManager) *Idp
 		Config:          oauthConfig,
 		provider:        provider,
 		whiteList:       config.AuthorizedDomains,
+		groupsClaim:     config.GroupsClaim,
 		sessionManager:  sessionManager,
 		LoginPromptData: lpd,
 	}
 	if config.AuthorizedDomains != nil {
 		idp.restrictAccess = true
 	}
+	if idp.groupsClaim == "" {
+		idp.groupsClaim = groupsKey
+	}
 
 	return idp
 }
@@ -1,7 +1,9 @@
 package auth
 
 import (
+	"context"
 	"net/http"
+	"slices"
 	"strings"
 
 	"github.com/theadell/dnsify/internal/apikeymanager"
@@ -30,6 +32,15 @@ func (idp *Idp) RedirectIfLoggedIn(next http.Handler) http.Handler {
 	})
 }
 
+type apiKeyContextKey struct{}
+
+// APIKeyFromContext returns the API key a request was authenticated with by
+// APIKeyValidatorMiddleware.
+func APIKeyFromContext(ctx context.Context) (apikeymanager.APIKey, bool) {
+	key, ok := ctx.Value(apiKeyContextKey{}).(apikeymanager.APIKey)
+	return key, ok
+}
+
 func APIKeyValidatorMiddleware(apiKeyMgr apikeymanager.APIKeyManager) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -43,10 +54,60 @@ func APIKeyValidatorMiddleware(apiKeyMgr apikeymanager.APIKeyManager) func(http.
 
 			apiKey := parts[1]
 
-			if err := apiKeyMgr.ValidateKey(r.Context(), apiKey); err != nil {
+			key, err := apiKeyMgr.LookupKey(r.Context(), apiKey)
+			if err != nil {
 				http.Error(w, "Invalid API Key", http.StatusUnauthorized)
 				return
 			}
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), apiKeyContextKey{}, key)))
+		})
+	}
+}
+
+// APIKeyBasicAuthMiddleware authenticates requests with HTTP basic auth, for clients that can't send
+// an API key header. The password is the API key and the username the user it belongs to. Requests
+// without valid credentials are passed to unauthorized.
+func APIKeyBasicAuthMiddleware(apiKeyMgr apikeymanager.APIKeyManager, unauthorized http.HandlerFunc) func(http.Handler) http.Handler {
+	return apiKeyCredentialsMiddleware(apiKeyMgr, unauthorized, func(r *http.Request) (string, string, bool) {
+		return r.BasicAuth()
+	})
+}
+
+// APIKeyHeaderAuthMiddleware authenticates requests with the user and the API key sent in the given
+// headers, e.g. X-Api-User and X-Api-Key of acme-dns clients.
+func APIKeyHeaderAuthMiddleware(apiKeyMgr apikeymanager.APIKeyManager, userHeader, keyHeader string, unauthorized http.HandlerFunc) func(http.Handler) http.Handler {
+	return apiKeyCredentialsMiddleware(apiKeyMgr, unauthorized, func(r *http.Request) (string, string, bool) {
+		user, key := r.Header.Get(userHeader), r.Header.Get(keyHeader)
+		return user, key, user != "" && key != ""
+	})
+}
+
+func apiKeyCredentialsMiddleware(apiKeyMgr apikeymanager.APIKeyManager, unauthorized http.HandlerFunc, credentials func(*http.Request) (string, string, bool)) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			username, password, ok := credentials(r)
+			if !ok {
+				unauthorized(w, r)
+				return
+			}
+			key, err := apiKeyMgr.LookupKey(r.Context(), password)
+			if err != nil || !strings.EqualFold(key.UserID, username) {
+				unauthorized(w, r)
+				return
+			}
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), apiKeyContextKey{}, key)))
+		})
+	}
+}
+
+// RequireAPIKeyScope passes requests authenticated with an API key of another scope to denied.
+func RequireAPIKeyScope(denied http.HandlerFunc, scopes ...apikeymanager.Scope) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if key, ok := APIKeyFromContext(r.Context()); ok && !slices.Contains(scopes, key.Scope) {
+				denied(w, r)
+				return
+			}
 			next.ServeHTTP(w, r)
 		})
 	}
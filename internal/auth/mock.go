@@ -29,6 +29,7 @@ func NewMockIdp(config *OAuth2ClientConfig, sessionManager *scs.SessionManager)
 	idp := &Idp{
 		Config:          oauthConfig,
 		provider:        "mock",
+		groupsClaim:     groupsKey,
 		sessionManager:  sessionManager,
 		LoginPromptData: LoginPromptData{Provider: "default", Text: "Sign in with your DNSify account"},
 	}
@@ -68,6 +69,7 @@ func generateMockIDToken() (string, error) {
 		"upn":                "jdoe",
 		"preferred_username": "jdoe",
 		"email":              "test@test.com",
+		"groups":             []string{"dns-editors"},
 	}
 	claimsBytes, err := json.Marshal(claims)
 	if err != nil {
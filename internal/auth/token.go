@@ -26,6 +26,25 @@ func (id IdToken) GetString(claim string) string {
 	return valString
 }
 
+// GetStrings returns a claim holding a list of strings, e.g. groups. A single string is returned
+// as a list of one.
+func (id IdToken) GetStrings(claim string) []string {
+	switch val := id[claim].(type) {
+	case string:
+		return []string{val}
+	case []any:
+		values := make([]string, 0, len(val))
+		for _, v := range val {
+			if s, ok := v.(string); ok {
+				values = append(values, s)
+			}
+		}
+		return values
+	default:
+		return nil
+	}
+}
+
 func (id IdToken) Exists(claim string) bool {
 	_, ok := id[claim]
 	return ok
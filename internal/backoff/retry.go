@@ -1,6 +1,7 @@
 package backoff
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"log/slog"
@@ -31,16 +32,17 @@ var DefaultRetryConfig = RetryConfig{
 // It uses the provided RetryConfig for configuration. If the operation continues to fail
 // after the maximum number of retries, the last error is returned.
 //
-// The delay between retries is subject to jitter (randomness)
+// The delay between retries is subject to jitter (randomness). Retrying stops with the error of
+// the context once it is canceled or its deadline is exceeded.
 //
 // Example:
 //
 //	op := &SomeOperation{}
-//	err := retryWithBackoff(op, DefaultRetryConfig)
+//	err := retryWithBackoff(ctx, op, DefaultRetryConfig)
 //	if err != nil {
 //	    log.Fatalf("Operation failed after retries: %v", err)
 //	}
-func RetryWithBackoff(op func() error, config RetryConfig) error {
+func RetryWithBackoff(ctx context.Context, op func() error, config RetryConfig) error {
 	delay := config.InitialDelay
 
 	for i := 0; i < config.MaxRetries; i++ {
@@ -48,12 +50,21 @@ func RetryWithBackoff(op func() error, config RetryConfig) error {
 		if err == nil {
 			return nil
 		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
 
 		// Calculate the next delay with jitter
 		jitter := time.Duration(rand.Float64() * config.JitterFactor * float64(delay))
 		nextDelay := delay + jitter
 		slog.Info(fmt.Sprintf("Attempt %d failed; retrying in %v...\n", i+1, nextDelay))
-		time.Sleep(nextDelay)
+		timer := time.NewTimer(nextDelay)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		}
 
 		// Double the delay for the next iteration, but don't exceed MaxDelay
 		delay = time.Duration(math.Min(float64(2*delay), float64(config.MaxDelay)))
@@ -0,0 +1,45 @@
+package dnsservice
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"github.com/theadell/dnsify/internal/rbac"
+)
+
+// Authorize reports whether the record set of the name and type may be changed by the role of
+// ctx. It returns ErrImmutableRecord for record sets guarded as immutable and ErrNotAuthorized if
+// the role is a viewer, or an editor and the record set is guarded as admin only. Contexts
+// without a role, e.g. of the command line tools, are not restricted by roles.
+func (c *Client) Authorize(ctx context.Context, name, recordType string) error {
+	if c.isImmutableSet(name, recordType) {
+		return fmt.Errorf("%w: %s %s", ErrImmutableRecord, recordType, name)
+	}
+	return authorizeRole(ctx, name, recordType, c.guards.AdminOnly)
+}
+
+func authorizeRole(ctx context.Context, name, recordType string, adminOnly GuardList) error {
+	role, ok := rbac.RoleFromContext(ctx)
+	if !ok {
+		return nil
+	}
+	if !role.CanEdit() {
+		return fmt.Errorf("%w: the %s role can't change records", ErrNotAuthorized, role)
+	}
+	if !role.IsAdmin() && adminOnly.Guarded(recordType, name) {
+		return fmt.Errorf("%w: %s %s can only be changed by admins", ErrNotAuthorized, recordType, name)
+	}
+	return nil
+}
+
+// authorizeSets checks the role of ctx for every changed record set.
+func (c *Client) authorizeSets(ctx context.Context, sets []recordSetChange) error {
+	for _, set := range sets {
+		if err := authorizeRole(ctx, set.name, set.recordType, c.guards.AdminOnly); err != nil {
+			slog.Warn("Rejected a change the role may not make", "name", set.name, "type", set.recordType, "error", err.Error())
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,52 @@
+package dnsservice
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/theadell/dnsify/internal/rbac"
+)
+
+func TestAuthorizeRoles(t *testing.T) {
+	c, updates := newUpdateTestClient(t)
+	c.guards = parseGuards(RecordGuards{
+		Immutable:     []string{"TXT/@"},
+		AdminEditable: []string{"A/admin"},
+	}, c.zone)
+	admin := NewRecord("admin.example.com.", 300, &ARecord{IP: "192.0.2.1"})
+	www := NewRecord("www.example.com.", 300, &ARecord{IP: "192.0.2.2"})
+
+	tests := []struct {
+		name   string
+		ctx    context.Context
+		record Record
+		want   error
+	}{
+		{"no role", context.Background(), admin, nil},
+		{"viewer", rbac.WithRole(context.Background(), rbac.RoleViewer), www, ErrNotAuthorized},
+		{"editor", rbac.WithRole(context.Background(), rbac.RoleEditor), www, nil},
+		{"editor on admin only", rbac.WithRole(context.Background(), rbac.RoleEditor), admin, ErrNotAuthorized},
+		{"admin on admin only", rbac.WithRole(context.Background(), rbac.RoleAdmin), admin, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := c.AddRecord(tt.ctx, tt.record)
+			if !errors.Is(err, tt.want) || (tt.want == nil && err != nil) {
+				t.Fatalf("AddRecord() error = %v, want %v", err, tt.want)
+			}
+			if tt.want == nil {
+				<-updates
+			}
+		})
+	}
+
+	err := c.Authorize(rbac.WithRole(context.Background(), rbac.RoleAdmin), "example.com.", "TXT")
+	if !errors.Is(err, ErrImmutableRecord) {
+		t.Errorf("expected immutable records to be rejected for admins, got %v", err)
+	}
+	changes := ChangeSet{Add: []Record{www, admin}}
+	if _, err := c.PlanChangeSet(rbac.WithRole(context.Background(), rbac.RoleEditor), changes); !errors.Is(err, ErrNotAuthorized) {
+		t.Errorf("expected a change set touching an admin only set to be rejected, got %v", err)
+	}
+}
@@ -0,0 +1,138 @@
+package dnsservice
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+
+	"github.com/theadell/dnsify/internal/journal"
+)
+
+// ErrInvalidChangeSet is returned if a change set does not apply to the cached zone, e.g. because
+// it removes a record that does not exist.
+var ErrInvalidChangeSet = errors.New("invalid change set")
+
+// ChangeSet is a batch of record changes that is applied atomically with a single UPDATE
+// message, e.g. to create the A, AAAA and TXT records of a host together or to swap a CNAME for
+// an A record. Records are removed from and added to the record sets of their name and type
+// like RemoveRecord and AddRecord do, removals first.
+type ChangeSet struct {
+	Add    []Record
+	Remove []Record
+}
+
+// IsEmpty reports whether the change set contains no changes.
+func (cs ChangeSet) IsEmpty() bool {
+	return len(cs.Add) == 0 && len(cs.Remove) == 0
+}
+
+// recordSetChange replaces the current records of a record set with members.
+type recordSetChange struct {
+	name       string
+	recordType string
+	current    []Record
+	members    []Record
+}
+
+// ApplyChangeSet validates all changes against the guards and the cached zone and applies them
+// with a single UPDATE message, whose prerequisites require every affected record set on the
+// server to still match the cache. Either all changes are applied or none.
+func (c *Client) ApplyChangeSet(ctx context.Context, changes ChangeSet) error {
+	slog.Debug("Attempting to apply change set", "add", len(changes.Add), "remove", len(changes.Remove))
+
+	sets, err := c.planChangeSet(changes)
+	if err != nil {
+		return err
+	}
+	if err := c.applyRecordSetChanges(ctx, sets, journal.Entry{Action: journal.ActionChangeSet}); err != nil {
+		return err
+	}
+	slog.Info("Change set applied successfully", "add", len(changes.Add), "remove", len(changes.Remove), "record_sets", len(sets))
+	return nil
+}
+
+// planChangeSet computes the resulting members of every record set affected by the changes.
+func (c *Client) planChangeSet(changes ChangeSet) ([]recordSetChange, error) {
+	var sets []recordSetChange
+	setOf := func(record Record) (*recordSetChange, error) {
+		if c.isImmutable(record) {
+			slog.Warn("Attempted to modify an immutable record", "record", record.Name)
+			return nil, fmt.Errorf("%w: %s %s", ErrImmutableRecord, record.Data.RecordType(), record.Name)
+		}
+		i := slices.IndexFunc(sets, func(set recordSetChange) bool {
+			return strings.EqualFold(set.name, record.Name) && set.recordType == record.Data.RecordType()
+		})
+		if i < 0 {
+			current := c.cachedRecordSet(record.Name, record.Data.RecordType())
+			sets = append(sets, recordSetChange{
+				name:       record.Name,
+				recordType: record.Data.RecordType(),
+				current:    current,
+				members:    slices.Clone(current),
+			})
+			i = len(sets) - 1
+		}
+		return &sets[i], nil
+	}
+
+	for _, record := range changes.Remove {
+		set, err := setOf(record)
+		if err != nil {
+			return nil, err
+		}
+		i := slices.IndexFunc(set.members, func(r Record) bool { return SameRecord(r, record) })
+		if i < 0 {
+			return nil, fmt.Errorf("%w: %s does not exist", ErrInvalidChangeSet, record)
+		}
+		set.members = slices.Delete(set.members, i, i+1)
+	}
+	for _, record := range changes.Add {
+		set, err := setOf(record)
+		if err != nil {
+			return nil, err
+		}
+		set.members = slices.DeleteFunc(set.members, func(r Record) bool { return SameRecord(r, record) })
+		if t, ok := LookupRecordType(record.Data.RecordType()); ok && t.Singleton {
+			set.members = nil
+		}
+		set.members = append(set.members, record)
+	}
+
+	if err := c.checkCNAMEConflicts(sets); err != nil {
+		return nil, err
+	}
+	return sets, nil
+}
+
+// checkCNAMEConflicts returns an error if the changes leave a name with a CNAME record and other
+// records, which the DNS server would silently ignore.
+func (c *Client) checkCNAMEConflicts(sets []recordSetChange) error {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	for _, set := range sets {
+		types := make(map[string]bool)
+		for _, record := range c.cache {
+			if strings.EqualFold(record.Name, set.name) {
+				types[record.Data.RecordType()] = true
+			}
+		}
+		for _, other := range sets {
+			if strings.EqualFold(other.name, set.name) {
+				types[other.recordType] = len(other.members) > 0
+			}
+		}
+		if !types["CNAME"] {
+			continue
+		}
+		for recordType, used := range types {
+			if used && recordType != "CNAME" {
+				return fmt.Errorf("%w: %s can't have a CNAME and %s records", ErrInvalidChangeSet, set.name, recordType)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,76 @@
+package dnsservice
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+func TestApplyChangeSetSwapsCNAME(t *testing.T) {
+	cname := NewRecord("www.example.com.", 3600, &CNAMERecord{Alias: "web.example.net."})
+	c, updates := newUpdateTestClient(t, cname)
+
+	changes := ChangeSet{
+		Remove: []Record{cname},
+		Add: []Record{
+			NewRecord("www.example.com.", 300, &ARecord{IP: "192.0.2.1"}),
+			NewRecord("www.example.com.", 300, &AAAARecord{IPv6: "2001:db8::1"}),
+		},
+	}
+	if err := c.ApplyChangeSet(context.Background(), changes); err != nil {
+		t.Fatalf("ApplyChangeSet() error = %v", err)
+	}
+
+	msg := <-updates
+	if len(msg.Answer) != 3 {
+		t.Errorf("expected a prerequisite for each record set, got %v", msg.Answer)
+	}
+	if len(msg.Ns) != 3 {
+		t.Fatalf("expected the CNAME set to be deleted and two records to be inserted, got %v", msg.Ns)
+	}
+	if msg.Ns[0].Header().Rrtype != dns.TypeCNAME || msg.Ns[0].Header().Class != dns.ClassANY {
+		t.Errorf("expected the deletion of the CNAME set before the insertions, got %v", msg.Ns[0])
+	}
+
+	records := c.GetRecords()
+	if len(records) != 2 || records[0].Data.RecordType() == "CNAME" || records[1].Data.RecordType() == "CNAME" {
+		t.Errorf("expected the CNAME to be replaced in the cache, got %v", records)
+	}
+}
+
+func TestPlanChangeSet(t *testing.T) {
+	cname := NewRecord("www.example.com.", 3600, &CNAMERecord{Alias: "web.example.net."})
+	c, _ := newUpdateTestClient(t, cname)
+	c.guards = parseGuards(RecordGuards{Immutable: []string{"*/ns1"}}, "example.com.")
+
+	tests := []struct {
+		name    string
+		changes ChangeSet
+		wantErr error
+	}{
+		{
+			name:    "immutable record",
+			changes: ChangeSet{Add: []Record{NewRecord("ns1.example.com.", 300, &ARecord{IP: "192.0.2.1"})}},
+			wantErr: ErrImmutableRecord,
+		},
+		{
+			name:    "missing record",
+			changes: ChangeSet{Remove: []Record{NewRecord("foo.example.com.", 300, &ARecord{IP: "192.0.2.1"})}},
+			wantErr: ErrInvalidChangeSet,
+		},
+		{
+			name:    "CNAME and other data",
+			changes: ChangeSet{Add: []Record{NewRecord("www.example.com.", 300, &ARecord{IP: "192.0.2.1"})}},
+			wantErr: ErrInvalidChangeSet,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := c.planChangeSet(tt.changes); !errors.Is(err, tt.wantErr) {
+				t.Errorf("planChangeSet() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
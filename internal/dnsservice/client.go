@@ -1,28 +1,59 @@
 package dnsservice
 
 import (
+	"context"
 	"errors"
+	"io"
 	"log/slog"
-	"strings"
 	"sync"
 	"time"
 
 	"github.com/miekg/dns"
 	"github.com/theadell/dnsify/internal/backoff"
+	"github.com/theadell/dnsify/internal/journal"
 )
 
 var ErrServerNotReachable = errors.New("server not reachable")
 
+// Service manages the records of a zone. Methods that talk to the DNS server take a context,
+// which bounds the DNS exchanges and aborts them when it is canceled, e.g. when the client of
+// an HTTP request went away. The other methods only read the cached state.
 type Service interface {
 	HealthCheck() HealthState
 	GetRecords() []Record
-	AddRecord(Record) error
-	RemoveRecord(Record) error
+	// AddRecord adds a record to the record set of its name and type.
+	AddRecord(context.Context, Record) error
+	// ReplaceRecordSet replaces all records of a record set, an empty set deletes it.
+	ReplaceRecordSet(context.Context, RecordSet) error
+	// RemoveRecord removes a single record from its record set.
+	RemoveRecord(context.Context, Record) error
+	// ApplyChangeSet applies all changes of the change set atomically.
+	ApplyChangeSet(context.Context, ChangeSet) error
+	// ExportZone writes the cached zone as an RFC 1035 master file.
+	ExportZone(io.Writer) error
+	// DiffZone returns the changes that turn the cached zone into the desired records.
+	DiffZone([]Record) ZoneDiff
+	// PlanChangeSet validates a change set and returns the plan of applying it, without applying it.
+	PlanChangeSet(context.Context, ChangeSet) (Plan, error)
+	// ApplyPlan applies a plan by its token, unless the zone changed since the plan was made.
+	ApplyPlan(context.Context, string) error
+	// History returns the journal entries of the zone, or of a name if it is not empty, newest first.
+	History(ctx context.Context, name string, limit int) ([]journal.Entry, error)
+	// Rollback reverts the change recorded in the journal entry with the given ID.
+	Rollback(context.Context, string) error
+	// Authorize returns an error if the record set of the name and type may not be changed, be it
+	// because it is immutable or because of the role of the context.
+	Authorize(ctx context.Context, name, recordType string) error
 	GetRecordByHash(string) *Record
 	GetRecordForFQDN(string, string) *Record
 	GetZone() string
 	GetIPv4() string
 	GetIPv6() string
+	// RequestSync asks the service to synchronize its cache with the DNS server as soon as possible.
+	RequestSync()
+	// Subscribe returns a channel that receives a value whenever a synchronization changed the cached
+	// records, along with a function that ends the subscription.
+	Subscribe() (<-chan struct{}, func())
 	Close()
 }
 
@@ -34,47 +65,92 @@ type Client struct {
 	zone                string
 	ipv4                string
 	ipv6                string
-	serverAddr          string
-	tsigKey             string
+	servers             []ServerEndpoint // primary server first
+	keys                []TSIGKey        // primary key first
+	sig0                *SIG0Key         // signs updates instead of the TSIG keys if set
 	SyncInterval        int
 	HealthCheckInterval int
 	done                chan bool
+	ctx                 context.Context // canceled on Close, bounds the background synchronization
+	cancel              context.CancelFunc
+	resync              chan struct{}
+	events              broadcaster
 	healthState         HealthState
+	soa                 *dns.SOA
+	plans               planStore
+	journal             journal.Journal // records applied changes if set
 	wg                  sync.WaitGroup
 }
 type HealthState struct {
+	// ServerReachable reports whether any server of the zone answered the last health check.
 	ServerReachable bool
-	LastChecked     time.Time
-	LastSynced      time.Time
-	SyncError       error
-	CheckError      error
+	// Servers reports the reachability and SOA serial of each server, primary server first.
+	Servers []ServerHealth
+	// Nameservers reports the SOA serial of each address of the zone's NS set, which may include
+	// servers DNSify does not talk to otherwise.
+	Nameservers []NameserverHealth
+	LastChecked time.Time
+	LastSynced  time.Time
+	// SyncMode reports how the last successful synchronization obtained the zone.
+	SyncMode SyncMode
+	// Serial is the SOA serial of the cached zone.
+	Serial uint32
+	// TSIGKey is the name of the TSIG key the server last accepted.
+	TSIGKey string
+	// TSIGError reports TSIG keys the server rejected, e.g. with BADKEY or BADSIG. It is
+	// set while DNSify falls back to a secondary key.
+	TSIGError  error
+	SyncError  error
+	CheckError error
+	// NameserverError reports the nameservers of the NS set that don't answer authoritatively or
+	// lag behind the primary server.
+	NameserverError error
 }
 
 func NewClient(config DNSConfig) (*Client, error) {
+	return NewClientContext(context.Background(), config)
+}
+
+// NewClientContext is like NewClient, but the initial zone transfer and health check are bounded
+// by ctx, so a client for a one-off command doesn't wait for an unreachable server forever.
+func NewClientContext(ctx context.Context, config DNSConfig) (*Client, error) {
 	if err := validateConfig(&config); err != nil {
 		return nil, err
 	}
 	client := &Client{
-		cache:      make([]Record, 0),
-		mutex:      sync.RWMutex{},
-		guards:     parseGuards(config.Guards, config.Zone),
-		client:     new(dns.Client),
-		zone:       config.Zone,
-		ipv4:       config.Ipv4,
-		ipv6:       config.Ipv6,
-		serverAddr: config.Addr,
-		tsigKey:    config.TsigKey,
-		done:       make(chan bool),
+		cache:  make([]Record, 0),
+		mutex:  sync.RWMutex{},
+		guards: parseGuards(config.Guards, config.Zone),
+		client: new(dns.Client),
+		zone:   config.Zone,
+		ipv4:   config.Ipv4,
+		ipv6:   config.Ipv6,
+		done:   make(chan bool),
+		resync: make(chan struct{}, 1),
 		healthState: HealthState{
 			ServerReachable: true,
 			LastChecked:     time.Now(),
 			LastSynced:      time.Now(),
 		},
 	}
-	client.client.TsigSecret = map[string]string{config.TsigKey: config.TsigSecret}
-	if err := client.fetchAndCacheRecords(); err != nil {
+	client.ctx, client.cancel = context.WithCancel(context.Background())
+	client.servers, _ = config.servers() // already validated
+	client.keys, _ = config.tsigKeys()
+	client.client.TsigSecret = tsigSecrets(client.keys)
+	if config.Sig0KeyFile != "" {
+		key, err := LoadSIG0Key(config.Sig0KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		client.sig0 = key
+	}
+	if err := client.fetchAndCacheRecords(ctx); err != nil {
+		client.cancel()
 		return nil, err
 	}
+	client.healthState.SyncMode = SyncModeAXFR
+	client.healthState.Serial = client.soa.Serial
+	client.checkHealth(ctx)
 
 	client.wg.Add(2)
 	go client.periodicHealthCheck(time.Duration(config.HealthCheckInterval) * time.Second)
@@ -100,7 +176,20 @@ func (c *Client) HealthCheck() HealthState {
 	return c.healthState
 }
 
+func (c *Client) RequestSync() {
+	select {
+	case c.resync <- struct{}{}:
+	default:
+		// a synchronization is already pending
+	}
+}
+
+func (c *Client) Subscribe() (<-chan struct{}, func()) {
+	return c.events.subscribe()
+}
+
 func (c *Client) Close() {
+	c.cancel()
 	close(c.done)
 	c.wg.Wait()
 }
@@ -116,33 +205,62 @@ func (c *Client) Close() {
 //
 // domain: The target domain name (zone), e.g., "example.com".
 //
-// dnsServer: The address (including port) of the DNS server to fetch the records from, e.g. "ns1.example.com:53".
+// client: The DNS client used to connect to the server, which determines the transport (TCP or TLS).
 //
-// keyName: The name of the TSIG key used for authentication.
+// dnsServer: The address (including port) of the DNS server to fetch the records from, e.g. "ns1.example.com:53".
 //
-// secret: The actual secret part of the TSIG key. Both the DNS client and server must have this
+// key: The TSIG key used for authentication. Both the DNS client and server must have its secret
 //
-//	secret to mutually authenticate DNS messages.
+//	to mutually authenticate DNS messages.
 //
 // Returns:
 //
-// If successful, returns a slice of DNS records related to the domain. If there are any errors during the
-// process, the function returns an error.
-func fetchZoneRecords(domain, dnsServer, keyName, secret string) ([]Record, error) {
+// If successful, returns a slice of DNS records related to the domain along with the SOA record of the zone.
+// If there are any errors during the process, the function returns an error.
+func fetchZoneRecords(ctx context.Context, domain string, client *dns.Client, dnsServer string, key TSIGKey) ([]Record, *dns.SOA, error) {
 	// Create a new DNS message.
 	m := new(dns.Msg)
 
-	// Create a transfer object.
-	t := new(dns.Transfer)
-
-	// Associate the keyName with the provided secret for TSIG authentication.
-	t.TsigSecret = map[string]string{keyName: secret}
-
 	// Set the request type to AXFR to fetch all records of the domain.
 	m.SetAxfr(domain)
 
-	// Set up TSIG (Transaction Signature) for authentication.
-	m.SetTsig(keyName, dns.HmacSHA256, 300, time.Now().Unix())
+	rr, err := transferIn(ctx, client, m, dnsServer, key)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	soa, ok := rr[0].(*dns.SOA)
+	if !ok {
+		return nil, nil, errMissingSOA
+	}
+	return recordsFromRRs(rr), soa, nil
+}
+
+// transferIn performs the zone transfer (AXFR or IXFR) requested by m over a connection of the
+// client, which must use a stream transport, and returns all resource records of the response in
+// order. The transfer is aborted when ctx is done.
+func transferIn(ctx context.Context, client *dns.Client, m *dns.Msg, dnsServer string, key TSIGKey) ([]dns.RR, error) {
+	// Dial the server ourselves, the dns package does not support contexts for transfers.
+	conn, err := client.DialContext(ctx, dnsServer)
+	if err != nil {
+		return nil, err
+	}
+	// Closing the connection makes the pending read of the transfer fail.
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	// Create a transfer object.
+	t := &dns.Transfer{Conn: conn}
+
+	// Associate the key name with the secret for TSIG authentication.
+	t.TsigSecret = map[string]string{key.Name: key.Secret}
+
+	// Set up TSIG (Transaction Signature) for authentication, unless the server allows unsigned
+	// transfers.
+	m = m.Copy()
+	if key.Name != "" {
+		m.SetTsig(key.Name, key.Algorithm, 300, time.Now().Unix())
+	}
 
 	// Initiate the transfer.
 	channels, err := t.In(m, dnsServer)
@@ -150,47 +268,36 @@ func fetchZoneRecords(domain, dnsServer, keyName, secret string) ([]Record, erro
 		return nil, err
 	}
 
-	var records []Record
 	var rr []dns.RR
 	// Process the responses to collect records.
 	for env := range channels {
 		if env.Error != nil {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			if rejected := tsigRejection(nil, env.Error); rejected != nil {
+				return nil, rejected
+			}
 			return nil, env.Error
 		}
 		rr = append(rr, env.RR...)
 	}
-	for _, r := range rr {
-
-		var recordData RecordData
-		recordName := r.Header().Name
-		recordTTL := uint(r.Header().Ttl)
-
-		switch record := r.(type) {
-		case *dns.A:
-			recordData = &ARecord{IP: record.A.String()}
-		case *dns.AAAA:
-			recordData = &AAAARecord{IPv6: record.AAAA.String()}
-		case *dns.NS:
-			recordData = &NSRecord{NameServer: record.Ns}
-		case *dns.CNAME:
-			recordData = &CNAMERecord{Alias: record.Target}
-		case *dns.MX:
-			recordData = &MXRecord{Priority: uint16(record.Preference), MailServer: record.Mx}
-		case *dns.TXT:
-			recordData = &TXTRecord{Text: strings.Join(record.Txt, "")}
-		default:
-			continue // Skip unsupported record types
-		}
-
-		records = append(records, NewRecord(recordName, recordTTL, recordData))
+	if len(rr) == 0 {
+		return nil, errMissingSOA
 	}
-
-	return records, nil
+	return rr, nil
 }
 
-func (c *Client) fetchAndCacheRecords() error {
-	return backoff.RetryWithBackoff(func() error {
-		records, err := fetchZoneRecords(c.zone, c.serverAddr, c.tsigKey, c.client.TsigSecret[c.tsigKey])
+func (c *Client) fetchAndCacheRecords(ctx context.Context) error {
+	return backoff.RetryWithBackoff(ctx, func() error {
+		var records []Record
+		var soa *dns.SOA
+		err := c.withServers(ctx, func(server ServerEndpoint) error {
+			return c.withTSIG(func(key TSIGKey) (err error) {
+				records, soa, err = fetchZoneRecords(ctx, c.zone, c.dnsClient(server, true), server.Addr, key)
+				return err
+			})
+		})
 		c.mutex.Lock()
 		defer c.mutex.Unlock()
 		if err != nil {
@@ -199,6 +306,7 @@ func (c *Client) fetchAndCacheRecords() error {
 			return err
 		}
 		c.cache = records
+		c.soa = soa
 		return nil
 	}, backoff.DefaultRetryConfig)
 }
@@ -211,17 +319,12 @@ func (c *Client) periodicSyncRecords(interval time.Duration) {
 	for {
 		select {
 		case <-ticker.C:
-			err := c.fetchAndCacheRecords()
-			c.mutex.Lock()
-			if err != nil {
-				c.healthState.SyncError = err
-				slog.Error("Failed to synchronize records", "error", err.Error())
-			} else {
-				c.healthState.LastSynced = time.Now()
-				c.healthState.SyncError = nil
-				slog.Info("Records synchronized successfully")
-			}
-			c.mutex.Unlock()
+			c.sync()
+
+		case <-c.resync:
+			slog.Info("Synchronization requested", "zone", c.zone)
+			c.sync()
+			ticker.Reset(interval)
 
 		case <-c.done:
 			slog.Info("Terminating periodic record synchronization")
@@ -230,6 +333,27 @@ func (c *Client) periodicSyncRecords(interval time.Duration) {
 	}
 }
 
+func (c *Client) sync() {
+	mode, err := c.syncRecords(c.ctx)
+	c.mutex.Lock()
+	if err != nil {
+		c.healthState.SyncError = err
+		slog.Error("Failed to synchronize records", "error", err.Error())
+		c.mutex.Unlock()
+		return
+	}
+	c.healthState.LastSynced = time.Now()
+	c.healthState.SyncError = nil
+	c.healthState.SyncMode = mode
+	c.healthState.Serial = c.soa.Serial
+	slog.Info("Records synchronized successfully", "mode", mode, "serial", c.soa.Serial)
+	c.mutex.Unlock()
+
+	if mode != SyncModeUnchanged {
+		c.events.publish()
+	}
+}
+
 func (c *Client) periodicHealthCheck(interval time.Duration) {
 	defer c.wg.Done()
 	ticker := time.NewTicker(interval)
@@ -238,17 +362,7 @@ func (c *Client) periodicHealthCheck(interval time.Duration) {
 	for {
 		select {
 		case <-ticker.C:
-			reachable := c.isServerReachable()
-			c.mutex.Lock()
-			c.healthState.ServerReachable = reachable
-			c.healthState.LastChecked = time.Now()
-			if !reachable {
-				c.healthState.CheckError = ErrServerNotReachable
-				slog.Error("DNS server not reachable")
-			} else {
-				c.healthState.CheckError = nil
-			}
-			c.mutex.Unlock()
+			c.checkHealth(c.ctx)
 
 		case <-c.done:
 			slog.Info("Terminating periodic health check")
@@ -257,9 +371,25 @@ func (c *Client) periodicHealthCheck(interval time.Duration) {
 	}
 }
 
-func (c *Client) isServerReachable() bool {
-	m := new(dns.Msg)
-	m.SetQuestion(c.zone, dns.TypeSOA)
-	r, _, err := c.client.Exchange(m, c.serverAddr)
-	return err == nil && len(r.Answer) > 0
+// exchangeContext sends the message like dns.Client.ExchangeContext, which only honors the
+// deadline of ctx, but also aborts the exchange as soon as ctx is canceled.
+func exchangeContext(ctx context.Context, client *dns.Client, m *dns.Msg, addr string) (*dns.Msg, error) {
+	conn, err := client.DialContext(ctx, addr)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	// Closing the connection makes the pending read fail.
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	r, _, err := client.ExchangeWithConnContext(ctx, m, conn)
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+	// the read deadline of the connection is the deadline of ctx and may expire before ctx does
+	if deadline, ok := ctx.Deadline(); ok && err != nil && !time.Now().Before(deadline) {
+		return nil, context.DeadlineExceeded
+	}
+	return r, err
 }
@@ -13,11 +13,53 @@ type DNSConfig struct {
 	ClientConfig `mapstructure:"client"`
 }
 
+// ZonesConfig describes all zones managed by a single DNSify instance. The top level server and
+// client sections describe a single zone and are kept for single zone setups, additional zones
+// are listed under Zones, each with its own server, TSIG credentials, guards and intervals.
+type ZonesConfig struct {
+	DNSConfig `mapstructure:",squash"`
+	Zones     []DNSConfig  `mapstructure:"zones"`
+	Notify    NotifyConfig `mapstructure:"notify"`
+}
+
+// All returns the configuration of every configured zone. The zone of the top level
+// section, if any, comes first and is therefore the default zone.
+func (c ZonesConfig) All() []DNSConfig {
+	configs := make([]DNSConfig, 0, len(c.Zones)+1)
+	if c.Zone != "" || c.Addr != "" || len(c.Servers) > 0 {
+		configs = append(configs, c.DNSConfig)
+	}
+	return append(configs, c.Zones...)
+}
+
+// NotifyConfig configures the optional listener for DNS NOTIFY messages (RFC 1996), which
+// lets primaries trigger an immediate resynchronization of a managed zone.
+type NotifyConfig struct {
+	// Listen is the address (host:port) to accept NOTIFY messages on over UDP and TCP.
+	// The listener is disabled if empty.
+	Listen string `mapstructure:"listen"`
+	// AllowedPrimaries lists the IP addresses or CIDR ranges NOTIFY messages are accepted from.
+	AllowedPrimaries []string `mapstructure:"allowedPrimaries"`
+	// RequireTSIG rejects NOTIFY messages that are not signed with the TSIG key of the zone.
+	RequireTSIG bool `mapstructure:"requireTsig"`
+}
+
 type ServerConfig struct {
-	Addr       string
+	// Addr is the address of the DNS server, which is the primary server unless Servers is set.
+	Addr string
+	// Servers lists the primary and secondary servers of the zone. It takes precedence over Addr.
+	Servers    []ServerEndpoint
 	Zone       string
 	TsigKey    string
 	TsigSecret string
+	// TsigAlgorithm is the HMAC algorithm of TsigKey, e.g. "hmac-sha512". Defaults to "hmac-sha256".
+	TsigAlgorithm string
+	// TsigKeys lists named TSIG keys with primary and secondary roles for key rotation. They
+	// take precedence over TsigKey and TsigSecret.
+	TsigKeys []TSIGKey
+	// Sig0KeyFile is the path of a private key file created by dnssec-keygen or "dnsify keygen".
+	// If set, updates are signed with SIG(0) instead of TSIG.
+	Sig0KeyFile string
 }
 
 type ClientConfig struct {
@@ -29,14 +71,14 @@ type ClientConfig struct {
 }
 
 func validateConfig(config *DNSConfig) error {
-	if err := validateAddress(config.Addr); err != nil {
+	if _, err := config.servers(); err != nil {
 		return err
 	}
 	if config.Zone == "" {
 		return fmt.Errorf("zone must be specified")
 	}
-	if config.TsigKey == "" || config.TsigSecret == "" {
-		return fmt.Errorf("TSIGKey and TSIGSecret must be specified")
+	if _, err := config.tsigKeys(); err != nil {
+		return err
 	}
 	if config.SyncInterval <= 0 {
 		config.SyncInterval = 30
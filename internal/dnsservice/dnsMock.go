@@ -1,37 +1,57 @@
 package dnsservice
 
 import (
+	"context"
 	"fmt"
+	"io"
+	"slices"
 	"sync"
 	"time"
+
+	"github.com/theadell/dnsify/internal/journal"
 )
 
+const mockZone = "mock.example.com."
+
 type MockClient struct {
-	cache []Record
-	mutex sync.RWMutex
+	cache   []Record
+	zone    string
+	serial  uint32 // incremented on every change like the SOA serial of a zone
+	plans   planStore
+	events  broadcaster
+	journal journal.Journal
+	mutex   sync.RWMutex
 }
 
 func NewMockClient() *MockClient {
 	return &MockClient{
 		cache: make([]Record, 0),
+		zone:  mockZone,
 		mutex: sync.RWMutex{},
 	}
 }
 
 func NewMockClientWithTestRecords() *MockClient {
+	return NewMockClientForZone(mockZone)
+}
+
+// NewMockClientForZone returns a MockClient managing the given zone, seeded with test records.
+func NewMockClientForZone(zone string) *MockClient {
 	m := &MockClient{
 		cache: make([]Record, 0),
+		zone:  zone,
 		mutex: sync.RWMutex{},
 	}
-	m.AddRecord(NewRecord("foo.rusty-leipzig.com.", 100, &ARecord{IP: "192.168.1.1"}))
-	m.AddRecord(NewRecord("foo.rusty-leipzig.com.", 100, &AAAARecord{IPv6: "::1"}))
-	m.AddRecord(NewRecord("bar.rusty-leipzig.com.", 100, &ARecord{IP: "192.168.1.1"}))
-	m.AddRecord(NewRecord("bar.rusty-leipzig.com.", 100, &AAAARecord{IPv6: "::1"}))
+	ctx := context.Background()
+	m.AddRecord(ctx, NewRecord("foo."+zone, 100, &ARecord{IP: "192.168.1.1"}))
+	m.AddRecord(ctx, NewRecord("foo."+zone, 100, &AAAARecord{IPv6: "::1"}))
+	m.AddRecord(ctx, NewRecord("bar."+zone, 100, &ARecord{IP: "192.168.1.1"}))
+	m.AddRecord(ctx, NewRecord("bar."+zone, 100, &AAAARecord{IPv6: "::1"}))
 	return m
 }
 
 func (m *MockClient) GetZone() string {
-	return "mock.example.com."
+	return m.zone
 }
 
 func (m *MockClient) GetIPv4() string {
@@ -73,28 +93,235 @@ func (m *MockClient) GetRecordByHash(targetHash string) *Record {
 	return nil
 }
 
-func (m *MockClient) AddRecord(record Record) error {
+func (m *MockClient) AddRecord(ctx context.Context, record Record) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if err := m.Authorize(ctx, record.Name, record.Data.RecordType()); err != nil {
+		return err
+	}
+	defer m.recordChange(ctx, journal.ActionAdd, record.Name, record.Data.RecordType())()
 	m.mutex.Lock()
 	defer m.mutex.Unlock()
 
-	// Here we just simulate adding by appending to our in-memory slice
+	// Here we just simulate adding by appending to our in-memory slice, applying
+	// the TTL to the whole record set like the DNS server would
+	t, _ := LookupRecordType(record.Data.RecordType())
+	m.cache = slices.DeleteFunc(m.cache, func(r Record) bool {
+		return SameRecord(r, record) || (t.Singleton && inRecordSet(r, record.Name, record.Data.RecordType()))
+	})
+	for i, r := range m.cache {
+		if inRecordSet(r, record.Name, record.Data.RecordType()) {
+			m.cache[i].TTL = record.TTL
+			m.cache[i].Hash = hashRecord(m.cache[i])
+		}
+	}
 	m.cache = append(m.cache, record)
+	m.serial++
 	return nil
 }
 
-func (m *MockClient) RemoveRecord(record Record) error {
+func (m *MockClient) ReplaceRecordSet(ctx context.Context, set RecordSet) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if err := m.Authorize(ctx, set.Name, set.Type); err != nil {
+		return err
+	}
+	if err := checkSingleton(set); err != nil {
+		return err
+	}
+	defer m.recordChange(ctx, journal.ActionReplace, set.Name, set.Type)()
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.cache = slices.DeleteFunc(m.cache, func(r Record) bool {
+		return inRecordSet(r, set.Name, set.Type)
+	})
+	for _, record := range set.Records {
+		record.TTL = set.TTL
+		record.Hash = hashRecord(record)
+		m.cache = append(m.cache, record)
+	}
+	m.serial++
+	return nil
+}
+
+func (m *MockClient) RemoveRecord(ctx context.Context, record Record) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if err := m.Authorize(ctx, record.Name, record.Data.RecordType()); err != nil {
+		return err
+	}
+	defer m.recordChange(ctx, journal.ActionRemove, record.Name, record.Data.RecordType())()
 	m.mutex.Lock()
 	defer m.mutex.Unlock()
 
 	for i, r := range m.cache {
-		if r.Name == record.Name && r.Data.RecordType() == record.Data.RecordType() && r.Data.String() == record.Data.String() {
+		if SameRecord(r, record) {
 			m.cache = append(m.cache[:i], m.cache[i+1:]...)
+			m.serial++
 			return nil
 		}
 	}
 	return fmt.Errorf("record not found")
 }
 
+func (m *MockClient) ApplyChangeSet(ctx context.Context, changes ChangeSet) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if err := m.authorizeChanges(ctx, changes); err != nil {
+		return err
+	}
+	// check the removals first, so the change set is applied entirely or not at all
+	for _, record := range changes.Remove {
+		if !slices.ContainsFunc(m.GetRecords(), func(r Record) bool { return SameRecord(r, record) }) {
+			return fmt.Errorf("%w: %s does not exist", ErrInvalidChangeSet, record)
+		}
+	}
+	for _, record := range changes.Remove {
+		m.RemoveRecord(ctx, record)
+	}
+	for _, record := range changes.Add {
+		m.AddRecord(ctx, record)
+	}
+	return nil
+}
+
+func (m *MockClient) PlanChangeSet(ctx context.Context, changes ChangeSet) (Plan, error) {
+	if err := ctx.Err(); err != nil {
+		return Plan{}, err
+	}
+	if err := m.authorizeChanges(ctx, changes); err != nil {
+		return Plan{}, err
+	}
+	var operations []string
+	for _, record := range changes.Remove {
+		if !slices.ContainsFunc(m.GetRecords(), func(r Record) bool { return SameRecord(r, record) }) {
+			return Plan{}, fmt.Errorf("%w: %s does not exist", ErrInvalidChangeSet, record)
+		}
+		operations = append(operations, fmt.Sprintf("delete %s IN %s", record.Name, record.Data))
+	}
+	for _, record := range changes.Add {
+		operations = append(operations, "add "+record.String())
+	}
+	m.mutex.RLock()
+	serial := m.serial
+	m.mutex.RUnlock()
+	return m.plans.add(Plan{Zone: m.zone, Serial: serial, ChangeSet: changes, Operations: operations})
+}
+
+func (m *MockClient) ApplyPlan(ctx context.Context, token string) error {
+	plan, err := m.plans.get(token)
+	if err != nil {
+		return err
+	}
+	m.mutex.RLock()
+	serial := m.serial
+	m.mutex.RUnlock()
+	m.plans.remove(token)
+	if serial != plan.Serial {
+		return fmt.Errorf("%w: serial is %d, the plan was made at %d", ErrPlanStale, serial, plan.Serial)
+	}
+	return m.ApplyChangeSet(ctx, plan.ChangeSet)
+}
+
+func (m *MockClient) History(ctx context.Context, name string, limit int) ([]journal.Entry, error) {
+	if m.journal == nil {
+		return nil, ErrJournalDisabled
+	}
+	return m.journal.Entries(ctx, m.zone, name, limit)
+}
+
+func (m *MockClient) Rollback(ctx context.Context, id string) error {
+	if m.journal == nil {
+		return ErrJournalDisabled
+	}
+	if err := m.Authorize(ctx, m.zone, ""); err != nil {
+		return err
+	}
+	entry, err := m.journal.Get(ctx, id)
+	if err != nil {
+		return err
+	}
+	sets, err := rollbackSets(entry, m.recordSet)
+	if err != nil {
+		return err
+	}
+	m.mutex.Lock()
+	for _, set := range sets {
+		m.cache = slices.DeleteFunc(m.cache, func(r Record) bool {
+			return inRecordSet(r, set.name, set.recordType)
+		})
+		m.cache = append(m.cache, set.members...)
+	}
+	m.serial++
+	m.mutex.Unlock()
+	appendJournal(ctx, m.journal, m.zone, journal.Entry{Action: journal.ActionRollback, RollbackOf: entry.ID}, sets)
+	return nil
+}
+
+// Authorize only checks the role of ctx, the mock has no guards.
+func (m *MockClient) Authorize(ctx context.Context, name, recordType string) error {
+	return authorizeRole(ctx, name, recordType, nil)
+}
+
+func (m *MockClient) authorizeChanges(ctx context.Context, changes ChangeSet) error {
+	for _, record := range append(slices.Clone(changes.Remove), changes.Add...) {
+		if err := m.Authorize(ctx, record.Name, record.Data.RecordType()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *MockClient) setJournal(j journal.Journal) {
+	m.journal = j
+}
+
+func (m *MockClient) recordSet(name, recordType string) []Record {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	var set []Record
+	for _, r := range m.cache {
+		if inRecordSet(r, name, recordType) {
+			set = append(set, r)
+		}
+	}
+	return set
+}
+
+// recordChange captures the record set before a change and returns a function that records the
+// change in the journal once it was made.
+func (m *MockClient) recordChange(ctx context.Context, action, name, recordType string) func() {
+	before := m.recordSet(name, recordType)
+	return func() {
+		after := m.recordSet(name, recordType)
+		if sameRecordSet(before, after) {
+			return
+		}
+		appendJournal(ctx, m.journal, m.zone, journal.Entry{Action: action}, []recordSetChange{{name, recordType, before, after}})
+	}
+}
+
+func (m *MockClient) ExportZone(w io.Writer) error {
+	return WriteZoneFile(w, m.zone, nil, m.GetRecords())
+}
+
+func (m *MockClient) DiffZone(desired []Record) ZoneDiff {
+	return ZoneDiff{ChangeSet: DiffRecords(m.GetRecords(), desired)}
+}
+
+func (m *MockClient) RequestSync() {
+	m.events.publish()
+}
+
+func (m *MockClient) Subscribe() (<-chan struct{}, func()) {
+	return m.events.subscribe()
+}
+
 func (m *MockClient) Close() {
 	return
 }
@@ -103,10 +330,19 @@ func (m *MockClient) HealthCheck() HealthState {
 	m.mutex.RLock()
 	defer m.mutex.RUnlock()
 
+	// the NS set of the mock zone is always in sync
+	var ns []NameserverHealth
+	for _, server := range nameservers(m.zone, m.cache) {
+		ns = append(ns, NameserverHealth{Name: server.name, Reachable: true, Authoritative: true, Serial: m.serial})
+	}
 	return HealthState{
 		ServerReachable: true,
+		Servers:         []ServerHealth{{Addr: "127.0.0.1:53", Role: ServerRolePrimary, Transport: TransportUDP, Reachable: true, Serial: m.serial}},
+		Nameservers:     ns,
+		Serial:          m.serial,
 		LastChecked:     time.Now(),
 		LastSynced:      time.Now(),
+		SyncMode:        SyncModeUnchanged,
 		SyncError:       nil,
 		CheckError:      nil,
 	}
@@ -0,0 +1,99 @@
+package dnsservice
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/netip"
+	"slices"
+	"strings"
+)
+
+// ErrHostNotFound is returned by UpdateAddresses for names without an A or AAAA record set.
+var ErrHostNotFound = errors.New("host has no address records")
+
+// dynamicAddressTTL is the TTL of address record sets created by UpdateAddresses.
+const dynamicAddressTTL = 300
+
+// UpdateAddresses points the address record sets of a name at the given addresses, as dynamic
+// DNS clients do. Only the record sets of the address families given are replaced, keeping their
+// TTL. The name must already have an A or AAAA record set, so dynamic updates can't create new
+// hosts. It reports whether a record set changed.
+func UpdateAddresses(ctx context.Context, s Service, name string, addrs []netip.Addr) (bool, error) {
+	wanted := map[string][]string{}
+	for _, addr := range addrs {
+		addr = addr.Unmap()
+		recordType := "AAAA"
+		if addr.Is4() {
+			recordType = "A"
+		}
+		if !slices.Contains(wanted[recordType], addr.String()) {
+			wanted[recordType] = append(wanted[recordType], addr.String())
+		}
+	}
+
+	current := map[string]RecordSet{}
+	for _, set := range GroupRecordSets(s.GetRecords()) {
+		if (set.Type == "A" || set.Type == "AAAA") && strings.EqualFold(set.Name, name) {
+			current[set.Type] = set
+		}
+	}
+	if len(current) == 0 {
+		return false, fmt.Errorf("%w: %s", ErrHostNotFound, name)
+	}
+
+	// both families go into one change set, so the update is applied entirely or not at all
+	var changes ChangeSet
+	for _, recordType := range []string{"A", "AAAA"} {
+		values, ok := wanted[recordType]
+		if !ok {
+			continue
+		}
+		set, exists := current[recordType]
+		ttl := uint(dynamicAddressTTL)
+		if exists {
+			ttl = set.TTL
+		}
+		currentValues := addressValues(set)
+		for _, record := range set.Records {
+			if !slices.Contains(values, normalizeAddress(record.Data.Value())) {
+				changes.Remove = append(changes.Remove, record)
+			}
+		}
+		for _, value := range values {
+			if slices.Contains(currentValues, value) {
+				continue
+			}
+			var data RecordData = &ARecord{IP: value}
+			if recordType == "AAAA" {
+				data = &AAAARecord{IPv6: value}
+			}
+			changes.Add = append(changes.Add, NewRecord(name, ttl, data))
+		}
+	}
+	if changes.IsEmpty() {
+		return false, nil
+	}
+	if err := s.ApplyChangeSet(ctx, changes); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// addressValues returns the normalized, sorted addresses of an address record set.
+func addressValues(set RecordSet) []string {
+	values := make([]string, 0, len(set.Records))
+	for _, record := range set.Records {
+		values = append(values, normalizeAddress(record.Data.Value()))
+	}
+	slices.Sort(values)
+	return values
+}
+
+// normalizeAddress returns the address in the form netip formats it, so values compare equal.
+func normalizeAddress(value string) string {
+	if addr, err := netip.ParseAddr(value); err == nil {
+		return addr.Unmap().String()
+	}
+	return value
+}
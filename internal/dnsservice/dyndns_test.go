@@ -0,0 +1,78 @@
+package dnsservice
+
+import (
+	"context"
+	"errors"
+	"net/netip"
+	"testing"
+)
+
+func TestUpdateAddresses(t *testing.T) {
+	m := NewMockClientForZone("example.com.")
+	ctx := context.Background()
+	addr := netip.MustParseAddr("198.51.100.7")
+
+	changed, err := UpdateAddresses(ctx, m, "foo.example.com.", []netip.Addr{addr})
+	if err != nil || !changed {
+		t.Fatalf("UpdateAddresses() = %v, %v; want a change", changed, err)
+	}
+	var a, aaaa []Record
+	for _, record := range m.GetRecords() {
+		if record.Name != "foo.example.com." {
+			continue
+		}
+		if record.Data.RecordType() == "A" {
+			a = append(a, record)
+		} else {
+			aaaa = append(aaaa, record)
+		}
+	}
+	if len(a) != 1 || a[0].Data.Value() != "198.51.100.7" || a[0].TTL != 100 {
+		t.Errorf("expected the A record set to be replaced keeping its TTL, got %v", a)
+	}
+	if len(aaaa) != 1 || aaaa[0].Data.Value() != "::1" {
+		t.Errorf("expected the AAAA record set to be kept, got %v", aaaa)
+	}
+
+	changed, err = UpdateAddresses(ctx, m, "FOO.example.com.", []netip.Addr{netip.MustParseAddr("::ffff:198.51.100.7")})
+	if err != nil || changed {
+		t.Errorf("UpdateAddresses() = %v, %v; want no change for the same address", changed, err)
+	}
+
+	if _, err := UpdateAddresses(ctx, m, "new.example.com.", []netip.Addr{addr}); !errors.Is(err, ErrHostNotFound) {
+		t.Errorf("expected ErrHostNotFound for a name without address records, got %v", err)
+	}
+}
+
+// changeSetCounter counts the change sets applied to a service.
+type changeSetCounter struct {
+	Service
+	applied int
+}
+
+func (s *changeSetCounter) ApplyChangeSet(ctx context.Context, changes ChangeSet) error {
+	s.applied++
+	return s.Service.ApplyChangeSet(ctx, changes)
+}
+
+func TestUpdateAddressesAppliesOneChangeSet(t *testing.T) {
+	s := &changeSetCounter{Service: NewMockClientForZone("example.com.")}
+	addrs := []netip.Addr{netip.MustParseAddr("198.51.100.7"), netip.MustParseAddr("2001:db8::7")}
+
+	changed, err := UpdateAddresses(context.Background(), s, "foo.example.com.", addrs)
+	if err != nil || !changed {
+		t.Fatalf("UpdateAddresses() = %v, %v; want a change", changed, err)
+	}
+	if s.applied != 1 {
+		t.Errorf("expected both families in a single change set, got %d change sets", s.applied)
+	}
+	values := map[string]string{}
+	for _, record := range s.GetRecords() {
+		if record.Name == "foo.example.com." {
+			values[record.Data.RecordType()] += record.Data.Value()
+		}
+	}
+	if values["A"] != "198.51.100.7" || values["AAAA"] != "2001:db8::7" {
+		t.Errorf("unexpected address records %v", values)
+	}
+}
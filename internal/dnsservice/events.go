@@ -0,0 +1,43 @@
+package dnsservice
+
+import "sync"
+
+// broadcaster fans out change notifications to any number of subscribers. Notifications are
+// coalesced: a subscriber that has not consumed the previous notification does not get another one.
+type broadcaster struct {
+	mutex       sync.Mutex
+	subscribers map[chan struct{}]struct{}
+}
+
+func (b *broadcaster) subscribe() (<-chan struct{}, func()) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if b.subscribers == nil {
+		b.subscribers = make(map[chan struct{}]struct{})
+	}
+	ch := make(chan struct{}, 1)
+	b.subscribers[ch] = struct{}{}
+
+	var once sync.Once
+	cancel := func() {
+		once.Do(func() {
+			b.mutex.Lock()
+			defer b.mutex.Unlock()
+			delete(b.subscribers, ch)
+		})
+	}
+	return ch, cancel
+}
+
+func (b *broadcaster) publish() {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	for ch := range b.subscribers {
+		select {
+		case ch <- struct{}{}:
+		default:
+		}
+	}
+}
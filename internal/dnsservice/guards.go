@@ -1,86 +1,168 @@
 package dnsservice
 
 import (
+	"errors"
+	"fmt"
 	"log/slog"
 	"regexp"
 	"strings"
 )
 
-const guardPattern = `^(?i)(\*|A|AAAA|SOA|NS|CNAME|DNAME|CAA|MX)/(([a-zA-Z0-9-]+\.)*[a-zA-Z0-9-]+|@)$`
+// guardPatternFormat is completed with the alternation of all registered record types. Names may
+// contain the glob wildcards * and ?.
+const guardPatternFormat = `^(?i)(\*|%s)/(([a-zA-Z0-9_*?-]+\.)*[a-zA-Z0-9_*?-]+|@)$`
 
-var (
-	guardRegex     = regexp.MustCompile(guardPattern)
-	SupportedTypes = []string{"SOA", "NS", "MX", "CNAME", "DNAME", "CAA", "A", "AAAA", "TXT"}
+// guardOnlyTypes are record types DNSify does not manage that guards may still name, so guards
+// written for them keep protecting the records, e.g. "SOA/@".
+var guardOnlyTypes = []string{"SOA", "DNAME"}
+
+const (
+	guardAllowPrefix = "allow:"
+	guardDenyPrefix  = "deny:"
+	guardRegexPrefix = "regex:"
 )
 
+func guardRegex() *regexp.Regexp {
+	recordTypes.RLock()
+	defer recordTypes.RUnlock()
+	return recordTypes.guardRegex
+}
+
+// RecordGuards lists the guards of a zone as configured. A guard is "TYPE/name", where TYPE is a
+// record type or * for all types, and name is relative to the zone, @ for the apex. Names may be
+// globs, where * matches any characters including dots and ? a single character of a label, e.g.
+// "*/*.infra" or "TXT/_acme-challenge*", which also matches the apex challenge. A name of the form
+// "regex:expr" is a regular expression matched against the relative name, "regex:^db[0-9]+$"
+// alone guards all types.
+//
+// Guards are evaluated in order and the first matching guard decides. Guards deny by default, which
+// the prefix "deny:" states explicitly, while a guard prefixed with "allow:" exempts the records it
+// matches from the guards that follow, e.g. ["allow:A/web.infra", "*/*.infra"]. Prefixes are case
+// insensitive.
 type RecordGuards struct {
 	Immutable     []string `mapstructure:"immutable"`
 	AdminEditable []string `mapstructure:"admin_only"`
 }
 
+// RecordGuard is a parsed guard. Guards of a single name match by FQDN, glob and regex guards
+// by their compiled pattern.
 type RecordGuard struct {
 	Type string
+	// FQDN is the guarded name, it is empty for glob and regex guards.
 	FQDN string
+	// Pattern is the glob or "regex:" expression of the guard as configured.
+	Pattern string
+	// Allow exempts the matching records from the guards that follow.
+	Allow bool
+
+	pattern *regexp.Regexp
+	zone    string
 }
 
+// GuardList is an ordered list of guards.
+type GuardList []RecordGuard
+
+// GuardMap holds the guard lists of a zone.
 type GuardMap struct {
-	Immutable map[RecordGuard]bool
-	AdminOnly map[RecordGuard]bool
+	Immutable GuardList
+	AdminOnly GuardList
 }
 
 func NewRecordGuard(t, fqdn string) RecordGuard {
 	return RecordGuard{Type: t, FQDN: fqdn}
 }
 
-func parseGuards(guardList RecordGuards, zone string) GuardMap {
-	var guardMap GuardMap
-
-	guardMap.Immutable = make(map[RecordGuard]bool)
-	guardMap.AdminOnly = make(map[RecordGuard]bool)
-
-	for _, guardStr := range guardList.Immutable {
-		guardStr = strings.TrimSpace(guardStr)
-		guard, ok := parseGuardString(guardStr, zone)
-		if !ok {
-			slog.Debug("Guard is invalid", "guard", guardStr, "pattern", guardPattern)
-			continue
+// ParseGuards parses the configured guards of the zone. Invalid guards are skipped and reported in
+// the returned error.
+func ParseGuards(guardList RecordGuards, zone string) (GuardMap, error) {
+	var errs []error
+	parseList := func(guardStrs []string) GuardList {
+		list := make(GuardList, 0, len(guardStrs))
+		for _, guardStr := range guardStrs {
+			guardStr = strings.TrimSpace(guardStr)
+			guard, err := parseGuardString(guardStr, zone)
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			list = append(list, guard)
 		}
-		guardMap.Immutable[guard] = true
+		return list
 	}
+	guardMap := GuardMap{
+		Immutable: parseList(guardList.Immutable),
+		AdminOnly: parseList(guardList.AdminEditable),
+	}
+	return guardMap, errors.Join(errs...)
+}
 
-	for _, guardStr := range guardList.AdminEditable {
-		guardStr = strings.TrimSpace(guardStr)
-		guard, ok := parseGuardString(guardStr, zone)
-		if !ok {
-			slog.Debug("Guard is invalid", "guard", guardStr, "pattern", guardPattern)
-			continue
-		}
-		guardMap.AdminOnly[guard] = true
-
+func parseGuards(guardList RecordGuards, zone string) GuardMap {
+	guardMap, err := ParseGuards(guardList, zone)
+	if err != nil {
+		slog.Warn("Ignoring invalid guards", "zone", zone, "error", err.Error())
 	}
 	return guardMap
 }
 
-func parseGuardString(guardStr, zone string) (RecordGuard, bool) {
-	if !isValidGuard(guardStr) {
-		return RecordGuard{}, false
+func parseGuardString(guardStr, zone string) (RecordGuard, error) {
+	var guard RecordGuard
+	guard.zone = zone
+	rule, allow := cutGuardPrefix(guardStr, guardAllowPrefix)
+	if !allow {
+		rule, _ = cutGuardPrefix(rule, guardDenyPrefix)
 	}
+	guard.Allow = allow
 
-	parts := strings.SplitN(guardStr, "/", 2)
+	recordType, name := "*", rule
+	if _, ok := cutGuardPrefix(rule, guardRegexPrefix); !ok {
+		recordType, name = splitGuard(rule)
+	}
+	if expr, ok := cutGuardPrefix(name, guardRegexPrefix); ok {
+		if !isValidGuard(recordType + "/@") {
+			return RecordGuard{}, fmt.Errorf("invalid guard %q: unknown record type %q", guardStr, recordType)
+		}
+		re, err := regexp.Compile("(?i)" + expr)
+		if err != nil {
+			return RecordGuard{}, fmt.Errorf("invalid guard %q: %w", guardStr, err)
+		}
+		guard.Type = strings.ToUpper(recordType)
+		guard.Pattern = guardRegexPrefix + expr
+		guard.pattern = re
+		return guard, nil
+	}
 
-	if len(parts) != 2 {
-		return RecordGuard{}, false
+	if !isValidGuard(rule) {
+		return RecordGuard{}, fmt.Errorf("invalid guard %q, want TYPE/name with a record type or *, a glob or a regex: name", guardStr)
 	}
+	guard.Type = strings.ToUpper(recordType)
+	if !strings.ContainsAny(name, "*?") {
+		guard.FQDN = toFQDN(name, zone)
+		return guard, nil
+	}
+	guard.Pattern = name
+	guard.pattern = globRegex(toFQDN(name, zone))
+	return guard, nil
+}
 
-	recordType := parts[0]
-	fqdn := toFQDN(parts[1], zone)
-	recordType = strings.ToUpper(recordType)
+// cutGuardPrefix returns s without the prefix and whether s had it, ignoring case.
+func cutGuardPrefix(s, prefix string) (string, bool) {
+	if len(s) >= len(prefix) && strings.EqualFold(s[:len(prefix)], prefix) {
+		return s[len(prefix):], true
+	}
+	return s, false
+}
 
-	return RecordGuard{Type: recordType, FQDN: fqdn}, true
+// globRegex compiles a glob of a domain name, in which * matches any characters and ? a single
+// character of a label, into a case-insensitive regular expression matching the whole name.
+func globRegex(glob string) *regexp.Regexp {
+	expr := regexp.QuoteMeta(glob)
+	expr = strings.ReplaceAll(expr, `\*`, `.*`)
+	expr = strings.ReplaceAll(expr, `\?`, `[^.]`)
+	return regexp.MustCompile("(?i)^" + expr + "$")
 }
 
 func isValidGuard(guardStr string) bool {
-	return guardRegex.MatchString(guardStr)
+	return guardRegex().MatchString(guardStr)
 }
 
 func splitGuard(guard string) (recordType, subdomain string) {
@@ -90,3 +172,56 @@ func splitGuard(guard string) (recordType, subdomain string) {
 	}
 	return parts[0], parts[1]
 }
+
+// String returns the guard in the configuration syntax.
+func (g RecordGuard) String() string {
+	name := g.Pattern
+	if name == "" {
+		name = extractSubdomain(g.FQDN, g.zone)
+		if strings.EqualFold(g.FQDN, g.zone) {
+			name = "@"
+		}
+	}
+	if g.Allow {
+		return guardAllowPrefix + g.Type + "/" + name
+	}
+	return g.Type + "/" + name
+}
+
+// Matches reports whether the guard applies to the record set of the FQDN and type.
+func (g RecordGuard) Matches(recordType, fqdn string) bool {
+	if g.Type != "*" && !strings.EqualFold(g.Type, recordType) {
+		return false
+	}
+	switch {
+	case g.pattern == nil:
+		return strings.EqualFold(g.FQDN, fqdn)
+	case strings.HasPrefix(g.Pattern, guardRegexPrefix):
+		if !strings.EqualFold(fqdn, g.zone) && !strings.HasSuffix(strings.ToLower(fqdn), "."+strings.ToLower(g.zone)) {
+			return false
+		}
+		name := "@"
+		if !strings.EqualFold(fqdn, g.zone) {
+			name = fqdn[:len(fqdn)-len(g.zone)-1]
+		}
+		return g.pattern.MatchString(name)
+	default:
+		return g.pattern.MatchString(fqdn)
+	}
+}
+
+// Match returns the first guard of the list that matches the record set, along with its index.
+func (list GuardList) Match(recordType, fqdn string) (RecordGuard, int, bool) {
+	for i, guard := range list {
+		if guard.Matches(recordType, fqdn) {
+			return guard, i, true
+		}
+	}
+	return RecordGuard{}, -1, false
+}
+
+// Guarded reports whether the first guard of the list that matches the record set denies it.
+func (list GuardList) Guarded(recordType, fqdn string) bool {
+	guard, _, ok := list.Match(recordType, fqdn)
+	return ok && !guard.Allow
+}
@@ -12,9 +12,17 @@ func TestIsValidGuard(t *testing.T) {
 		{"A/ns1", true},
 		{"NS/@", true},
 		{"*/ns1", true},
+		{"SRV/_sip._tcp", true},
+		{"txt/_acme-challenge", true},
 		{"InvalidType/ns1", false},
-		{"A/*", false},
+		// types of the original guard syntax that DNSify does not manage
+		{"SOA/@", true},
+		{"dname/legacy", true},
+		{"A/*", true},
+		{"*/*.infra", true},
+		{"TXT/_acme-challenge.*", true},
 		{"A/..", false},
+		{"A/db/1", false},
 	}
 
 	for _, test := range tests {
@@ -27,24 +35,35 @@ func TestIsValidGuard(t *testing.T) {
 
 func TestParseGuardString(t *testing.T) {
 	tests := []struct {
-		input  string
-		zone   string
-		expect RecordGuard
-		valid  bool
+		input   string
+		zone    string
+		expect  RecordGuard
+		wantErr bool
 	}{
-		{"A/ns1", "example.com.", NewRecordGuard("A", "ns1.example.com."), true},
-		{"NS/@", "example.com.", NewRecordGuard("NS", "example.com."), true},
-		{"*/ns1", "example.com.", NewRecordGuard("*", "ns1.example.com."), true},
-		{"InvalidType/ns1", "example.com.", RecordGuard{}, false},
-		{"A/*", "example.com.", RecordGuard{}, false},
+		{"A/ns1", "example.com.", NewRecordGuard("A", "ns1.example.com."), false},
+		{"NS/@", "example.com.", NewRecordGuard("NS", "example.com."), false},
+		{"*/ns1", "example.com.", NewRecordGuard("*", "ns1.example.com."), false},
+		{"srv/_sip._tcp", "example.com.", NewRecordGuard("SRV", "_sip._tcp.example.com."), false},
+		{"deny:A/ns1", "example.com.", NewRecordGuard("A", "ns1.example.com."), false},
+		{"allow:A/ns1", "example.com.", RecordGuard{Type: "A", FQDN: "ns1.example.com.", Allow: true}, false},
+		{"Allow:A/ns1", "example.com.", RecordGuard{Type: "A", FQDN: "ns1.example.com.", Allow: true}, false},
+		{"DENY:A/ns1", "example.com.", NewRecordGuard("A", "ns1.example.com."), false},
+		{"*/*.infra", "example.com.", RecordGuard{Type: "*", Pattern: "*.infra"}, false},
+		{"regex:^db[0-9]+$", "example.com.", RecordGuard{Type: "*", Pattern: "regex:^db[0-9]+$"}, false},
+		{"A/regex:^db[0-9]+$", "example.com.", RecordGuard{Type: "A", Pattern: "regex:^db[0-9]+$"}, false},
+		{"A/Regex:^db[0-9]+$", "example.com.", RecordGuard{Type: "A", Pattern: "regex:^db[0-9]+$"}, false},
+		{"allow:REGEX:^db[0-9]+$", "example.com.", RecordGuard{Type: "*", Pattern: "regex:^db[0-9]+$", Allow: true}, false},
+		{"InvalidType/ns1", "example.com.", RecordGuard{}, true},
+		{"A/regex:^db[", "example.com.", RecordGuard{}, true},
+		{"Invalid/regex:^db", "example.com.", RecordGuard{}, true},
 	}
 
 	for _, test := range tests {
-		got, valid := parseGuardString(test.input, test.zone)
-		if valid != test.valid {
-			t.Errorf("parseGuardString(%q, %q) valid = %v; want %v", test.input, test.zone, valid, test.valid)
+		got, err := parseGuardString(test.input, test.zone)
+		if (err != nil) != test.wantErr {
+			t.Errorf("parseGuardString(%q, %q) error = %v; wantErr %v", test.input, test.zone, err, test.wantErr)
 		}
-		if got != test.expect {
+		if got.Type != test.expect.Type || got.FQDN != test.expect.FQDN || got.Pattern != test.expect.Pattern || got.Allow != test.expect.Allow {
 			t.Errorf("parseGuardString(%q, %q) = %v; want %v", test.input, test.zone, got, test.expect)
 		}
 	}
@@ -52,35 +71,52 @@ func TestParseGuardString(t *testing.T) {
 
 func TestParseGuards(t *testing.T) {
 	guards := RecordGuards{
-		Immutable:     []string{"A/ns1", "NS/@"},
+		Immutable:     []string{"A/ns1", "NS/@", "bogus"},
 		AdminEditable: []string{"*/ns1"},
 	}
-	expectedImmutable := map[RecordGuard]bool{
-		NewRecordGuard("A", "ns1.example.com."): true,
-		NewRecordGuard("NS", "example.com."):    true,
-	}
-	expectedAdminOnly := map[RecordGuard]bool{
-		NewRecordGuard("*", "ns1.example.com."): true,
+	guardMap, err := ParseGuards(guards, "example.com.")
+	if err == nil {
+		t.Error("expected an error for the invalid guard")
 	}
-
-	guardMap := parseGuards(guards, "example.com.")
-
-	if !mapsAreEqual(guardMap.Immutable, expectedImmutable) {
-		t.Errorf("Immutable guards = %v; want %v", guardMap.Immutable, expectedImmutable)
+	if len(guardMap.Immutable) != 2 || len(guardMap.AdminOnly) != 1 {
+		t.Fatalf("unexpected guards %v", guardMap)
 	}
-	if !mapsAreEqual(guardMap.AdminOnly, expectedAdminOnly) {
-		t.Errorf("Admin only guards = %v; want %v", guardMap.AdminOnly, expectedAdminOnly)
+	if got := guardMap.Immutable[1].String(); got != "NS/@" {
+		t.Errorf("String() = %q, want NS/@", got)
 	}
 }
 
-func mapsAreEqual(a, b map[RecordGuard]bool) bool {
-	if len(a) != len(b) {
-		return false
+func TestGuardListGuarded(t *testing.T) {
+	guardMap := parseGuards(RecordGuards{Immutable: []string{
+		"allow:A/web.infra",
+		"*/*.infra",
+		"TXT/_acme-challenge*",
+		"regex:^db[0-9]+$",
+		"MX/@",
+	}}, "example.com.")
+
+	tests := []struct {
+		recordType string
+		fqdn       string
+		want       bool
+	}{
+		{"A", "web.infra.example.com.", false},
+		{"AAAA", "web.infra.example.com.", true},
+		{"A", "a.b.infra.example.com.", true},
+		{"A", "infra.example.com.", false},
+		{"TXT", "_acme-challenge.www.example.com.", true},
+		{"TXT", "_ACME-challenge.WWW.example.com.", true},
+		{"TXT", "_acme-challenge.example.com.", true},
+		{"A", "_acme-challenge.www.example.com.", false},
+		{"CNAME", "db12.example.com.", true},
+		{"CNAME", "db12.other.example.com.", false},
+		{"A", "db12.example.org.", false},
+		{"MX", "example.com.", true},
+		{"MX", "www.example.com.", false},
 	}
-	for key := range a {
-		if _, found := b[key]; !found {
-			return false
+	for _, test := range tests {
+		if got := guardMap.Immutable.Guarded(test.recordType, test.fqdn); got != test.want {
+			t.Errorf("Guarded(%s, %s) = %v; want %v", test.recordType, test.fqdn, got, test.want)
 		}
 	}
-	return true
 }
@@ -0,0 +1,183 @@
+package dnsservice
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+
+	"github.com/miekg/dns"
+	"github.com/theadell/dnsify/internal/journal"
+)
+
+// ErrJournalDisabled is returned by History and Rollback if no journal is configured.
+var ErrJournalDisabled = errors.New("change journal is not configured")
+
+// ErrJournalIncomplete is returned by Rollback if the journal entry misses records of a changed
+// record set, so reverting it would not restore the record set.
+var ErrJournalIncomplete = errors.New("journal entry is incomplete")
+
+// journaled is implemented by services that record their changes in a journal.
+type journaled interface {
+	setJournal(journal.Journal)
+}
+
+func (c *Client) setJournal(j journal.Journal) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.journal = j
+}
+
+func (c *Client) getJournal() journal.Journal {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	return c.journal
+}
+
+// History returns up to limit changes of the zone, newest first. If name is not empty, only the
+// changes of its record sets are returned.
+func (c *Client) History(ctx context.Context, name string, limit int) ([]journal.Entry, error) {
+	j := c.getJournal()
+	if j == nil {
+		return nil, ErrJournalDisabled
+	}
+	return j.Entries(ctx, c.zone, name, limit)
+}
+
+// Rollback reverts the record sets changed by the journal entry to their state before the
+// change, with a single UPDATE message. It fails with ErrRecordConflict if any of the record sets
+// changed again since, so later changes are never overwritten.
+func (c *Client) Rollback(ctx context.Context, id string) error {
+	entry, err := c.rollbackEntry(ctx, id)
+	if err != nil {
+		return err
+	}
+	sets, err := rollbackSets(entry, c.cachedRecordSet)
+	if err != nil {
+		return err
+	}
+	for _, set := range sets {
+		if c.isImmutableSet(set.name, set.recordType) {
+			return fmt.Errorf("%w: %s %s", ErrImmutableRecord, set.recordType, set.name)
+		}
+	}
+	if err := c.applyRecordSetChanges(ctx, sets, journal.Entry{Action: journal.ActionRollback, RollbackOf: entry.ID}); err != nil {
+		return err
+	}
+	slog.Info("Change rolled back successfully", "entry", entry.ID, "record_sets", len(sets))
+	return nil
+}
+
+func (c *Client) rollbackEntry(ctx context.Context, id string) (journal.Entry, error) {
+	j := c.getJournal()
+	if j == nil {
+		return journal.Entry{}, ErrJournalDisabled
+	}
+	entry, err := j.Get(ctx, id)
+	if err != nil {
+		return journal.Entry{}, err
+	}
+	if normalizeZone(entry.Zone) != normalizeZone(c.zone) {
+		return journal.Entry{}, journal.ErrEntryNotFound
+	}
+	return entry, nil
+}
+
+// rollbackSets returns the record set changes that restore the state before the entry. cached
+// returns the current records of a record set, which must match the state after the entry.
+func rollbackSets(entry journal.Entry, cached func(name, recordType string) []Record) ([]recordSetChange, error) {
+	sets := make([]recordSetChange, 0, len(entry.Changes))
+	for _, change := range entry.Changes {
+		if change.Incomplete {
+			return nil, fmt.Errorf("%w: %s %s", ErrJournalIncomplete, change.Type, change.Name)
+		}
+		after, err := parseJournalRecords(change.After)
+		if err != nil {
+			return nil, err
+		}
+		before, err := parseJournalRecords(change.Before)
+		if err != nil {
+			return nil, err
+		}
+		current := cached(change.Name, change.Type)
+		if !sameRecordSet(current, after) {
+			return nil, fmt.Errorf("%w: %s %s changed since", ErrRecordConflict, change.Type, change.Name)
+		}
+		sets = append(sets, recordSetChange{name: change.Name, recordType: change.Type, current: current, members: before})
+	}
+	return sets, nil
+}
+
+// sameRecordSet reports whether both sets consist of the same records with the same TTLs.
+func sameRecordSet(a, b []Record) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for _, record := range a {
+		if !slices.ContainsFunc(b, func(r Record) bool { return SameRecord(r, record) && r.TTL == record.TTL }) {
+			return false
+		}
+	}
+	return true
+}
+
+func parseJournalRecords(rrs []string) ([]Record, error) {
+	records := make([]Record, 0, len(rrs))
+	for _, s := range rrs {
+		rr, err := dns.NewRR(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid journal record %q: %w", s, err)
+		}
+		record, ok := recordFromRR(rr)
+		if !ok {
+			return nil, fmt.Errorf("unsupported journal record %q", s)
+		}
+		records = append(records, record)
+	}
+	return records, nil
+}
+
+// appendJournal records the changed record sets in the journal, attributed to the actor of ctx.
+// The changes were already applied, so failures are only logged.
+func appendJournal(ctx context.Context, j journal.Journal, zone string, entry journal.Entry, sets []recordSetChange) {
+	if j == nil || len(sets) == 0 {
+		return
+	}
+	actor := journal.ActorFromContext(ctx)
+	entry.Zone = zone
+	entry.Actor = actor.Name
+	entry.SourceIP = actor.SourceIP
+	for _, set := range sets {
+		change := journal.RecordSetChange{Name: set.name, Type: set.recordType}
+		var beforeErr, afterErr error
+		change.Before, beforeErr = journalRecords(set.current)
+		change.After, afterErr = journalRecords(set.members)
+		if err := errors.Join(beforeErr, afterErr); err != nil {
+			// the change is still recorded, but can't be rolled back
+			slog.Error("Failed to record the records of a change", "zone", zone, "name", set.name, "type", set.recordType, "error", err.Error())
+			change.Incomplete = true
+		}
+		entry.Changes = append(entry.Changes, change)
+	}
+	// the change is recorded even if the request was canceled in the meantime
+	if _, err := j.Append(context.WithoutCancel(ctx), entry); err != nil {
+		slog.Error("Failed to record change in the journal", "zone", zone, "action", entry.Action, "error", err.Error())
+	}
+}
+
+// journalRecords returns the records in presentation format. Records that can't be converted
+// are left out and reported in the error.
+func journalRecords(records []Record) ([]string, error) {
+	rrs := make([]string, 0, len(records))
+	var errs []error
+	for _, record := range records {
+		rr, err := toRR(record)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s %s %s: %w", record.Name, record.Data.RecordType(), record.Data.Value(), err))
+			continue
+		}
+		rrs = append(rrs, rr.String())
+	}
+	return rrs, errors.Join(errs...)
+}
@@ -0,0 +1,83 @@
+package dnsservice
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/miekg/dns"
+	"github.com/theadell/dnsify/internal/journal"
+)
+
+func TestRollback(t *testing.T) {
+	current := NewRecord("www.example.com.", 300, &ARecord{IP: "192.0.2.1"})
+	c, updates := newUpdateTestClient(t, current)
+	j, err := journal.NewFileJournal(filepath.Join(t.TempDir(), "journal.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.setJournal(j)
+	ctx := journal.WithActor(context.Background(), journal.Actor{Name: "admin@example.com", SourceIP: "192.0.2.100"})
+
+	if err := c.AddRecord(ctx, NewRecord("www.example.com.", 600, &ARecord{IP: "192.0.2.2"})); err != nil {
+		t.Fatalf("AddRecord() error = %v", err)
+	}
+	<-updates
+	entries, err := c.History(ctx, "www.example.com.", 0)
+	if err != nil || len(entries) != 1 {
+		t.Fatalf("History() = %v, %v; want a single entry", entries, err)
+	}
+	entry := entries[0]
+	if entry.Actor != "admin@example.com" || entry.SourceIP != "192.0.2.100" || entry.Action != journal.ActionAdd {
+		t.Errorf("expected the add to be attributed to the actor, got %+v", entry)
+	}
+	if change := entry.Changes[0]; len(change.Before) != 1 || len(change.After) != 2 {
+		t.Errorf("expected the record set before and after the change, got %+v", change)
+	}
+
+	if err := c.Rollback(ctx, entry.ID); err != nil {
+		t.Fatalf("Rollback() error = %v", err)
+	}
+	msg := <-updates
+	if len(msg.Ns) != 2 || msg.Ns[1].(*dns.A).A.String() != "192.0.2.1" || msg.Ns[1].Header().Ttl != 300 {
+		t.Errorf("expected the record set to be restored, got %v", msg.Ns)
+	}
+	if records := c.GetRecords(); len(records) != 1 || records[0].TTL != 300 {
+		t.Errorf("expected the original record in the cache, got %v", records)
+	}
+	entries, _ = c.History(ctx, "", 0)
+	if len(entries) != 2 || entries[0].RollbackOf != entry.ID {
+		t.Errorf("expected the rollback to be recorded, got %+v", entries)
+	}
+
+	// the record set no longer matches the state after the change
+	if err := c.Rollback(ctx, entry.ID); !errors.Is(err, ErrRecordConflict) {
+		t.Errorf("Rollback() error = %v, want %v", err, ErrRecordConflict)
+	}
+}
+
+func TestRollbackIncompleteEntry(t *testing.T) {
+	j, err := journal.NewFileJournal(filepath.Join(t.TempDir(), "journal.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	valid := NewRecord("www.example.com.", 300, &ARecord{IP: "192.0.2.1"})
+	invalid := NewRecord("www.example.com.", 300, &ARecord{IP: "not an address"})
+	appendJournal(ctx, j, "example.com.", journal.Entry{Action: journal.ActionAdd}, []recordSetChange{
+		{name: "www.example.com.", recordType: "A", current: []Record{valid}, members: []Record{valid, invalid}},
+	})
+	entries, err := j.Entries(ctx, "example.com.", "", 0)
+	if err != nil || len(entries) != 1 {
+		t.Fatalf("Entries() = %v, %v; want a single entry", entries, err)
+	}
+	if change := entries[0].Changes[0]; !change.Incomplete || len(change.After) != 1 {
+		t.Errorf("expected the change to be recorded as incomplete, got %+v", change)
+	}
+
+	cached := func(name, recordType string) []Record { return []Record{valid} }
+	if _, err := rollbackSets(entries[0], cached); !errors.Is(err, ErrJournalIncomplete) {
+		t.Errorf("rollbackSets() error = %v, want %v", err, ErrJournalIncomplete)
+	}
+}
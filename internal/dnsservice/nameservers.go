@@ -0,0 +1,216 @@
+package dnsservice
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// ErrNameserversInconsistent is reported by the health check if a nameserver of the zone's NS set
+// does not answer authoritatively or serves an older serial than the primary server, e.g. because
+// zone transfers to it are stuck.
+var ErrNameserversInconsistent = errors.New("nameservers are inconsistent")
+
+// nameserverPort is the port the nameservers of the NS set are queried on.
+const nameserverPort = "53"
+
+var (
+	// nameserverTimeout bounds the name resolution and each SOA query of a nameserver of the NS
+	// set, so a single slow nameserver can't stall the health check.
+	nameserverTimeout = 5 * time.Second
+	// lookupHost resolves the nameservers without glue records.
+	lookupHost = net.DefaultResolver.LookupHost
+)
+
+// NameserverHealth is the result of querying a nameserver of the zone's NS set for the SOA record.
+type NameserverHealth struct {
+	// Name is the host name of the NS record.
+	Name string
+	// Addr is the queried address with port. It is empty if the name could not be resolved.
+	Addr      string
+	Reachable bool
+	// Authoritative reports whether the server answered with the AA bit set. A server that doesn't
+	// is a lame delegation and serves the zone from a cache, if at all.
+	Authoritative bool
+	// Serial is the SOA serial of the zone on the server.
+	Serial uint32
+	// Behind reports whether the serial is older than the serial of the primary server.
+	Behind bool
+	Error  error
+}
+
+// Consistent reports whether the nameserver answered authoritatively with an up to date serial.
+func (h NameserverHealth) Consistent() bool {
+	return h.Reachable && h.Authoritative && !h.Behind
+}
+
+// InconsistentNameservers returns the number of nameservers of the NS set that are not consistent.
+func (h HealthState) InconsistentNameservers() int {
+	n := 0
+	for _, ns := range h.Nameservers {
+		if !ns.Consistent() {
+			n++
+		}
+	}
+	return n
+}
+
+// problem describes why the nameserver is not consistent.
+func (h NameserverHealth) problem() string {
+	name := h.Name
+	if h.Addr != "" {
+		name = fmt.Sprintf("%s (%s)", h.Name, h.Addr)
+	}
+	switch {
+	case h.Error != nil:
+		return fmt.Sprintf("%s: %v", name, h.Error)
+	case !h.Authoritative:
+		return fmt.Sprintf("%s: not authoritative", name)
+	default:
+		return fmt.Sprintf("%s: serial %d is behind", name, h.Serial)
+	}
+}
+
+// nameserver is a host of the zone's NS set with its addresses.
+type nameserver struct {
+	name  string
+	addrs []string
+}
+
+// nameservers returns the NS set of the zone apex in the records, with the addresses of glue
+// records for nameservers inside the zone.
+func nameservers(zone string, records []Record) []nameserver {
+	var result []nameserver
+	for _, record := range records {
+		ns, ok := record.Data.(*NSRecord)
+		if !ok || !strings.EqualFold(record.Name, zone) {
+			continue
+		}
+		server := nameserver{name: dns.Fqdn(ns.NameServer)}
+		for _, glue := range records {
+			if !strings.EqualFold(glue.Name, server.name) {
+				continue
+			}
+			switch data := glue.Data.(type) {
+			case *ARecord:
+				server.addrs = append(server.addrs, net.JoinHostPort(data.IP, nameserverPort))
+			case *AAAARecord:
+				server.addrs = append(server.addrs, net.JoinHostPort(data.IPv6, nameserverPort))
+			}
+		}
+		result = append(result, server)
+	}
+	return result
+}
+
+// probeNameservers resolves the nameservers of the cached NS set without glue records and queries
+// each of their addresses for the SOA record of the zone. The nameservers are probed in parallel,
+// each lookup and query is bounded by nameserverTimeout.
+func (c *Client) probeNameservers(ctx context.Context) []NameserverHealth {
+	c.mutex.RLock()
+	servers := nameservers(c.zone, c.cache)
+	c.mutex.RUnlock()
+
+	results := make([][]NameserverHealth, len(servers))
+	var wg sync.WaitGroup
+	for i, server := range servers {
+		wg.Add(1)
+		go func(i int, server nameserver) {
+			defer wg.Done()
+			results[i] = c.probeNameserver(ctx, server)
+		}(i, server)
+	}
+	wg.Wait()
+
+	var health []NameserverHealth
+	for _, result := range results {
+		health = append(health, result...)
+	}
+	return health
+}
+
+// probeNameserver resolves the nameserver if it has no glue records and queries each of its
+// addresses in parallel.
+func (c *Client) probeNameserver(ctx context.Context, server nameserver) []NameserverHealth {
+	if len(server.addrs) == 0 {
+		lookupCtx, cancel := context.WithTimeout(ctx, nameserverTimeout)
+		hosts, err := lookupHost(lookupCtx, strings.TrimSuffix(server.name, "."))
+		cancel()
+		if err != nil {
+			return []NameserverHealth{{Name: server.name, Error: err}}
+		}
+		for _, host := range hosts {
+			server.addrs = append(server.addrs, net.JoinHostPort(host, nameserverPort))
+		}
+	}
+
+	health := make([]NameserverHealth, len(server.addrs))
+	var wg sync.WaitGroup
+	for i, addr := range server.addrs {
+		health[i] = NameserverHealth{Name: server.name, Addr: addr}
+		wg.Add(1)
+		go func(state *NameserverHealth) {
+			defer wg.Done()
+			c.queryNameserver(ctx, state)
+		}(&health[i])
+	}
+	wg.Wait()
+	return health
+}
+
+// queryNameserver queries the SOA record of the zone on a nameserver of the NS set. Unlike the
+// configured servers, the nameservers don't know the TSIG keys of the zone, so the query is not
+// signed.
+func (c *Client) queryNameserver(ctx context.Context, state *NameserverHealth) {
+	m := new(dns.Msg)
+	m.SetQuestion(c.zone, dns.TypeSOA)
+	m.RecursionDesired = false
+	client := &dns.Client{Net: TransportUDP, Timeout: nameserverTimeout}
+	r, err := exchangeContext(ctx, client, m, state.Addr)
+	if err == nil && r.Truncated {
+		client.Net = TransportTCP
+		r, err = exchangeContext(ctx, client, m, state.Addr)
+	}
+	if err != nil {
+		state.Error = err
+		return
+	}
+	state.Reachable = true
+	state.Authoritative = r.Authoritative
+	if r.Rcode != dns.RcodeSuccess {
+		state.Authoritative = false
+		state.Error = fmt.Errorf("SOA query failed: %s", dns.RcodeToString[r.Rcode])
+		return
+	}
+	for _, rr := range r.Answer {
+		if soa, ok := rr.(*dns.SOA); ok {
+			state.Serial = soa.Serial
+			return
+		}
+	}
+	state.Authoritative = false
+	state.Error = errSerialNotAnswered
+}
+
+// checkNameservers flags the nameservers whose serial is behind the serial of the primary server
+// and returns ErrNameserversInconsistent with the problems of all inconsistent nameservers.
+func checkNameservers(nameservers []NameserverHealth, serial uint32) error {
+	var problems []string
+	for i := range nameservers {
+		ns := &nameservers[i]
+		ns.Behind = ns.Reachable && ns.Authoritative && isBehind(ns.Serial, serial)
+		if !ns.Consistent() {
+			problems = append(problems, ns.problem())
+		}
+	}
+	if len(problems) == 0 {
+		return nil
+	}
+	return fmt.Errorf("%w: %s", ErrNameserversInconsistent, strings.Join(problems, ", "))
+}
@@ -0,0 +1,110 @@
+package dnsservice
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// newNameserver starts a local server that answers SOA queries for example.com. with the serial,
+// authoritatively if authoritative is set, and with the rcode.
+func newNameserver(t *testing.T, serial uint32, authoritative bool, rcode int) string {
+	t.Helper()
+	return startTestServer(t, dns.HandlerFunc(func(w dns.ResponseWriter, r *dns.Msg) {
+		m := soaReply(r, serial)
+		m.Authoritative = authoritative
+		if rcode != dns.RcodeSuccess {
+			m.Rcode = rcode
+			m.Answer = nil
+		}
+		w.WriteMsg(m)
+	}))
+}
+
+func TestNameservers(t *testing.T) {
+	records := []Record{
+		NewRecord("example.com.", 3600, &NSRecord{NameServer: "ns1.example.com."}),
+		NewRecord("example.com.", 3600, &NSRecord{NameServer: "ns.example.net."}),
+		NewRecord("ns1.example.com.", 3600, &ARecord{IP: "192.0.2.53"}),
+		NewRecord("ns1.example.com.", 3600, &AAAARecord{IPv6: "2001:db8::53"}),
+		NewRecord("sub.example.com.", 3600, &NSRecord{NameServer: "ns.sub.example.com."}),
+	}
+	got := nameservers("example.com.", records)
+	if len(got) != 2 {
+		t.Fatalf("expected the NS set of the apex, got %+v", got)
+	}
+	if got[0].name != "ns1.example.com." || len(got[0].addrs) != 2 || got[0].addrs[0] != "192.0.2.53:53" || got[0].addrs[1] != "[2001:db8::53]:53" {
+		t.Errorf("expected the glue addresses of ns1, got %+v", got[0])
+	}
+	if got[1].name != "ns.example.net." || len(got[1].addrs) != 0 {
+		t.Errorf("expected no addresses for a nameserver outside the zone, got %+v", got[1])
+	}
+}
+
+func TestCheckNameservers(t *testing.T) {
+	const serial = 2024010102
+	c := &Client{client: new(dns.Client), zone: "example.com."}
+	health := []NameserverHealth{
+		{Name: "ns1.example.com.", Addr: newNameserver(t, serial, true, dns.RcodeSuccess)},
+		{Name: "ns2.example.com.", Addr: newNameserver(t, serial-1, true, dns.RcodeSuccess)},
+		{Name: "ns3.example.com.", Addr: newNameserver(t, serial, false, dns.RcodeSuccess)},
+		{Name: "ns4.example.com.", Addr: newNameserver(t, serial, false, dns.RcodeRefused)},
+	}
+	for i := range health {
+		c.queryNameserver(context.Background(), &health[i])
+	}
+
+	err := checkNameservers(health, serial)
+	if !errors.Is(err, ErrNameserversInconsistent) {
+		t.Fatalf("expected inconsistent nameservers, got %v", err)
+	}
+	if !health[0].Consistent() || health[0].Serial != serial {
+		t.Errorf("expected ns1 to be consistent, got %+v", health[0])
+	}
+	if !health[1].Behind || health[1].Consistent() {
+		t.Errorf("expected ns2 to be behind, got %+v", health[1])
+	}
+	if health[2].Authoritative || !health[2].Reachable {
+		t.Errorf("expected ns3 to answer without authority, got %+v", health[2])
+	}
+	if health[3].Authoritative || health[3].Error == nil {
+		t.Errorf("expected ns4 to refuse the query, got %+v", health[3])
+	}
+	if n := (HealthState{Nameservers: health}).InconsistentNameservers(); n != 3 {
+		t.Errorf("InconsistentNameservers() = %d, want 3", n)
+	}
+
+	if err := checkNameservers(health[:1], serial); err != nil {
+		t.Errorf("expected a consistent NS set, got %v", err)
+	}
+}
+
+func TestProbeNameserversBoundsLookups(t *testing.T) {
+	timeout, lookup := nameserverTimeout, lookupHost
+	t.Cleanup(func() { nameserverTimeout, lookupHost = timeout, lookup })
+	nameserverTimeout = 50 * time.Millisecond
+	// a resolver that never answers
+	lookupHost = func(ctx context.Context, host string) ([]string, error) {
+		if _, ok := ctx.Deadline(); !ok {
+			t.Errorf("expected the lookup of %s to have a deadline", host)
+		}
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+
+	c := &Client{client: new(dns.Client), zone: "example.com.", cache: []Record{
+		NewRecord("example.com.", 3600, &NSRecord{NameServer: "ns1.example.net."}),
+		NewRecord("example.com.", 3600, &NSRecord{NameServer: "ns2.example.net."}),
+	}}
+	start := time.Now()
+	health := c.probeNameservers(context.Background())
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("expected the lookups to be aborted after the timeout, took %v", elapsed)
+	}
+	if len(health) != 2 || !errors.Is(health[0].Error, context.DeadlineExceeded) || health[1].Name != "ns2.example.net." {
+		t.Errorf("expected both nameservers to time out, got %+v", health)
+	}
+}
@@ -0,0 +1,212 @@
+package dnsservice
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// tsigCredentialer is implemented by services that authenticate with TSIG keys, which
+// NOTIFY messages for their zone may be signed with.
+type tsigCredentialer interface {
+	tsigCredentials() []TSIGKey
+}
+
+func (c *Client) tsigCredentials() []TSIGKey {
+	return c.keys
+}
+
+// NotifyListener accepts DNS NOTIFY messages (RFC 1996) over UDP and TCP and requests an
+// immediate synchronization of the notified zone. Messages are only accepted for zones of the
+// registry, from whitelisted primaries and, if required, signed with the TSIG key of the zone.
+type NotifyListener struct {
+	registry    *Registry
+	allowed     []*net.IPNet
+	requireTSIG bool
+	tsigKeys    map[string][]string // zone -> TSIG key names
+	servers     []*dns.Server
+	wg          sync.WaitGroup
+}
+
+// NewNotifyListener creates a listener for the zones of the registry. It does not listen
+// until Start is called.
+func NewNotifyListener(config NotifyConfig, registry *Registry) (*NotifyListener, error) {
+	if len(config.AllowedPrimaries) == 0 {
+		return nil, errors.New("notify: at least one allowed primary must be configured")
+	}
+	allowed, err := parseAllowedPrimaries(config.AllowedPrimaries)
+	if err != nil {
+		return nil, err
+	}
+
+	l := &NotifyListener{
+		registry:    registry,
+		allowed:     allowed,
+		requireTSIG: config.RequireTSIG,
+		tsigKeys:    make(map[string][]string),
+	}
+
+	secrets := make(map[string]string)
+	for _, service := range registry.Services() {
+		credentialer, ok := service.(tsigCredentialer)
+		if !ok {
+			continue
+		}
+		zone := normalizeZone(service.GetZone())
+		for _, key := range credentialer.tsigCredentials() {
+			// the server verifies NOTIFY messages with one secret per key name
+			if secret, ok := secrets[key.Name]; ok && secret != key.Secret {
+				return nil, fmt.Errorf("notify: the TSIG key %s of the zone %s has a different secret in another zone", key.Name, zone)
+			}
+			secrets[key.Name] = key.Secret
+			l.tsigKeys[zone] = append(l.tsigKeys[zone], key.Name)
+		}
+	}
+
+	udpConn, err := net.ListenPacket("udp", config.Listen)
+	if err != nil {
+		return nil, fmt.Errorf("notify: %w", err)
+	}
+	// listen on the same port for TCP, which matters if the configured port is 0
+	tcpListener, err := net.Listen("tcp", udpConn.LocalAddr().String())
+	if err != nil {
+		udpConn.Close()
+		return nil, fmt.Errorf("notify: %w", err)
+	}
+	l.servers = []*dns.Server{
+		{PacketConn: udpConn, Handler: l, TsigSecret: secrets},
+		{Listener: tcpListener, Handler: l, TsigSecret: secrets},
+	}
+	return l, nil
+}
+
+// Start serves NOTIFY messages in the background until Close is called.
+func (l *NotifyListener) Start() {
+	for _, server := range l.servers {
+		l.wg.Add(1)
+		go func(server *dns.Server) {
+			defer l.wg.Done()
+			if err := server.ActivateAndServe(); err != nil {
+				slog.Error("NOTIFY listener stopped", "error", err.Error())
+			}
+		}(server)
+	}
+	slog.Info("Listening for DNS NOTIFY messages", "addr", l.Addr())
+}
+
+// Addr returns the address the listener accepts messages on.
+func (l *NotifyListener) Addr() string {
+	return l.servers[0].PacketConn.LocalAddr().String()
+}
+
+// Close stops the listener.
+func (l *NotifyListener) Close() {
+	for _, server := range l.servers {
+		if err := server.Shutdown(); err != nil {
+			slog.Error("Failed to stop NOTIFY listener", "error", err.Error())
+		}
+	}
+	l.wg.Wait()
+}
+
+func (l *NotifyListener) ServeDNS(w dns.ResponseWriter, r *dns.Msg) {
+	m := new(dns.Msg)
+	m.SetReply(r)
+	m.Authoritative = true
+
+	rcode := l.handleNotify(w, r)
+	m.Rcode = rcode
+	if tsig := r.IsTsig(); tsig != nil && w.TsigStatus() == nil && rcode != dns.RcodeNotAuth {
+		m.SetTsig(tsig.Hdr.Name, tsig.Algorithm, 300, time.Now().Unix())
+	}
+	if err := w.WriteMsg(m); err != nil {
+		slog.Error("Failed to answer NOTIFY message", "error", err.Error())
+	}
+}
+
+func (l *NotifyListener) handleNotify(w dns.ResponseWriter, r *dns.Msg) int {
+	source := w.RemoteAddr().String()
+	if r.Opcode != dns.OpcodeNotify {
+		return dns.RcodeNotImplemented
+	}
+	if len(r.Question) != 1 || r.Question[0].Qtype != dns.TypeSOA {
+		return dns.RcodeFormatError
+	}
+	zone := r.Question[0].Name
+
+	if !l.isAllowed(w.RemoteAddr()) {
+		slog.Warn("Rejected NOTIFY from a primary that is not allowed", "zone", zone, "source", source)
+		return dns.RcodeRefused
+	}
+
+	service, err := l.registry.Get(zone)
+	if err != nil {
+		slog.Warn("Rejected NOTIFY for an unmanaged zone", "zone", zone, "source", source)
+		return dns.RcodeNotAuth
+	}
+
+	if tsig := r.IsTsig(); tsig != nil {
+		if err := w.TsigStatus(); err != nil || !slices.Contains(l.tsigKeys[normalizeZone(zone)], strings.ToLower(tsig.Hdr.Name)) {
+			slog.Warn("Rejected NOTIFY with an invalid TSIG signature", "zone", zone, "source", source, "key", tsig.Hdr.Name)
+			return dns.RcodeNotAuth
+		}
+	} else if l.requireTSIG {
+		slog.Warn("Rejected unsigned NOTIFY", "zone", zone, "source", source)
+		return dns.RcodeRefused
+	}
+
+	slog.Info("Received NOTIFY", "zone", zone, "source", source)
+	service.RequestSync()
+	return dns.RcodeSuccess
+}
+
+func (l *NotifyListener) isAllowed(addr net.Addr) bool {
+	var ip net.IP
+	switch a := addr.(type) {
+	case *net.UDPAddr:
+		ip = a.IP
+	case *net.TCPAddr:
+		ip = a.IP
+	default:
+		return false
+	}
+	for _, network := range l.allowed {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+func parseAllowedPrimaries(primaries []string) ([]*net.IPNet, error) {
+	networks := make([]*net.IPNet, 0, len(primaries))
+	for _, primary := range primaries {
+		primary = strings.TrimSpace(primary)
+		if strings.Contains(primary, "/") {
+			_, network, err := net.ParseCIDR(primary)
+			if err != nil {
+				return nil, fmt.Errorf("notify: invalid allowed primary %q: %w", primary, err)
+			}
+			networks = append(networks, network)
+			continue
+		}
+		ip := net.ParseIP(primary)
+		if ip == nil {
+			return nil, fmt.Errorf("notify: invalid allowed primary %q", primary)
+		}
+		bits := 8 * net.IPv6len
+		if ip.To4() != nil {
+			ip = ip.To4()
+			bits = 8 * net.IPv4len
+		}
+		networks = append(networks, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+	}
+	return networks, nil
+}
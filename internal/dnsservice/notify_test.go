@@ -0,0 +1,103 @@
+package dnsservice
+
+import (
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+func TestNotifyListener(t *testing.T) {
+	mock := NewMockClientForZone("example.com.")
+	registry, err := NewRegistry(mock)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []struct {
+		name      string
+		config    NotifyConfig
+		zone      string
+		wantRcode int
+		wantSync  bool
+	}{
+		{"Allowed primary", NotifyConfig{AllowedPrimaries: []string{"127.0.0.1"}}, "example.com.", dns.RcodeSuccess, true},
+		{"Allowed network", NotifyConfig{AllowedPrimaries: []string{"127.0.0.0/8"}}, "example.com.", dns.RcodeSuccess, true},
+		{"Unknown primary", NotifyConfig{AllowedPrimaries: []string{"192.0.2.1"}}, "example.com.", dns.RcodeRefused, false},
+		{"Unmanaged zone", NotifyConfig{AllowedPrimaries: []string{"127.0.0.1"}}, "example.org.", dns.RcodeNotAuth, false},
+		{"Unsigned with TSIG required", NotifyConfig{AllowedPrimaries: []string{"127.0.0.1"}, RequireTSIG: true}, "example.com.", dns.RcodeRefused, false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.config.Listen = "127.0.0.1:0"
+			listener, err := NewNotifyListener(tc.config, registry)
+			if err != nil {
+				t.Fatalf("NewNotifyListener() error = %v", err)
+			}
+			listener.Start()
+			defer listener.Close()
+
+			updates, cancel := mock.Subscribe()
+			defer cancel()
+
+			m := new(dns.Msg)
+			m.SetNotify(tc.zone)
+			reply, _, err := new(dns.Client).Exchange(m, listener.Addr())
+			if err != nil {
+				t.Fatalf("Exchange() error = %v", err)
+			}
+			if reply.Rcode != tc.wantRcode {
+				t.Errorf("rcode = %s; want %s", dns.RcodeToString[reply.Rcode], dns.RcodeToString[tc.wantRcode])
+			}
+
+			select {
+			case <-updates:
+				if !tc.wantSync {
+					t.Error("unexpected synchronization")
+				}
+			case <-time.After(100 * time.Millisecond):
+				if tc.wantSync {
+					t.Error("expected a synchronization to be requested")
+				}
+			}
+		})
+	}
+}
+
+func TestNewNotifyListenerRequiresPrimaries(t *testing.T) {
+	registry, _ := NewRegistry(NewMockClient())
+	if _, err := NewNotifyListener(NotifyConfig{Listen: "127.0.0.1:0"}, registry); err == nil {
+		t.Error("NewNotifyListener() without allowed primaries should fail")
+	}
+	if _, err := NewNotifyListener(NotifyConfig{Listen: "127.0.0.1:0", AllowedPrimaries: []string{"not-an-ip"}}, registry); err == nil {
+		t.Error("NewNotifyListener() with an invalid primary should fail")
+	}
+}
+
+func TestNewNotifyListenerRejectsConflictingTSIGKeys(t *testing.T) {
+	newZone := func(zone, secret string) *Client {
+		return &Client{client: new(dns.Client), zone: zone, keys: []TSIGKey{{Name: "transfer.", Secret: secret, Algorithm: dns.HmacSHA256}}}
+	}
+	config := NotifyConfig{Listen: "127.0.0.1:0", AllowedPrimaries: []string{"127.0.0.1"}}
+
+	registry, err := NewRegistry(newZone("example.com.", "c2VjcmV0"), newZone("example.org.", "c2VjcmV0"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	listener, err := NewNotifyListener(config, registry)
+	if err != nil {
+		t.Fatalf("NewNotifyListener() with a key shared by the zones error = %v", err)
+	}
+	// the listener was never started, so only its sockets need to be closed
+	listener.servers[0].PacketConn.Close()
+	listener.servers[1].Listener.Close()
+
+	registry, err = NewRegistry(newZone("example.com.", "c2VjcmV0"), newZone("example.org.", "b3RoZXI="))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewNotifyListener(config, registry); err == nil {
+		t.Error("NewNotifyListener() with different secrets for a key name should fail")
+	}
+}
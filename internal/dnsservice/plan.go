@@ -0,0 +1,218 @@
+package dnsservice
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/theadell/dnsify/internal/journal"
+)
+
+var (
+	// ErrPlanNotFound is returned if a plan token is unknown, expired or was already applied.
+	ErrPlanNotFound = errors.New("plan not found")
+	// ErrPlanStale is returned if the zone changed on the server since the plan was made.
+	ErrPlanStale = errors.New("zone changed since the plan was made")
+)
+
+// planTTL is how long a plan can be applied after it was made.
+const planTTL = 15 * time.Minute
+
+// Plan is a change set that was checked against the guards and the zone without applying it.
+// It describes the UPDATE message applying it would send and can be applied with its token as
+// long as the SOA serial of the zone does not change.
+type Plan struct {
+	Token     string
+	Zone      string
+	Serial    uint32
+	ChangeSet ChangeSet
+	// Operations lists the prerequisites and updates of the UPDATE message, one per line.
+	Operations []string
+	CreatedAt  time.Time
+	ExpiresAt  time.Time
+
+	soa      *dns.SOA
+	msg      *dns.Msg // nil if there is nothing to update
+	sets     []recordSetChange
+	subjects []string
+}
+
+// String returns a human readable diff of the plan. The TTL of removed records is omitted since
+// it does not identify a record.
+func (p Plan) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Plan %s for %s at serial %d\n", p.Token, p.Zone, p.Serial)
+	for _, record := range p.ChangeSet.Remove {
+		fmt.Fprintf(&b, "- %s IN %s\n", record.Name, record.Data)
+	}
+	for _, record := range p.ChangeSet.Add {
+		fmt.Fprintf(&b, "+ %s\n", record)
+	}
+	if p.ChangeSet.IsEmpty() {
+		b.WriteString("No changes\n")
+	}
+	return b.String()
+}
+
+// planStore keeps plans until they are applied or expire.
+type planStore struct {
+	mutex sync.Mutex
+	plans map[string]Plan
+}
+
+// add assigns a token to the plan and stores it.
+func (s *planStore) add(plan Plan) (Plan, error) {
+	token := make([]byte, 16)
+	if _, err := rand.Read(token); err != nil {
+		return Plan{}, fmt.Errorf("failed to generate plan token: %w", err)
+	}
+	plan.Token = hex.EncodeToString(token)
+	plan.CreatedAt = time.Now()
+	plan.ExpiresAt = plan.CreatedAt.Add(planTTL)
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.plans == nil {
+		s.plans = make(map[string]Plan)
+	}
+	for t, p := range s.plans {
+		if plan.CreatedAt.After(p.ExpiresAt) {
+			delete(s.plans, t)
+		}
+	}
+	s.plans[plan.Token] = plan
+	return plan, nil
+}
+
+func (s *planStore) get(token string) (Plan, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	plan, ok := s.plans[token]
+	if !ok || time.Now().After(plan.ExpiresAt) {
+		return Plan{}, ErrPlanNotFound
+	}
+	return plan, nil
+}
+
+func (s *planStore) remove(token string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	delete(s.plans, token)
+}
+
+// PlanChangeSet validates the change set like ApplyChangeSet does and computes the UPDATE
+// message that applies it, without sending it. The plan is bound to the current SOA serial of
+// the zone on the server.
+func (c *Client) PlanChangeSet(ctx context.Context, changes ChangeSet) (Plan, error) {
+	sets, err := c.planChangeSet(changes)
+	if err != nil {
+		return Plan{}, err
+	}
+	if err := c.authorizeSets(ctx, sets); err != nil {
+		return Plan{}, err
+	}
+	soa, err := c.querySOA(ctx)
+	if err != nil {
+		return Plan{}, fmt.Errorf("failed to query SOA serial: %w", err)
+	}
+	msg, subjects, err := newRecordSetUpdate(c.zone, sets)
+	if err != nil {
+		return Plan{}, err
+	}
+
+	plan, err := c.plans.add(Plan{
+		Zone:       c.zone,
+		Serial:     soa.Serial,
+		ChangeSet:  changes,
+		Operations: describeUpdate(msg),
+		soa:        soa,
+		msg:        msg,
+		sets:       sets,
+		subjects:   subjects,
+	})
+	if err != nil {
+		return Plan{}, err
+	}
+	slog.Info("Change set planned", "token", plan.Token, "serial", plan.Serial, "add", len(changes.Add), "remove", len(changes.Remove))
+	return plan, nil
+}
+
+// ApplyPlan applies a plan made by PlanChangeSet. It fails with ErrPlanStale if the SOA serial
+// of the zone changed since the plan was made. The UPDATE message additionally requires the SOA
+// record to be unchanged, so a change between the check and the update is detected as well.
+func (c *Client) ApplyPlan(ctx context.Context, token string) error {
+	plan, err := c.plans.get(token)
+	if err != nil {
+		return err
+	}
+	soa, err := c.querySOA(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to query SOA serial: %w", err)
+	}
+	if soa.Serial != plan.Serial {
+		c.plans.remove(token)
+		return fmt.Errorf("%w: serial is %d, the plan was made at %d", ErrPlanStale, soa.Serial, plan.Serial)
+	}
+	if plan.msg == nil {
+		c.plans.remove(token)
+		return nil
+	}
+
+	msg := plan.msg.Copy()
+	msg.Used([]dns.RR{dns.Copy(plan.soa)})
+	entry := journal.Entry{Action: journal.ActionChangeSet}
+	if err := c.sendRecordSetUpdate(ctx, msg, plan.sets, append(plan.subjects, "SOA "+c.zone), entry); err != nil {
+		if errors.Is(err, ErrRecordConflict) {
+			c.plans.remove(token)
+			return fmt.Errorf("%w: %w", ErrPlanStale, err)
+		}
+		return err
+	}
+	c.plans.remove(token)
+	slog.Info("Plan applied successfully", "token", token, "serial", plan.Serial)
+	return nil
+}
+
+// describeUpdate returns the prerequisites and updates of an UPDATE message in a readable form.
+func describeUpdate(msg *dns.Msg) []string {
+	if msg == nil {
+		return nil
+	}
+	var operations []string
+	for _, rr := range msg.Answer {
+		h := rr.Header()
+		switch h.Class {
+		case dns.ClassNONE:
+			operations = append(operations, fmt.Sprintf("require no %s records for %s", dns.TypeToString[h.Rrtype], h.Name))
+		case dns.ClassANY:
+			operations = append(operations, fmt.Sprintf("require %s records for %s", dns.TypeToString[h.Rrtype], h.Name))
+		default:
+			operations = append(operations, "require "+rrWithoutTTL(rr))
+		}
+	}
+	for _, rr := range msg.Ns {
+		h := rr.Header()
+		switch h.Class {
+		case dns.ClassANY:
+			operations = append(operations, fmt.Sprintf("delete %s records of %s", dns.TypeToString[h.Rrtype], h.Name))
+		case dns.ClassNONE:
+			operations = append(operations, "delete "+rrWithoutTTL(rr))
+		default:
+			operations = append(operations, "add "+rr.String())
+		}
+	}
+	return operations
+}
+
+// rrWithoutTTL returns the presentation format of a record whose TTL is irrelevant.
+func rrWithoutTTL(rr dns.RR) string {
+	h := rr.Header()
+	return strings.Join([]string{h.Name, dns.TypeToString[h.Rrtype], strings.TrimPrefix(rr.String(), h.String())}, " ")
+}
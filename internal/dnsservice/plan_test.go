@@ -0,0 +1,82 @@
+package dnsservice
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+func TestApplyPlan(t *testing.T) {
+	var serial atomic.Uint32
+	serial.Store(2024010101)
+	current := NewRecord("www.example.com.", 300, &ARecord{IP: "192.0.2.1"})
+	c, updates := newSerialTestClient(t, &serial, current)
+	ctx := context.Background()
+	changes := ChangeSet{
+		Remove: []Record{current},
+		Add:    []Record{NewRecord("www.example.com.", 300, &ARecord{IP: "192.0.2.2"})},
+	}
+
+	plan, err := c.PlanChangeSet(ctx, changes)
+	if err != nil {
+		t.Fatalf("PlanChangeSet() error = %v", err)
+	}
+	if plan.Token == "" || plan.Serial != 2024010101 {
+		t.Errorf("expected a token and the serial of the server, got %q at %d", plan.Token, plan.Serial)
+	}
+	want := []string{
+		"require www.example.com. A 192.0.2.1",
+		"delete A records of www.example.com.",
+		"add www.example.com.\t300\tIN\tA\t192.0.2.2",
+	}
+	if len(plan.Operations) != len(want) {
+		t.Fatalf("Operations = %q, want %q", plan.Operations, want)
+	}
+	for i := range want {
+		if plan.Operations[i] != want[i] {
+			t.Errorf("Operations[%d] = %q, want %q", i, plan.Operations[i], want[i])
+		}
+	}
+	if len(updates) != 0 || c.GetRecords()[0].Data.Value() != "192.0.2.1" {
+		t.Fatal("planning must not change the zone")
+	}
+
+	if err := c.ApplyPlan(ctx, plan.Token); err != nil {
+		t.Fatalf("ApplyPlan() error = %v", err)
+	}
+	msg := <-updates
+	if len(msg.Answer) != 2 || msg.Answer[1].Header().Rrtype != dns.TypeSOA {
+		t.Errorf("expected the SOA record as additional prerequisite, got %v", msg.Answer)
+	}
+	if records := c.GetRecords(); len(records) != 1 || records[0].Data.Value() != "192.0.2.2" {
+		t.Errorf("expected the cache to be updated, got %v", records)
+	}
+	if err := c.ApplyPlan(ctx, plan.Token); !errors.Is(err, ErrPlanNotFound) {
+		t.Errorf("ApplyPlan() of an applied plan error = %v, want %v", err, ErrPlanNotFound)
+	}
+}
+
+func TestApplyPlanFailsIfSerialMoved(t *testing.T) {
+	var serial atomic.Uint32
+	serial.Store(7)
+	c, updates := newSerialTestClient(t, &serial)
+	ctx := context.Background()
+
+	plan, err := c.PlanChangeSet(ctx, ChangeSet{Add: []Record{NewRecord("www.example.com.", 300, &ARecord{IP: "192.0.2.1"})}})
+	if err != nil {
+		t.Fatalf("PlanChangeSet() error = %v", err)
+	}
+	serial.Store(8)
+	if err := c.ApplyPlan(ctx, plan.Token); !errors.Is(err, ErrPlanStale) {
+		t.Errorf("ApplyPlan() error = %v, want %v", err, ErrPlanStale)
+	}
+	if len(updates) != 0 {
+		t.Error("a stale plan must not be sent")
+	}
+	if err := c.ApplyPlan(ctx, "unknown"); !errors.Is(err, ErrPlanNotFound) {
+		t.Errorf("ApplyPlan() of an unknown token error = %v, want %v", err, ErrPlanNotFound)
+	}
+}
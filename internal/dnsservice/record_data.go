@@ -1,6 +1,9 @@
 package dnsservice
 
-import "fmt"
+import (
+	"fmt"
+	"strings"
+)
 
 // RecordData represents the data associated with a DNS resource record.
 // It provides methods to access the type, value, and the string representation of the record as per RFC 1035
@@ -26,7 +29,7 @@ type RecordData interface {
 
 // ARecord represents a DNS A record which maps a domain name to an IPv4 address.
 type ARecord struct {
-	IP string
+	IP string `json:"ip"`
 }
 
 func (a *ARecord) RecordType() string {
@@ -41,7 +44,7 @@ func (a *ARecord) Value() string {
 
 // AAAARecord represents a DNS AAAA record which maps a domain name to an IPv6 address.
 type AAAARecord struct {
-	IPv6 string
+	IPv6 string `json:"ipv6"`
 }
 
 func (aaaa *AAAARecord) RecordType() string {
@@ -56,7 +59,7 @@ func (aaaa *AAAARecord) String() string {
 
 // CNAMERecord represents a DNS CNAME record, specifying that a domain name is an alias for another domain.
 type CNAMERecord struct {
-	Alias string
+	Alias string `json:"alias"`
 }
 
 func (cname *CNAMERecord) RecordType() string {
@@ -73,8 +76,8 @@ func (cname *CNAMERecord) String() string {
 
 // MXRecord represents a DNS MX record, specifying a mail server for a domain and its priority.
 type MXRecord struct {
-	Priority   uint16
-	MailServer string
+	Priority   uint16 `json:"priority"`
+	MailServer string `json:"mailServer"`
 }
 
 func (mx *MXRecord) RecordType() string {
@@ -92,7 +95,28 @@ func (mx *MXRecord) String() string {
 // TXTRecord represents a DNS TXT record, containing text information associated with a domain.
 // It often includes data for various verification purposes, such as SPF data or other metadata.
 type TXTRecord struct {
-	Text string
+	Text string `json:"text"`
+	// Strings are the character strings of the record as served by the DNS server, Text is their
+	// concatenation. Records with long text like DKIM keys consist of several strings. Text is split
+	// into strings of at most 255 bytes if Strings is empty or does not match it.
+	Strings []string `json:"strings,omitempty"`
+}
+
+// maxCharacterString is the maximum length of a character string of a TXT record (RFC 1035).
+const maxCharacterString = 255
+
+// characterStrings returns the character strings the record consists of.
+func (txt *TXTRecord) characterStrings() []string {
+	if len(txt.Strings) > 0 && strings.Join(txt.Strings, "") == txt.Text {
+		return txt.Strings
+	}
+	var chunks []string
+	text := txt.Text
+	for len(text) > maxCharacterString {
+		chunks = append(chunks, text[:maxCharacterString])
+		text = text[maxCharacterString:]
+	}
+	return append(chunks, text)
 }
 
 func (txt *TXTRecord) RecordType() string {
@@ -104,12 +128,12 @@ func (txt *TXTRecord) Value() string {
 }
 
 func (txt *TXTRecord) String() string {
-	return fmt.Sprintf("TXT \"%s\"", txt.Text)
+	return "TXT \"" + strings.Join(txt.characterStrings(), "\" \"") + "\""
 }
 
 // NSRecord represents a DNS NS record, identifying the authoritative name servers for the domain.
 type NSRecord struct {
-	NameServer string
+	NameServer string `json:"nameServer"`
 }
 
 func (ns *NSRecord) RecordType() string {
@@ -127,10 +151,10 @@ func (ns *NSRecord) String() string {
 // SRVRecord represents a DNS SRV record, which specifies the location of servers for specific services.
 // It includes a target domain name, port number, and priority and weight for load balancing.
 type SRVRecord struct {
-	Priority uint16
-	Weight   uint16
-	Port     uint16
-	Target   string
+	Priority uint16 `json:"priority"`
+	Weight   uint16 `json:"weight"`
+	Port     uint16 `json:"port"`
+	Target   string `json:"target"`
 }
 
 func (srv *SRVRecord) RecordType() string {
@@ -143,3 +167,24 @@ func (srv *SRVRecord) Value() string {
 func (srv *SRVRecord) String() string {
 	return fmt.Sprintf("SRV %d %d %d %s", srv.Priority, srv.Weight, srv.Port, srv.Target)
 }
+
+// CAARecord represents a DNS CAA record, which restricts the certificate authorities that may issue
+// certificates for a domain (RFC 8659). The tag is one of "issue", "issuewild" or "iodef"
+// and Content holds the property value, e.g. the domain name of the issuing CA.
+type CAARecord struct {
+	Flag    uint8  `json:"flag"`
+	Tag     string `json:"tag"`
+	Content string `json:"value"`
+}
+
+func (caa *CAARecord) RecordType() string {
+	return "CAA"
+}
+
+func (caa *CAARecord) Value() string {
+	return fmt.Sprintf("%d %s \"%s\"", caa.Flag, caa.Tag, caa.Content)
+}
+
+func (caa *CAARecord) String() string {
+	return fmt.Sprintf("CAA %d %s \"%s\"", caa.Flag, caa.Tag, caa.Content)
+}
@@ -1,15 +1,18 @@
 package dnsservice
 
 import (
+	"context"
 	"crypto/sha256"
 	"encoding/hex"
 	"fmt"
 	"log/slog"
+	"slices"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/miekg/dns"
-	"github.com/theadell/dnsify/internal/backoff"
+	"github.com/theadell/dnsify/internal/journal"
 )
 
 func (c *Client) GetRecords() []Record {
@@ -53,140 +56,357 @@ func (c *Client) GetRecordForFQDN(targetFQDN, recordType string) *Record {
 	return nil
 }
 
-func (c *Client) AddRecord(record Record) error {
+// AddRecord adds the record to the record set of its name and type, creating the set if it does
+// not exist yet. Since the records of a set share a TTL, the TTL of the record is applied to the
+// whole set. Records of types whose sets hold a single record only, such as CNAME, replace the set.
+func (c *Client) AddRecord(ctx context.Context, record Record) error {
 	slog.Debug("Attempting to add record", "record", record)
 
 	if c.isImmutable(record) {
 		slog.Warn("Attempted to modify an immutable record", "record", record.Name)
 		return ErrImmutableRecord
 	}
+	if err := authorizeRole(ctx, record.Name, record.Data.RecordType(), c.guards.AdminOnly); err != nil {
+		slog.Warn("Rejected a change the role may not make", "record", record.Name, "error", err.Error())
+		return err
+	}
 
-	retryConfig := backoff.DefaultRetryConfig
-	retryConfig.MaxRetries = 2
+	current := c.cachedRecordSet(record.Name, record.Data.RecordType())
+	members := slices.DeleteFunc(slices.Clone(current), func(r Record) bool {
+		return SameRecord(r, record)
+	})
+	if t, ok := LookupRecordType(record.Data.RecordType()); ok && t.Singleton {
+		members = nil
+	}
+	members = append(members, record)
 
-	if c.exists(record) {
-		slog.Debug("Record already exists, will attempt to override it by deleting it and then creating it again", "record", record)
-		removeRecordOp := func() error {
-			return c.RemoveRecord(record)
-		}
-		err := backoff.RetryWithBackoff(removeRecordOp, retryConfig)
-		if err != nil {
-			return ErrRecordDeletion
+	if err := c.applyRecordSetChanges(ctx, []recordSetChange{{record.Name, record.Data.RecordType(), current, members}}, journal.Entry{Action: journal.ActionAdd}); err != nil {
+		return err
+	}
+	slog.Info("Record added successfully", "record", record)
+	return nil
+}
+
+// ReplaceRecordSet replaces all records of the set with the records of the given set, which
+// all have to match its name and type and are stored with its TTL. An empty set deletes the
+// record set. Sets of singleton types, such as CNAME, may hold a single record only.
+func (c *Client) ReplaceRecordSet(ctx context.Context, set RecordSet) error {
+	slog.Debug("Attempting to replace record set", "name", set.Name, "type", set.Type)
+
+	if err := checkSingleton(set); err != nil {
+		return err
+	}
+	members := slices.Clone(set.Records)
+	for i, record := range members {
+		if !inRecordSet(record, set.Name, set.Type) {
+			return fmt.Errorf("%w: %s is not part of the %s record set of %s", ErrRecordCreation, record, set.Type, set.Name)
 		}
+		members[i].TTL = set.TTL
+	}
+	if c.isImmutableSet(set.Name, set.Type) {
+		slog.Warn("Attempted to modify an immutable record set", "name", set.Name, "type", set.Type)
+		return ErrImmutableRecord
 	}
 
-	msg := new(dns.Msg)
-	msg.SetUpdate(c.zone)
+	current := c.cachedRecordSet(set.Name, set.Type)
+	if err := c.applyRecordSetChanges(ctx, []recordSetChange{{set.Name, set.Type, current, members}}, journal.Entry{Action: journal.ActionReplace}); err != nil {
+		return err
+	}
+	slog.Info("Record set replaced successfully", "name", set.Name, "type", set.Type, "records", len(set.Records))
+	return nil
+}
 
-	resourceRecord, err := dns.NewRR(record.String())
-	if err != nil {
-		slog.Error("Failed to create new resource record", "error", err)
-		return fmt.Errorf("%w: %v", ErrRecordCreation, err)
+// checkSingleton returns an error wrapping ErrRecordCreation if the set of a singleton type holds
+// more than one record.
+func checkSingleton(set RecordSet) error {
+	if t, ok := LookupRecordType(set.Type); ok && t.Singleton && len(set.Records) > 1 {
+		return fmt.Errorf("%w: the %s record set of %s can only hold a single record", ErrRecordCreation, set.Type, set.Name)
 	}
+	return nil
+}
+
+// applyRecordSetChanges replaces the current records of every changed record set with its
+// members, using a single RFC 2136 UPDATE message whose prerequisites require each set on the
+// server to still consist of the current records, or to not exist if there are none. If the
+// server state differs, nothing is changed and an error wrapping ErrRecordConflict is returned.
+// Applied changes are recorded in the journal as the given entry.
+func (c *Client) applyRecordSetChanges(ctx context.Context, sets []recordSetChange, entry journal.Entry) error {
+	msg, subjects, err := newRecordSetUpdate(c.zone, sets)
+	if err != nil || msg == nil {
+		return err
+	}
+	return c.sendRecordSetUpdate(ctx, msg, sets, subjects, entry)
+}
+
+// newRecordSetUpdate builds the UPDATE message of applyRecordSetChanges and returns it along with
+// a description of each changed record set. The members of the sets are updated in place with the
+// shared TTL and their hashes. The message is nil if there is nothing to update.
+func newRecordSetUpdate(zone string, sets []recordSetChange) (*dns.Msg, []string, error) {
+	updates := make([]rrsetUpdate, 0, len(sets))
+	subjects := make([]string, 0, len(sets))
+	for i, set := range sets {
+		if len(set.members) > 0 {
+			// the records of a set share the TTL of the most recently added record
+			ttl := set.members[len(set.members)-1].TTL
+			set.members = slices.Clone(set.members)
+			for j := range set.members {
+				set.members[j].TTL = ttl
+				set.members[j].Hash = hashRecord(set.members[j])
+			}
+			sets[i] = set
+		}
 
-	msg.Insert([]dns.RR{resourceRecord})
-	msg.SetTsig(c.tsigKey, dns.HmacSHA256, 300, time.Now().Unix())
+		current, err := toRRs(set.current)
+		if err != nil {
+			return nil, nil, fmt.Errorf("%w: %v", ErrRecordCreation, err)
+		}
+		replacement, err := toRRs(set.members)
+		if err != nil {
+			slog.Error("Failed to create new resource record", "error", err)
+			return nil, nil, fmt.Errorf("%w: %v", ErrRecordCreation, err)
+		}
+		updates = append(updates, rrsetUpdate{current: current, replacement: replacement})
+		subjects = append(subjects, set.recordType+" "+set.name)
+	}
+	return newUpdateMsg(zone, updates), subjects, nil
+}
 
-	replyMsg, _, err := c.client.Exchange(msg, c.serverAddr)
+// sendRecordSetUpdate sends an UPDATE message built by newRecordSetUpdate and applies the changed
+// record sets to the cache and the journal once the server accepted it.
+func (c *Client) sendRecordSetUpdate(ctx context.Context, msg *dns.Msg, sets []recordSetChange, subjects []string, entry journal.Entry) error {
+	if err := c.authorizeSets(ctx, sets); err != nil {
+		return err
+	}
+	replyMsg, err := c.exchange(ctx, msg)
 	if err != nil {
 		slog.Error("Failed to exchange DNS message", "error", err)
-		return fmt.Errorf("failed to create new resource record: %w", err)
+		return fmt.Errorf("failed to update record set: %w", err)
+	}
+	if err := conflictError(replyMsg.Rcode, strings.Join(subjects, ", ")); err != nil {
+		slog.Warn("Record set changed on the server, update was rejected", "record_sets", subjects, "rcode", dns.RcodeToString[replyMsg.Rcode])
+		return err
 	}
-
 	if replyMsg.Rcode != dns.RcodeSuccess {
-		slog.Error("Failed to update record", "status_code", replyMsg.Rcode)
+		slog.Error("Failed to update record set", "status_code", replyMsg.Rcode)
 		return fmt.Errorf("%w: status code %d", ErrRecordCreation, replyMsg.Rcode)
 	}
 
 	c.mutex.Lock()
-	defer c.mutex.Unlock()
-	record.Hash = hashRecord(record)
-	c.cache = append(c.cache, record)
+	for _, set := range sets {
+		c.cache = slices.DeleteFunc(c.cache, func(r Record) bool {
+			return inRecordSet(r, set.name, set.recordType)
+		})
+		c.cache = append(c.cache, set.members...)
+	}
+	j := c.journal
+	c.mutex.Unlock()
 
-	slog.Info("Record added successfully", "record", record)
+	appendJournal(ctx, j, c.zone, entry, sets)
 	return nil
 }
 
-func (c *Client) RemoveRecord(record Record) error {
+// RemoveRecord removes a single record from its record set. The UPDATE message requires the set
+// on the server to still consist of the cached records.
+func (c *Client) RemoveRecord(ctx context.Context, record Record) error {
 	if c.isImmutable(record) {
 		slog.Warn("Attempted to delete an immutable record", "record", record.Name)
 		return ErrImmutableRecord
 	}
+	if err := authorizeRole(ctx, record.Name, record.Data.RecordType(), c.guards.AdminOnly); err != nil {
+		slog.Warn("Rejected a change the role may not make", "record", record.Name, "error", err.Error())
+		return err
+	}
 
-	resourceRecordStr := record.String()
-	resourceRecord, err := dns.NewRR(resourceRecordStr)
+	resourceRecord, err := toRR(record)
+	if err != nil {
+		return fmt.Errorf("failed to create Resource Record: %w", err)
+	}
+	cached := c.cachedRecordSet(record.Name, record.Data.RecordType())
+	current, err := toRRs(cached)
 	if err != nil {
 		return fmt.Errorf("failed to create Resource Record: %w", err)
 	}
 
 	msg := new(dns.Msg)
 	msg.SetUpdate(c.zone)
+	if len(current) > 0 {
+		msg.Used(current)
+	}
 	msg.Remove([]dns.RR{resourceRecord})
-	msg.SetTsig(c.tsigKey, dns.HmacSHA256, 300, time.Now().Unix())
 
-	replyMsg, _, err := c.client.Exchange(msg, c.serverAddr)
+	replyMsg, err := c.exchange(ctx, msg)
 	if err != nil {
 		return fmt.Errorf("failed to exchange message: %w", err)
 	}
 
+	if err := conflictError(replyMsg.Rcode, record.Data.RecordType()+" "+record.Name); err != nil {
+		return err
+	}
 	if replyMsg.Rcode != dns.RcodeSuccess {
 		return fmt.Errorf("%w: status code %d", ErrRecordDeletion, replyMsg.Rcode)
 	}
 
 	c.mutex.Lock()
-	defer c.mutex.Unlock()
-	for i, r := range c.cache {
-		if r.String() == record.String() {
-			c.cache = append(c.cache[:i], c.cache[i+1:]...)
-			break
-		}
-	}
-
+	c.cache = slices.DeleteFunc(c.cache, func(r Record) bool {
+		return SameRecord(r, record)
+	})
+	j := c.journal
+	c.mutex.Unlock()
+
+	remaining := slices.DeleteFunc(slices.Clone(cached), func(r Record) bool { return SameRecord(r, record) })
+	appendJournal(ctx, j, c.zone, journal.Entry{Action: journal.ActionRemove},
+		[]recordSetChange{{record.Name, record.Data.RecordType(), cached, remaining}})
 	slog.Info("Record removed successfully", "record", record)
 	return nil
 }
-func hashRecord(record Record) string {
-	data := record.Data.RecordType() + record.Name + record.Data.String() + strconv.FormatUint(uint64(record.TTL), 10)
-	hash := sha256.Sum256([]byte(data))
-	return hex.EncodeToString(hash[:])
+
+// exchange sends the message to the primary server with exchangeWith.
+func (c *Client) exchange(ctx context.Context, msg *dns.Msg) (*dns.Msg, error) {
+	return c.exchangeWith(ctx, msg, c.primary())
 }
 
-func (c *Client) isImmutable(record Record) bool {
-	tguard := NewRecordGuard(record.Data.RecordType(), record.Name)
-	if _, ok := c.guards.Immutable[tguard]; ok {
-		return ok
-	}
-	wildcardGuard := NewRecordGuard("*", record.Name)
-	if _, ok := c.guards.Immutable[wildcardGuard]; ok {
-		return true
+// exchangeWith signs the message with the TSIG key of the zone and sends it to the server over
+// its transport. If the server rejects the primary key, the message is sent again signed with the
+// secondary keys. Updates are signed with the SIG(0) key instead, if one is configured. Messages
+// too large for UDP are sent over TCP, as are retries of truncated UDP replies. The deadline of
+// ctx, if any, applies to each attempt.
+func (c *Client) exchangeWith(ctx context.Context, msg *dns.Msg, server ServerEndpoint) (*dns.Msg, error) {
+	if c.sig0 != nil && msg.Opcode == dns.OpcodeUpdate {
+		buf, err := c.sig0.sign(msg)
+		if err != nil {
+			return nil, fmt.Errorf("failed to sign message with SIG(0): %w", err)
+		}
+		// signed messages too large for UDP are sent over TCP
+		client := c.dnsClient(server, len(buf) > dns.MinMsgSize)
+		reply, err := exchangeSigned(ctx, client, buf, server.Addr)
+		if err == nil && reply.Truncated && client.Net == TransportUDP {
+			slog.Debug("Reply truncated, retrying over TCP", "server", server.Addr)
+			reply, err = exchangeSigned(ctx, c.dnsClient(server, true), buf, server.Addr)
+		}
+		return reply, err
 	}
-	return false
+	var replyMsg *dns.Msg
+	err := c.withTSIG(func(key TSIGKey) error {
+		signed := msg.Copy()
+		if key.Name != "" {
+			signed.SetTsig(key.Name, key.Algorithm, 300, time.Now().Unix())
+		}
+		client := c.dnsClient(server, needsStream(signed))
+		reply, err := exchangeContext(ctx, client, signed, server.Addr)
+		if err == nil && reply.Truncated && client.Net == TransportUDP {
+			slog.Debug("Reply truncated, retrying over TCP", "server", server.Addr)
+			reply, err = exchangeContext(ctx, c.dnsClient(server, true), signed, server.Addr)
+		}
+		if rejected := tsigRejection(reply, err); rejected != nil {
+			return rejected
+		}
+		replyMsg = reply
+		return err
+	})
+	return replyMsg, err
 }
 
-func (c *Client) isAdminEditable(record Record) bool {
-	tguard := NewRecordGuard(record.Data.RecordType(), record.Name)
-	if _, ok := c.guards.AdminOnly[tguard]; ok {
-		return ok
-	}
-	wildcardGuard := NewRecordGuard("*", record.Name)
-	if _, ok := c.guards.AdminOnly[wildcardGuard]; ok {
-		return true
-	}
-	return false
+// rrsetUpdate replaces the resource records of a record set on the server.
+type rrsetUpdate struct {
+	current     []dns.RR
+	replacement []dns.RR
 }
 
-func (c *Client) isRecordGuarded(record Record) bool {
-	return c.isImmutable(record) || c.isAdminEditable(record)
+// newReplaceMsg builds an UPDATE message that replaces the record set of current with
+// replacement. The message only applies if the record set on the server consists of exactly the
+// current records, or does not exist at all if current is empty. It returns nil if both are empty.
+func newReplaceMsg(zone string, current, replacement []dns.RR) *dns.Msg {
+	return newUpdateMsg(zone, []rrsetUpdate{{current: current, replacement: replacement}})
+}
+
+// newUpdateMsg builds an UPDATE message that replaces several record sets at once, with the
+// prerequisites of newReplaceMsg for each of them. All record sets are deleted before any
+// record is inserted, so a CNAME can be swapped for records of another type. It returns nil if
+// there is nothing to update.
+func newUpdateMsg(zone string, updates []rrsetUpdate) *dns.Msg {
+	msg := new(dns.Msg)
+	msg.SetUpdate(zone)
+	var inserts []dns.RR
+	for _, update := range updates {
+		switch {
+		case len(update.current) > 0:
+			msg.Used(update.current)
+			msg.RemoveRRset([]dns.RR{dns.Copy(update.current[0])})
+		case len(update.replacement) > 0:
+			msg.RRsetNotUsed([]dns.RR{dns.Copy(update.replacement[0])})
+		default:
+			continue
+		}
+		inserts = append(inserts, update.replacement...)
+	}
+	if len(msg.Answer) == 0 {
+		return nil
+	}
+	if len(inserts) > 0 {
+		msg.Insert(inserts)
+	}
+	return msg
 }
 
-func (c *Client) exists(record Record) bool {
+// cachedRecordSet returns the cached records of the given name and type.
+func (c *Client) cachedRecordSet(name, recordType string) []Record {
 	c.mutex.RLock()
 	defer c.mutex.RUnlock()
 
+	var set []Record
 	for _, cachedRecord := range c.cache {
-		if cachedRecord.Data.RecordType() == record.Data.RecordType() && cachedRecord.Name == record.Name {
-			return true
+		if inRecordSet(cachedRecord, name, recordType) {
+			set = append(set, cachedRecord)
 		}
 	}
-	return false
+	return set
+}
+
+func inRecordSet(record Record, name, recordType string) bool {
+	return strings.EqualFold(record.Name, name) && record.Data.RecordType() == recordType
+}
+
+func toRRs(records []Record) ([]dns.RR, error) {
+	rrs := make([]dns.RR, 0, len(records))
+	for _, record := range records {
+		rr, err := toRR(record)
+		if err != nil {
+			return nil, err
+		}
+		rrs = append(rrs, rr)
+	}
+	return rrs, nil
+}
+
+// conflictError returns an error wrapping ErrRecordConflict if the rcode signals that the
+// prerequisites of an update of the described record sets were not satisfied.
+func conflictError(rcode int, subject string) error {
+	switch rcode {
+	case dns.RcodeNXRrset, dns.RcodeYXRrset, dns.RcodeYXDomain, dns.RcodeNameError:
+		return fmt.Errorf("%w: %s (%s)", ErrRecordConflict, subject, dns.RcodeToString[rcode])
+	default:
+		return nil
+	}
+}
+
+func hashRecord(record Record) string {
+	data := record.Data.RecordType() + record.Name + record.Data.String() + strconv.FormatUint(uint64(record.TTL), 10)
+	hash := sha256.Sum256([]byte(data))
+	return hex.EncodeToString(hash[:])
+}
+
+func (c *Client) isImmutable(record Record) bool {
+	return c.isImmutableSet(record.Name, record.Data.RecordType())
+}
+
+func (c *Client) isImmutableSet(name, recordType string) bool {
+	return c.guards.Immutable.Guarded(recordType, name)
+}
+
+func (c *Client) isAdminEditable(record Record) bool {
+	return c.guards.AdminOnly.Guarded(record.Data.RecordType(), record.Name)
+}
+
+func (c *Client) isRecordGuarded(record Record) bool {
+	return c.isImmutable(record) || c.isAdminEditable(record)
 }
@@ -0,0 +1,210 @@
+package dnsservice
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+func TestNewReplaceMsg(t *testing.T) {
+	zone := "example.com."
+	rr, _ := dns.NewRR("www.example.com. 3600 IN A 192.0.2.2")
+	old, _ := dns.NewRR("www.example.com. 3600 IN A 192.0.2.1")
+
+	t.Run("New record set", func(t *testing.T) {
+		msg := newReplaceMsg(zone, nil, []dns.RR{rr})
+		if len(msg.Answer) != 1 {
+			t.Fatalf("expected 1 prerequisite, got %d", len(msg.Answer))
+		}
+		prereq := msg.Answer[0].Header()
+		if prereq.Class != dns.ClassNONE || prereq.Rrtype != dns.TypeA {
+			t.Errorf("expected 'RRset does not exist' prerequisite, got %s", msg.Answer[0])
+		}
+		if len(msg.Ns) != 1 || msg.Ns[0].String() != rr.String() {
+			t.Errorf("expected a single insert of %s, got %v", rr, msg.Ns)
+		}
+	})
+
+	t.Run("Replace record set", func(t *testing.T) {
+		msg := newReplaceMsg(zone, []dns.RR{old}, []dns.RR{rr})
+		if len(msg.Answer) != 1 {
+			t.Fatalf("expected 1 prerequisite, got %d", len(msg.Answer))
+		}
+		prereq := msg.Answer[0]
+		if prereq.Header().Class != dns.ClassINET || prereq.Header().Ttl != 0 || prereq.(*dns.A).A.String() != "192.0.2.1" {
+			t.Errorf("expected value dependent prerequisite for the current record, got %s", prereq)
+		}
+		if len(msg.Ns) != 2 {
+			t.Fatalf("expected delete and insert in a single message, got %v", msg.Ns)
+		}
+		if msg.Ns[0].Header().Class != dns.ClassANY || msg.Ns[1].String() != rr.String() {
+			t.Errorf("expected RRset deletion followed by insert, got %v", msg.Ns)
+		}
+	})
+
+	t.Run("Delete record set", func(t *testing.T) {
+		msg := newReplaceMsg(zone, []dns.RR{old}, nil)
+		if len(msg.Ns) != 1 || msg.Ns[0].Header().Class != dns.ClassANY {
+			t.Errorf("expected a single RRset deletion, got %v", msg.Ns)
+		}
+	})
+
+	if msg := newReplaceMsg(zone, nil, nil); msg != nil {
+		t.Errorf("expected no message for an empty replacement of a missing set, got %v", msg)
+	}
+}
+
+func TestConflictError(t *testing.T) {
+	if err := conflictError(dns.RcodeNXRrset, "A www.example.com."); !errors.Is(err, ErrRecordConflict) {
+		t.Errorf("conflictError(NXRRSET) = %v; want %v", err, ErrRecordConflict)
+	}
+	if err := conflictError(dns.RcodeSuccess, "A www.example.com."); err != nil {
+		t.Errorf("conflictError(NOERROR) = %v; want nil", err)
+	}
+}
+
+// newUpdateTestClient returns a client for example.com. whose UPDATE messages are answered
+// with NOERROR by a local server and sent to the returned channel.
+func newUpdateTestClient(t *testing.T, records ...Record) (*Client, <-chan *dns.Msg) {
+	t.Helper()
+	var serial atomic.Uint32
+	serial.Store(1)
+	return newSerialTestClient(t, &serial, records...)
+}
+
+// newSerialTestClient returns a client like newUpdateTestClient whose server also answers SOA
+// queries with the serial, which tests may move to simulate changes of the zone.
+func newSerialTestClient(t *testing.T, serial *atomic.Uint32, records ...Record) (*Client, <-chan *dns.Msg) {
+	t.Helper()
+	updates := make(chan *dns.Msg, 10)
+	addr := startTestServer(t, dns.HandlerFunc(func(w dns.ResponseWriter, r *dns.Msg) {
+		if r.Opcode != dns.OpcodeUpdate {
+			w.WriteMsg(soaReply(r, serial.Load()))
+			return
+		}
+		updates <- r
+		m := new(dns.Msg)
+		m.SetReply(r)
+		w.WriteMsg(m)
+	}))
+
+	c := &Client{
+		cache:   records,
+		client:  &dns.Client{TsigSecret: map[string]string{"test.": "c2VjcmV0"}},
+		zone:    "example.com.",
+		servers: []ServerEndpoint{{Addr: addr, Role: ServerRolePrimary}},
+		keys:    []TSIGKey{{Name: "test.", Secret: "c2VjcmV0", Algorithm: dns.HmacSHA256, Role: TSIGRolePrimary}},
+	}
+	return c, updates
+}
+
+func TestAddRecordKeepsRecordSet(t *testing.T) {
+	first := NewRecord("mail.example.com.", 3600, &MXRecord{Priority: 10, MailServer: "mx1.example.com."})
+	second := NewRecord("mail.example.com.", 300, &MXRecord{Priority: 20, MailServer: "mx2.example.com."})
+	c, updates := newUpdateTestClient(t, first)
+
+	if err := c.AddRecord(context.Background(), second); err != nil {
+		t.Fatalf("AddRecord() error = %v", err)
+	}
+	msg := <-updates
+	if len(msg.Answer) != 1 || msg.Answer[0].(*dns.MX).Mx != "mx1.example.com." {
+		t.Errorf("expected the current record set as prerequisite, got %v", msg.Answer)
+	}
+	if len(msg.Ns) != 3 {
+		t.Fatalf("expected the record set to be replaced with both records, got %v", msg.Ns)
+	}
+
+	records := c.GetRecords()
+	if len(records) != 2 {
+		t.Fatalf("expected both records in the cache, got %v", records)
+	}
+	for _, record := range records {
+		if record.TTL != 300 {
+			t.Errorf("expected the TTL of the added record to apply to the set, got %s", record)
+		}
+	}
+
+	if err := c.RemoveRecord(context.Background(), records[0]); err != nil {
+		t.Fatalf("RemoveRecord() error = %v", err)
+	}
+	msg = <-updates
+	if len(msg.Answer) != 2 || len(msg.Ns) != 1 || msg.Ns[0].Header().Class != dns.ClassNONE {
+		t.Errorf("expected the removal of a single record guarded by the record set, got %v", msg)
+	}
+	if records := c.GetRecords(); len(records) != 1 || !SameRecord(records[0], second) {
+		t.Errorf("expected only %s to remain, got %v", second, records)
+	}
+}
+
+func TestReplaceRecordSetRejectsSingletonSets(t *testing.T) {
+	c, updates := newUpdateTestClient(t)
+	set := RecordSet{Name: "www.example.com.", Type: "CNAME", TTL: 300, Records: []Record{
+		NewRecord("www.example.com.", 300, &CNAMERecord{Alias: "a.example.net."}),
+		NewRecord("www.example.com.", 300, &CNAMERecord{Alias: "b.example.net."}),
+	}}
+	if err := c.ReplaceRecordSet(context.Background(), set); !errors.Is(err, ErrRecordCreation) {
+		t.Fatalf("ReplaceRecordSet() error = %v, want %v", err, ErrRecordCreation)
+	}
+	if len(updates) != 0 {
+		t.Error("an invalid record set must not be sent")
+	}
+
+	set.Records = set.Records[:1]
+	if err := c.ReplaceRecordSet(context.Background(), set); err != nil {
+		t.Fatalf("ReplaceRecordSet() error = %v", err)
+	}
+	if records := c.GetRecords(); len(records) != 1 || records[0].Data.Value() != "a.example.net." {
+		t.Errorf("expected the single CNAME record, got %v", records)
+	}
+}
+
+func TestGroupRecordSets(t *testing.T) {
+	records := []Record{
+		NewRecord("www.example.com.", 300, &ARecord{IP: "192.0.2.1"}),
+		NewRecord("www.example.com.", 300, &AAAARecord{IPv6: "2001:db8::1"}),
+		NewRecord("WWW.example.com.", 300, &ARecord{IP: "192.0.2.2"}),
+	}
+	sets := GroupRecordSets(records)
+	if len(sets) != 2 {
+		t.Fatalf("GroupRecordSets() = %v; want 2 sets", sets)
+	}
+	if sets[0].Type != "A" || len(sets[0].Records) != 2 || sets[1].Type != "AAAA" {
+		t.Errorf("GroupRecordSets() = %v", sets)
+	}
+}
+
+func TestAddRecordCanceled(t *testing.T) {
+	// a server that never answers
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	c := &Client{
+		client:  &dns.Client{Timeout: time.Minute},
+		zone:    "example.com.",
+		servers: []ServerEndpoint{{Addr: conn.LocalAddr().String(), Role: ServerRolePrimary}},
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+	start := time.Now()
+	err = c.AddRecord(ctx, NewRecord("www.example.com.", 300, &ARecord{IP: "192.0.2.1"}))
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("expected the exchange to be aborted on cancellation, took %v", elapsed)
+	}
+
+	ctx, cancel = context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := c.AddRecord(ctx, NewRecord("www.example.com.", 300, &ARecord{IP: "192.0.2.1"})); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected context.DeadlineExceeded, got %v", err)
+	}
+}
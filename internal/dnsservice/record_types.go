@@ -0,0 +1,419 @@
+package dnsservice
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/miekg/dns"
+)
+
+// RecordType describes a resource record type that can be managed through DNSify. It declares
+// how raw input is parsed, how typed record data is validated and converted to and from
+// resource records, and which fields the dashboard renders for it. Supported types, guard
+// patterns and the dashboard form are all derived from the registered record types.
+type RecordType struct {
+	// Name is the mnemonic of the type, e.g. "A".
+	Name string `json:"name"`
+
+	// RRType is the numeric type of the resource records.
+	RRType uint16 `json:"-"`
+
+	// Description is shown in front of the value when listing records, e.g. "resolves to".
+	Description string `json:"description"`
+
+	// Singleton is set for types whose record sets hold a single record only, such as CNAME.
+	// Adding a record of such a type replaces the record set.
+	Singleton bool `json:"singleton,omitempty"`
+
+	// HostnamePattern is a JavaScript regular expression the dashboard validates hostnames
+	// with. If empty, a single DNS label is expected.
+	HostnamePattern string `json:"hostnamePattern,omitempty"`
+
+	// Fields are the inputs of the dashboard form. Their values are joined with colons in the
+	// order of declaration into the raw value passed to Parse.
+	Fields []FormField `json:"fields"`
+
+	// New returns empty record data, e.g. as a target for decoding JSON payloads.
+	New func() RecordData `json:"-"`
+
+	// Parse converts a raw value, as submitted by the dashboard form, into record data.
+	// The data is validated separately.
+	Parse func(value string) (RecordData, error) `json:"-"`
+
+	// Validate checks the record data of this type. It may normalize the data, e.g. the case of
+	// case insensitive fields.
+	Validate func(data RecordData) error `json:"-"`
+
+	// FromRR converts a resource record of RRType into record data.
+	FromRR func(rr dns.RR) RecordData `json:"-"`
+
+	// ToRR converts record data of this type into a resource record with the given header.
+	ToRR func(hdr dns.RR_Header, data RecordData) (dns.RR, error) `json:"-"`
+}
+
+// FormField describes an input of the dashboard form of a record type.
+type FormField struct {
+	Name  string `json:"name"`
+	Label string `json:"label"`
+
+	// Kind is either "text", "number" or "select".
+	Kind        string `json:"kind"`
+	Placeholder string `json:"placeholder,omitempty"`
+
+	// Pattern is a JavaScript regular expression text inputs are validated with.
+	Pattern string `json:"pattern,omitempty"`
+
+	// Max is the inclusive upper bound of number inputs, which are unsigned integers.
+	Max uint64 `json:"max,omitempty"`
+
+	Options []FieldOption `json:"options,omitempty"`
+	Default string        `json:"default,omitempty"`
+}
+
+// FieldOption is a choice of a select input.
+type FieldOption struct {
+	Value string `json:"value"`
+	Label string `json:"label"`
+}
+
+var recordTypes = struct {
+	sync.RWMutex
+	order      []string
+	byName     map[string]RecordType
+	byRRType   map[uint16]RecordType
+	guardRegex *regexp.Regexp
+}{
+	byName:   make(map[string]RecordType),
+	byRRType: make(map[uint16]RecordType),
+}
+
+// RegisterRecordType adds a record type to the registry, replacing a registered type of the
+// same name. It panics if the type is incomplete.
+func RegisterRecordType(t RecordType) {
+	if t.Name == "" || t.RRType == dns.TypeNone || t.New == nil || t.Parse == nil || t.Validate == nil || t.FromRR == nil || t.ToRR == nil {
+		panic(fmt.Sprintf("dnsservice: incomplete record type %q", t.Name))
+	}
+	t.Name = strings.ToUpper(t.Name)
+
+	recordTypes.Lock()
+	defer recordTypes.Unlock()
+
+	if _, ok := recordTypes.byName[t.Name]; !ok {
+		recordTypes.order = append(recordTypes.order, t.Name)
+	}
+	recordTypes.byName[t.Name] = t
+	recordTypes.byRRType[t.RRType] = t
+
+	names := make([]string, 0, len(recordTypes.order)+len(guardOnlyTypes))
+	for _, name := range append(slices.Clone(recordTypes.order), guardOnlyTypes...) {
+		names = append(names, regexp.QuoteMeta(name))
+	}
+	recordTypes.guardRegex = regexp.MustCompile(fmt.Sprintf(guardPatternFormat, strings.Join(names, "|")))
+}
+
+// LookupRecordType returns the registered record type with the given name.
+func LookupRecordType(name string) (RecordType, bool) {
+	recordTypes.RLock()
+	defer recordTypes.RUnlock()
+	t, ok := recordTypes.byName[strings.ToUpper(name)]
+	return t, ok
+}
+
+// RecordTypes returns all registered record types in the order of registration.
+func RecordTypes() []RecordType {
+	recordTypes.RLock()
+	defer recordTypes.RUnlock()
+	types := make([]RecordType, 0, len(recordTypes.order))
+	for _, name := range recordTypes.order {
+		types = append(types, recordTypes.byName[name])
+	}
+	return types
+}
+
+// SupportedTypes returns the names of all registered record types.
+func SupportedTypes() []string {
+	recordTypes.RLock()
+	defer recordTypes.RUnlock()
+	return append([]string(nil), recordTypes.order...)
+}
+
+// IsSupportedType reports whether a record type of the given name is registered.
+func IsSupportedType(name string) bool {
+	_, ok := LookupRecordType(name)
+	return ok
+}
+
+func lookupRRType(rrtype uint16) (RecordType, bool) {
+	recordTypes.RLock()
+	defer recordTypes.RUnlock()
+	t, ok := recordTypes.byRRType[rrtype]
+	return t, ok
+}
+
+// toRR converts a record into a resource record.
+func toRR(record Record) (dns.RR, error) {
+	t, ok := LookupRecordType(record.Data.RecordType())
+	if !ok {
+		return nil, fmt.Errorf("unsupported record type: %s", record.Data.RecordType())
+	}
+	hdr := dns.RR_Header{Name: record.Name, Rrtype: t.RRType, Class: dns.ClassINET, Ttl: uint32(record.TTL)}
+	return t.ToRR(hdr, record.Data)
+}
+
+// Patterns shared by the form fields of the built-in record types.
+const (
+	fqdnPattern        = `^[a-zA-Z0-9-]+(\.[a-zA-Z0-9-]+)*\.[a-zA-Z]{2,}\.$`
+	srvHostPattern     = `^_[a-zA-Z0-9-]{1,62}\._(tcp|udp|tls|sctp)(\.(?!-)[a-zA-Z0-9-]{1,63}(?<!-))*$`
+	caaValuePattern    = `^(([a-zA-Z0-9-]+(\.[a-zA-Z0-9-]+)*\.[a-zA-Z]{2,}\.?)?\s*(;(\s*[a-zA-Z0-9]+=[\x21-\x3A\x3C-\x7E]*\s*(;\s*[a-zA-Z0-9]+=[\x21-\x3A\x3C-\x7E]*\s*)*)?)?|mailto:[^\s@"]+@[^\s@"]+|https?://[^\s/"]+[^\s"]*)$`
+	ipv4Pattern        = `^(?!0)(?!.*\.$)((1?\d?\d|25[0-5]|2[0-4]\d)(\.|$)){4}$`
+	ipv6Pattern        = `^([0-9a-fA-F]{0,4}:){2,7}[0-9a-fA-F]{0,4}$`
+	txtPattern         = `^.{1,255}$`
+	apexOrLabelPattern = `^(@|(?!-)[a-zA-Z0-9-]{1,63}(?<!-))$`
+)
+
+func init() {
+	RegisterRecordType(RecordType{
+		Name:        "A",
+		RRType:      dns.TypeA,
+		Description: "resolves to",
+		Fields: []FormField{
+			{Name: "ip", Label: "IPv4 Address", Kind: "text", Placeholder: "Enter IPv4 Address", Pattern: ipv4Pattern},
+		},
+		New:   func() RecordData { return &ARecord{} },
+		Parse: func(value string) (RecordData, error) { return &ARecord{IP: value}, nil },
+		Validate: func(data RecordData) error {
+			return validateARecord(data.(*ARecord).IP)
+		},
+		FromRR: func(rr dns.RR) RecordData { return &ARecord{IP: rr.(*dns.A).A.String()} },
+		ToRR: func(hdr dns.RR_Header, data RecordData) (dns.RR, error) {
+			ip := net.ParseIP(data.(*ARecord).IP).To4()
+			if ip == nil {
+				return nil, fmt.Errorf("invalid IPv4 address: %s", data.(*ARecord).IP)
+			}
+			return &dns.A{Hdr: hdr, A: ip}, nil
+		},
+	})
+
+	RegisterRecordType(RecordType{
+		Name:        "AAAA",
+		RRType:      dns.TypeAAAA,
+		Description: "resolves to",
+		Fields: []FormField{
+			{Name: "ipv6", Label: "IPv6 Address", Kind: "text", Placeholder: "Enter IPv6 Address", Pattern: ipv6Pattern},
+		},
+		New:   func() RecordData { return &AAAARecord{} },
+		Parse: func(value string) (RecordData, error) { return &AAAARecord{IPv6: value}, nil },
+		Validate: func(data RecordData) error {
+			return validateAAAARecord(data.(*AAAARecord).IPv6)
+		},
+		FromRR: func(rr dns.RR) RecordData { return &AAAARecord{IPv6: rr.(*dns.AAAA).AAAA.String()} },
+		ToRR: func(hdr dns.RR_Header, data RecordData) (dns.RR, error) {
+			ip := net.ParseIP(data.(*AAAARecord).IPv6)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid IPv6 address: %s", data.(*AAAARecord).IPv6)
+			}
+			return &dns.AAAA{Hdr: hdr, AAAA: ip}, nil
+		},
+	})
+
+	RegisterRecordType(RecordType{
+		Name:        "CNAME",
+		RRType:      dns.TypeCNAME,
+		Description: "is an alias of",
+		Singleton:   true,
+		Fields: []FormField{
+			{Name: "alias", Label: "Alias", Kind: "text", Placeholder: "Enter Alias FQDN (e.g., host.example.com.)", Pattern: fqdnPattern},
+		},
+		New:   func() RecordData { return &CNAMERecord{} },
+		Parse: func(value string) (RecordData, error) { return &CNAMERecord{Alias: value}, nil },
+		Validate: func(data RecordData) error {
+			return validateCNAMERecord(data.(*CNAMERecord).Alias)
+		},
+		FromRR: func(rr dns.RR) RecordData { return &CNAMERecord{Alias: rr.(*dns.CNAME).Target} },
+		ToRR: func(hdr dns.RR_Header, data RecordData) (dns.RR, error) {
+			return &dns.CNAME{Hdr: hdr, Target: data.(*CNAMERecord).Alias}, nil
+		},
+	})
+
+	RegisterRecordType(RecordType{
+		Name:        "NS",
+		RRType:      dns.TypeNS,
+		Description: "directs to",
+		Fields: []FormField{
+			{Name: "nameServer", Label: "Nameserver", Kind: "text", Placeholder: "Enter Nameserver FQDN (e.g., host.example.com.)", Pattern: fqdnPattern},
+		},
+		New:   func() RecordData { return &NSRecord{} },
+		Parse: func(value string) (RecordData, error) { return &NSRecord{NameServer: value}, nil },
+		Validate: func(data RecordData) error {
+			return validateNSRecord(data.(*NSRecord).NameServer)
+		},
+		FromRR: func(rr dns.RR) RecordData { return &NSRecord{NameServer: rr.(*dns.NS).Ns} },
+		ToRR: func(hdr dns.RR_Header, data RecordData) (dns.RR, error) {
+			return &dns.NS{Hdr: hdr, Ns: data.(*NSRecord).NameServer}, nil
+		},
+	})
+
+	RegisterRecordType(RecordType{
+		Name:        "MX",
+		RRType:      dns.TypeMX,
+		Description: "mail handled by",
+		Fields: []FormField{
+			{Name: "priority", Label: "Priority", Kind: "number", Placeholder: "10", Max: math.MaxUint16},
+			{Name: "mailServer", Label: "Mail Server", Kind: "text", Placeholder: "Enter Mail Server FQDN (e.g., mail.example.com.)", Pattern: fqdnPattern},
+		},
+		New:   func() RecordData { return &MXRecord{} },
+		Parse: parseMXRecord,
+		Validate: func(data RecordData) error {
+			if mx := data.(*MXRecord); !isValidFQDN(mx.MailServer) {
+				return fmt.Errorf("invalid MX record mail server: %s", mx.MailServer)
+			}
+			return nil
+		},
+		FromRR: func(rr dns.RR) RecordData {
+			mx := rr.(*dns.MX)
+			return &MXRecord{Priority: mx.Preference, MailServer: mx.Mx}
+		},
+		ToRR: func(hdr dns.RR_Header, data RecordData) (dns.RR, error) {
+			mx := data.(*MXRecord)
+			return &dns.MX{Hdr: hdr, Preference: mx.Priority, Mx: mx.MailServer}, nil
+		},
+	})
+
+	RegisterRecordType(RecordType{
+		Name:        "TXT",
+		RRType:      dns.TypeTXT,
+		Description: "returns",
+		Fields: []FormField{
+			{Name: "text", Label: "TXT Value", Kind: "text", Placeholder: "Enter TXT String here", Pattern: txtPattern},
+		},
+		New:   func() RecordData { return &TXTRecord{} },
+		Parse: func(value string) (RecordData, error) { return &TXTRecord{Text: value}, nil },
+		Validate: func(data RecordData) error {
+			return validateTXTRecord(data.(*TXTRecord))
+		},
+		FromRR: func(rr dns.RR) RecordData {
+			txt := rr.(*dns.TXT).Txt
+			return &TXTRecord{Text: strings.Join(txt, ""), Strings: append([]string(nil), txt...)}
+		},
+		ToRR: func(hdr dns.RR_Header, data RecordData) (dns.RR, error) {
+			return &dns.TXT{Hdr: hdr, Txt: data.(*TXTRecord).characterStrings()}, nil
+		},
+	})
+
+	RegisterRecordType(RecordType{
+		Name:            "SRV",
+		RRType:          dns.TypeSRV,
+		Description:     "service located at",
+		HostnamePattern: srvHostPattern,
+		Fields: []FormField{
+			{Name: "priority", Label: "Priority", Kind: "number", Placeholder: "10", Max: math.MaxUint16},
+			{Name: "weight", Label: "Weight", Kind: "number", Placeholder: "20", Max: math.MaxUint16},
+			{Name: "port", Label: "Port", Kind: "number", Placeholder: "5060", Max: math.MaxUint16},
+			{Name: "target", Label: "Target", Kind: "text", Placeholder: "Enter Target FQDN (e.g., sip.example.com.)", Pattern: fqdnPattern},
+		},
+		New:   func() RecordData { return &SRVRecord{} },
+		Parse: parseSRVRecord,
+		Validate: func(data RecordData) error {
+			if srv := data.(*SRVRecord); !isValidFQDN(srv.Target) {
+				return fmt.Errorf("invalid SRV record target: %s", srv.Target)
+			}
+			return nil
+		},
+		FromRR: func(rr dns.RR) RecordData {
+			srv := rr.(*dns.SRV)
+			return &SRVRecord{Priority: srv.Priority, Weight: srv.Weight, Port: srv.Port, Target: srv.Target}
+		},
+		ToRR: func(hdr dns.RR_Header, data RecordData) (dns.RR, error) {
+			srv := data.(*SRVRecord)
+			return &dns.SRV{Hdr: hdr, Priority: srv.Priority, Weight: srv.Weight, Port: srv.Port, Target: srv.Target}, nil
+		},
+	})
+
+	RegisterRecordType(RecordType{
+		Name:            "CAA",
+		RRType:          dns.TypeCAA,
+		Description:     "certificate authority policy",
+		HostnamePattern: apexOrLabelPattern,
+		Fields: []FormField{
+			{Name: "flag", Label: "Flag", Kind: "select", Default: "0", Options: []FieldOption{
+				{Value: "0", Label: "Non-critical"},
+				{Value: "128", Label: "Critical"},
+			}},
+			{Name: "tag", Label: "Property", Kind: "select", Default: "issue", Options: []FieldOption{
+				{Value: "issue", Label: "issue"},
+				{Value: "issuewild", Label: "issuewild"},
+				{Value: "iodef", Label: "iodef"},
+			}},
+			{Name: "value", Label: "Value", Kind: "text", Placeholder: "e.g., letsencrypt.org or mailto:security@example.com", Pattern: caaValuePattern},
+		},
+		New:   func() RecordData { return &CAARecord{} },
+		Parse: parseCAARecord,
+		Validate: func(data RecordData) error {
+			// property tags are case insensitive (RFC 8659, section 4.1), so all paths store them in lower case
+			caa := data.(*CAARecord)
+			caa.Tag = strings.ToLower(caa.Tag)
+			return validateCAAProperty(caa.Tag, caa.Content)
+		},
+		FromRR: func(rr dns.RR) RecordData {
+			caa := rr.(*dns.CAA)
+			return &CAARecord{Flag: caa.Flag, Tag: strings.ToLower(caa.Tag), Content: caa.Value}
+		},
+		ToRR: func(hdr dns.RR_Header, data RecordData) (dns.RR, error) {
+			caa := data.(*CAARecord)
+			return &dns.CAA{Hdr: hdr, Flag: caa.Flag, Tag: caa.Tag, Value: caa.Content}, nil
+		},
+	})
+}
+
+// parseMXRecord parses an MX record in the "priority:mailserver" format.
+func parseMXRecord(value string) (RecordData, error) {
+	parts := strings.Split(value, ":")
+	if len(parts) != 2 {
+		return nil, fmt.Errorf("invalid MX record format: %s", value)
+	}
+	priority, err := strconv.ParseUint(parts[0], 10, 16)
+	if err != nil {
+		return nil, fmt.Errorf("invalid MX record priority: %s", parts[0])
+	}
+	return &MXRecord{Priority: uint16(priority), MailServer: parts[1]}, nil
+}
+
+// parseSRVRecord parses an SRV record in the "priority:weight:port:target" format.
+func parseSRVRecord(value string) (RecordData, error) {
+	parts := strings.Split(value, ":")
+	if len(parts) != 4 {
+		return nil, fmt.Errorf("invalid SRV record format: %s", value)
+	}
+	priority, err := strconv.ParseUint(parts[0], 10, 16)
+	if err != nil {
+		return nil, fmt.Errorf("invalid SRV record priority: %s", parts[0])
+	}
+	weight, err := strconv.ParseUint(parts[1], 10, 16)
+	if err != nil {
+		return nil, fmt.Errorf("invalid SRV record weight: %s", parts[1])
+	}
+	port, err := strconv.ParseUint(parts[2], 10, 16)
+	if err != nil {
+		return nil, fmt.Errorf("invalid SRV record port: %s", parts[2])
+	}
+	return &SRVRecord{Priority: uint16(priority), Weight: uint16(weight), Port: uint16(port), Target: parts[3]}, nil
+}
+
+// parseCAARecord parses a CAA record in the "flag:tag:value" format. The value may contain colons.
+func parseCAARecord(value string) (RecordData, error) {
+	parts := strings.SplitN(value, ":", 3)
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("invalid CAA record format: %s", value)
+	}
+	flag, err := strconv.ParseUint(parts[0], 10, 8)
+	if err != nil {
+		return nil, fmt.Errorf("invalid CAA record flag: %s", parts[0])
+	}
+	return &CAARecord{Flag: uint8(flag), Tag: parts[1], Content: parts[2]}, nil
+}
@@ -3,8 +3,11 @@ package dnsservice
 import (
 	"errors"
 	"fmt"
+	"math"
 	"strconv"
 	"strings"
+
+	"github.com/miekg/dns"
 )
 
 var (
@@ -12,6 +15,7 @@ var (
 	ErrNotAuthorized   = errors.New("not authorized to perform this action")
 	ErrRecordCreation  = errors.New("failed to create record")
 	ErrRecordDeletion  = errors.New("failed to delete record")
+	ErrRecordConflict  = errors.New("record set was modified on the server")
 )
 
 // Record represents a DNS resource record as defined in RFC 1035.
@@ -38,6 +42,40 @@ func (r Record) String() string {
 	return fmt.Sprintf("%s %d %s %s", r.Name, r.TTL, class, r.Data.String())
 }
 
+// SameRecord reports whether both records have the same name, type and value, ignoring the TTL.
+func SameRecord(a, b Record) bool {
+	return strings.EqualFold(a.Name, b.Name) &&
+		a.Data.RecordType() == b.Data.RecordType() &&
+		a.Data.Value() == b.Data.Value()
+}
+
+// RecordSet is the set of all records sharing a name and a type (RRset, RFC 2181). DNS treats
+// a record set as a unit, its records share a single TTL.
+type RecordSet struct {
+	Name    string
+	Type    string
+	TTL     uint
+	Records []Record
+}
+
+// GroupRecordSets groups records by name and type. The sets are ordered by the first
+// appearance of one of their records.
+func GroupRecordSets(records []Record) []RecordSet {
+	var sets []RecordSet
+	index := make(map[string]int)
+	for _, record := range records {
+		key := strings.ToLower(record.Name) + "/" + record.Data.RecordType()
+		i, ok := index[key]
+		if !ok {
+			i = len(sets)
+			index[key] = i
+			sets = append(sets, RecordSet{Name: record.Name, Type: record.Data.RecordType(), TTL: record.TTL})
+		}
+		sets[i].Records = append(sets[i].Records, record)
+	}
+	return sets
+}
+
 func NewRecord(fqdn string, ttl uint, data RecordData) Record {
 	r := Record{
 		Name: fqdn,
@@ -53,6 +91,7 @@ func NewRecord(fqdn string, ttl uint, data RecordData) Record {
 // validation and parsing. Returns a new Record and an error if the inputs are invalid.
 // For MX records, 'value' should be in the "priority:mailserver" format.
 // For SRV records, 'value' should be in the "priority:weight:port:target" format.
+// For CAA records, 'value' should be in the "flag:tag:value" format.
 func NewRecordFromRaw(recordType, hostname, value, ttlStr, zone string) (*Record, error) {
 	ttl, err := strconv.ParseUint(ttlStr, 10, 32)
 	if err != nil {
@@ -61,70 +100,87 @@ func NewRecordFromRaw(recordType, hostname, value, ttlStr, zone string) (*Record
 
 	fqdn := toFQDN(hostname, zone)
 
-	var recordData RecordData
-	switch recordType {
-	case "A":
-		err = validateARecord(value)
-		if err != nil {
-			return nil, err
-		}
-		recordData = &ARecord{IP: value}
-	case "AAAA":
-		err = validateAAAARecord(value)
-		if err != nil {
-			return nil, err
-		}
-		recordData = &AAAARecord{IPv6: value}
-	case "MX":
-		err = validateMXRecord(value)
-		if err != nil {
-			return nil, err
-		}
-		parts := strings.Split(value, ":")
-		priority, _ := strconv.Atoi(parts[0]) // Already validated
-		recordData = &MXRecord{Priority: uint16(priority), MailServer: parts[1]}
-	case "NS":
-		err = validateNSRecord(value)
-		if err != nil {
-			return nil, err
-		}
-		recordData = &NSRecord{NameServer: value}
+	t, ok := LookupRecordType(recordType)
+	if !ok {
+		return nil, fmt.Errorf("unsupported record type: %s", recordType)
+	}
+	recordData, err := t.Parse(value)
+	if err != nil {
+		return nil, err
+	}
+	if err := t.Validate(recordData); err != nil {
+		return nil, err
+	}
 
-	case "CNAME":
-		err = validateCNAMERecord(value)
-		if err != nil {
-			return nil, err
-		}
-		recordData = &CNAMERecord{Alias: value}
+	r := NewRecord(fqdn, uint(ttl), recordData)
+	return &r, nil
+}
 
-	case "TXT":
-		err = validateTXTRecord(value)
-		if err != nil {
-			return nil, err
-		}
-		recordData = &TXTRecord{Text: value}
-	case "SRV":
-		err = validateSRVRecord(value)
-		if err != nil {
-			return nil, err
-		}
-		parts := strings.Split(value, ":")
-		if len(parts) != 4 {
-			return nil, fmt.Errorf("invalid SRV record format")
-		}
-		priority, _ := strconv.Atoi(parts[0]) // Assuming validation checks these
-		weight, _ := strconv.Atoi(parts[1])
-		port, _ := strconv.Atoi(parts[2])
-		recordData = &SRVRecord{
-			Priority: uint16(priority),
-			Weight:   uint16(weight),
-			Port:     uint16(port),
-			Target:   parts[3],
-		}
-	default:
+// NewRecordData returns an empty RecordData implementation for the given record type.
+// It is typically used as a decoding target for typed (e.g. JSON) record payloads.
+func NewRecordData(recordType string) (RecordData, error) {
+	t, ok := LookupRecordType(recordType)
+	if !ok {
 		return nil, fmt.Errorf("unsupported record type: %s", recordType)
 	}
+	return t.New(), nil
+}
 
-	r := NewRecord(fqdn, uint(ttl), recordData)
+// NewRecordFromData constructs a Record from already typed record data. The hostname may either be
+// relative to the zone (or "@" for the apex) or a fully qualified name ending with a dot, in which case
+// it must belong to the zone. Returns an error if the hostname or the record data is invalid.
+func NewRecordFromData(hostname string, ttl uint, data RecordData, zone string) (*Record, error) {
+	if data == nil {
+		return nil, fmt.Errorf("missing record data")
+	}
+	if ttl == 0 || ttl > math.MaxUint32 {
+		return nil, fmt.Errorf("invalid TTL: %d", ttl)
+	}
+
+	fqdn, err := ZoneFQDN(hostname, zone)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := validateRecordData(data); err != nil {
+		return nil, err
+	}
+
+	r := NewRecord(fqdn, ttl, data)
 	return &r, nil
 }
+
+// ZoneFQDN returns the fully qualified name of a hostname of the zone. The hostname may either be
+// relative to the zone (or "@" for the apex) or a name of the zone, in which case the trailing dot
+// is optional. Names are compared case-insensitively, and a fully qualified name ending with a dot
+// must belong to the zone.
+func ZoneFQDN(hostname, zone string) (string, error) {
+	if fqdn := dns.Fqdn(hostname); dns.IsSubDomain(zone, fqdn) {
+		return fqdn, nil
+	}
+	if strings.HasSuffix(hostname, ".") {
+		return "", fmt.Errorf("%s is not part of the zone %s", hostname, zone)
+	}
+	return toFQDN(hostname, zone), nil
+}
+
+// recordFromRR converts a resource record into a Record. It reports false for record types
+// that are not supported.
+func recordFromRR(rr dns.RR) (Record, bool) {
+	t, ok := lookupRRType(rr.Header().Rrtype)
+	if !ok {
+		return Record{}, false
+	}
+	return NewRecord(rr.Header().Name, uint(rr.Header().Ttl), t.FromRR(rr)), true
+}
+
+// recordsFromRRs converts all supported resource records into Records, skipping the rest.
+func recordsFromRRs(rrs []dns.RR) []Record {
+	var records []Record
+	for _, rr := range rrs {
+		if record, ok := recordFromRR(rr); ok {
+			records = append(records, record)
+		}
+	}
+	return records
+}
@@ -1,7 +1,10 @@
 package dnsservice
 
 import (
+	"strings"
 	"testing"
+
+	"github.com/miekg/dns"
 )
 
 func TestNewRecordFromRaw(t *testing.T) {
@@ -32,6 +35,15 @@ func TestNewRecordFromRaw(t *testing.T) {
 		{"Invalid SRV Record - Bad Format", "SRV", "_sip._tcp.www", "invalid-srv", validTTL, true},
 		{"Invalid SRV Record - Bad Weight", "SRV", "_sip._tcp.www", "10:bad:5060:sipserver.example.com.", validTTL, true},
 		{"Invalid SRV Record - Bad Target", "SRV", "_sip._tcp.www", "10:20:5060:invalid-target", validTTL, true},
+		{"Invalid SRV Record - Port Out Of Range", "SRV", "_sip._tcp.www", "10:20:70000:sipserver.example.com.", validTTL, true},
+		{"Valid CAA Record", "CAA", "@", "0:issue:letsencrypt.org", validTTL, false},
+		{"Valid CAA Record - Parameters", "CAA", "@", "0:issue:letsencrypt.org; validationmethods=dns-01", validTTL, false},
+		{"Valid CAA Record - Forbid Wildcards", "CAA", "@", "0:issuewild:;", validTTL, false},
+		{"Valid CAA Record - Iodef", "CAA", "@", "128:iodef:mailto:security@example.com", validTTL, false},
+		{"Invalid CAA Record - Bad Flag", "CAA", "@", "256:issue:letsencrypt.org", validTTL, true},
+		{"Invalid CAA Record - Unknown Tag", "CAA", "@", "0:contactemail:security@example.com", validTTL, true},
+		{"Invalid CAA Record - Bad Issuer", "CAA", "@", "0:issue:not an issuer", validTTL, true},
+		{"Invalid CAA Record - Bad Iodef", "CAA", "@", "0:iodef:ftp://example.com", validTTL, true},
 	}
 
 	for _, tc := range testCases {
@@ -43,3 +55,194 @@ func TestNewRecordFromRaw(t *testing.T) {
 		})
 	}
 }
+
+func TestNewRecordFromData(t *testing.T) {
+	zone := "example.com."
+
+	testCases := []struct {
+		name     string
+		hostname string
+		ttl      uint
+		data     RecordData
+		wantFQDN string
+		wantErr  bool
+	}{
+		{"Relative hostname", "www", 3600, &ARecord{IP: "192.0.2.1"}, "www.example.com.", false},
+		{"Apex", "@", 3600, &AAAARecord{IPv6: "::1"}, "example.com.", false},
+		{"FQDN inside zone", "mail.example.com.", 3600, &MXRecord{Priority: 10, MailServer: "mx.example.com."}, "mail.example.com.", false},
+		{"FQDN with other case", "WWW.Example.COM.", 3600, &ARecord{IP: "192.0.2.1"}, "WWW.Example.COM.", false},
+		{"Name without trailing dot", "WWW.Example.COM", 3600, &ARecord{IP: "192.0.2.1"}, "WWW.Example.COM.", false},
+		{"FQDN outside zone", "mail.example.org.", 3600, &ARecord{IP: "192.0.2.1"}, "", true},
+		{"Zero TTL", "www", 0, &ARecord{IP: "192.0.2.1"}, "", true},
+		{"Invalid data", "www", 3600, &ARecord{IP: "::1"}, "", true},
+		{"Missing data", "www", 3600, nil, "", true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			record, err := NewRecordFromData(tc.hostname, tc.ttl, tc.data, zone)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("NewRecordFromData() error = %v, wantErr %v", err, tc.wantErr)
+			}
+			if err == nil && record.Name != tc.wantFQDN {
+				t.Errorf("NewRecordFromData() name = %s, want %s", record.Name, tc.wantFQDN)
+			}
+		})
+	}
+}
+
+func TestRecordFromRR(t *testing.T) {
+	rr, err := dns.NewRR("_sip._tcp.example.com. 3600 IN SRV 10 20 5060 sipserver.example.com.")
+	if err != nil {
+		t.Fatal(err)
+	}
+	record, ok := recordFromRR(rr)
+	if !ok {
+		t.Fatal("recordFromRR() did not convert the SRV record")
+	}
+	want := &SRVRecord{Priority: 10, Weight: 20, Port: 5060, Target: "sipserver.example.com."}
+	if got, ok := record.Data.(*SRVRecord); !ok || *got != *want {
+		t.Errorf("recordFromRR() data = %v; want %v", record.Data, want)
+	}
+	if record.Name != "_sip._tcp.example.com." || record.TTL != 3600 {
+		t.Errorf("recordFromRR() = %v", record)
+	}
+
+	// the record must survive the round trip back into a resource record
+	back, err := dns.NewRR(record.String())
+	if err != nil || back.String() != rr.String() {
+		t.Errorf("round trip = %v, %v; want %v", back, err, rr)
+	}
+
+	for _, raw := range []string{
+		`example.com. 3600 IN CAA 0 issue "letsencrypt.org; validationmethods=dns-01"`,
+		`example.com. 3600 IN CAA 128 iodef "mailto:security@example.com"`,
+	} {
+		rr, err := dns.NewRR(raw)
+		if err != nil {
+			t.Fatal(err)
+		}
+		record, ok := recordFromRR(rr)
+		if !ok {
+			t.Fatalf("recordFromRR() did not convert %s", raw)
+		}
+		if err := validateRecordData(record.Data); err != nil {
+			t.Errorf("validateRecordData(%v) = %v", record.Data, err)
+		}
+		back, err := dns.NewRR(record.String())
+		if err != nil || back.String() != rr.String() {
+			t.Errorf("round trip = %v, %v; want %v", back, err, rr)
+		}
+	}
+}
+
+func TestCAATagIsLowerCase(t *testing.T) {
+	raw, err := NewRecordFromRaw("CAA", "@", "0:IssueWild:;", "3600", "example.com.")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := NewRecordFromData("@", 3600, &CAARecord{Tag: "ISSUE", Content: "letsencrypt.org"}, "example.com.")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr, err := dns.NewRR(`example.com. 3600 IN CAA 0 Issue "letsencrypt.org"`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	transferred, _ := recordFromRR(rr)
+	for _, record := range []Record{*raw, *data, transferred} {
+		if tag := record.Data.(*CAARecord).Tag; tag != strings.ToLower(tag) {
+			t.Errorf("expected a lower case tag, got %s", record)
+		}
+	}
+	if !SameRecord(*data, transferred) {
+		t.Errorf("expected %s and %s to be the same record", *data, transferred)
+	}
+}
+
+func TestToRR(t *testing.T) {
+	zone := "example.com."
+	raw := map[string]string{
+		"A":     "192.0.2.1",
+		"AAAA":  "2001:db8::1",
+		"CNAME": "target.example.com.",
+		"NS":    "ns1.example.com.",
+		"MX":    "10:mail.example.com.",
+		"TXT":   "v=spf1 -all",
+		"SRV":   "10:20:5060:sip.example.com.",
+		"CAA":   "0:issue:letsencrypt.org",
+	}
+
+	for _, recordType := range SupportedTypes() {
+		value, ok := raw[recordType]
+		if !ok {
+			t.Errorf("no test value for record type %s", recordType)
+			continue
+		}
+		hostname := "www"
+		if recordType == "SRV" {
+			hostname = "_sip._tcp"
+		}
+		record, err := NewRecordFromRaw(recordType, hostname, value, "3600", zone)
+		if err != nil {
+			t.Fatalf("NewRecordFromRaw(%s) error = %v", recordType, err)
+		}
+
+		// the typed conversion must agree with the presentation format of the record
+		rr, err := toRR(*record)
+		if err != nil {
+			t.Fatalf("toRR(%s) error = %v", record, err)
+		}
+		want, err := dns.NewRR(record.String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if rr.String() != want.String() {
+			t.Errorf("toRR() = %s; want %s", rr, want)
+		}
+
+		back, ok := recordFromRR(rr)
+		if !ok || back.Hash != record.Hash {
+			t.Errorf("recordFromRR(%s) = %v, %v; want %v", rr, back, ok, record)
+		}
+	}
+}
+
+func TestTXTCharacterStrings(t *testing.T) {
+	// a DKIM key split into several character strings, as the server serves it
+	rr, err := dns.NewRR(`default._domainkey.example.com. 3600 IN TXT "v=DKIM1; k=rsa; " "p=MIIBIjANBgkqhkiG9w0BAQEFAAOCAQ8AMIIBCgKCAQEA"`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	record, ok := recordFromRR(rr)
+	if !ok {
+		t.Fatal("recordFromRR() did not convert the TXT record")
+	}
+	if record.Data.Value() != "v=DKIM1; k=rsa; p=MIIBIjANBgkqhkiG9w0BAQEFAAOCAQ8AMIIBCgKCAQEA" {
+		t.Errorf("Value() = %q, want the concatenated strings", record.Data.Value())
+	}
+	back, err := toRR(record)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// prerequisites built from the cache must match the RDATA on the server
+	if !dns.IsDuplicate(back, rr) {
+		t.Errorf("toRR() = %s, want %s", back, rr)
+	}
+	if parsed, err := dns.NewRR(record.String()); err != nil || !dns.IsDuplicate(parsed, rr) {
+		t.Errorf("String() = %s, %v; want %s", record, err, rr)
+	}
+
+	// text without strings, e.g. from the API, is split into strings of at most 255 bytes
+	long := &TXTRecord{Text: strings.Repeat("a", 300)}
+	if err := validateRecordData(long); err != nil {
+		t.Fatalf("validateRecordData() error = %v", err)
+	}
+	rr, err = toRR(NewRecord("example.com.", 3600, long))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if txt := rr.(*dns.TXT).Txt; len(txt) != 2 || len(txt[0]) != 255 || len(txt[1]) != 45 {
+		t.Errorf("toRR() strings = %q, want 255 and 45 bytes", txt)
+	}
+}
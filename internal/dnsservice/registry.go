@@ -0,0 +1,129 @@
+package dnsservice
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/miekg/dns"
+	"github.com/theadell/dnsify/internal/journal"
+)
+
+var ErrZoneNotFound = errors.New("zone not found")
+
+// Registry holds the DNS services of all zones managed by a single DNSify instance, keyed by zone.
+// The first registered zone is the default zone, which is used whenever a request does not name a zone.
+type Registry struct {
+	zones map[string]Service
+	order []string
+}
+
+// NewRegistry creates a Registry from the given services. It returns an error if no service is
+// provided or if two services manage the same zone.
+func NewRegistry(services ...Service) (*Registry, error) {
+	if len(services) == 0 {
+		return nil, fmt.Errorf("at least one zone must be configured")
+	}
+	r := &Registry{
+		zones: make(map[string]Service, len(services)),
+		order: make([]string, 0, len(services)),
+	}
+	for _, s := range services {
+		zone := normalizeZone(s.GetZone())
+		if _, ok := r.zones[zone]; ok {
+			return nil, fmt.Errorf("zone %s is configured more than once", zone)
+		}
+		r.zones[zone] = s
+		r.order = append(r.order, zone)
+	}
+	return r, nil
+}
+
+// NewRegistryFromConfig creates a Client for every zone configuration and registers it.
+// Clients that were already created are closed if a later one fails.
+func NewRegistryFromConfig(configs []DNSConfig) (*Registry, error) {
+	services := make([]Service, 0, len(configs))
+	for _, config := range configs {
+		client, err := NewClient(config)
+		if err != nil {
+			for _, s := range services {
+				s.Close()
+			}
+			return nil, fmt.Errorf("zone %s: %w", config.Zone, err)
+		}
+		services = append(services, client)
+	}
+	r, err := NewRegistry(services...)
+	if err != nil {
+		for _, s := range services {
+			s.Close()
+		}
+		return nil, err
+	}
+	return r, nil
+}
+
+// Get returns the service of the given zone. The zone name is matched case-insensitively and
+// may be given with or without the trailing dot.
+func (r *Registry) Get(zone string) (Service, error) {
+	s, ok := r.zones[normalizeZone(zone)]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrZoneNotFound, zone)
+	}
+	return s, nil
+}
+
+// Lookup returns the service of the zone the name belongs to, the most specific zone if zones are
+// nested.
+func (r *Registry) Lookup(name string) (Service, error) {
+	name = normalizeZone(name)
+	var match string
+	for _, zone := range r.order {
+		if dns.IsSubDomain(zone, name) && len(zone) > len(match) {
+			match = zone
+		}
+	}
+	if match == "" {
+		return nil, fmt.Errorf("%w: no zone contains %s", ErrZoneNotFound, name)
+	}
+	return r.zones[match], nil
+}
+
+// Default returns the service of the first registered zone.
+func (r *Registry) Default() Service {
+	return r.zones[r.order[0]]
+}
+
+// Zones returns the names of all registered zones in registration order.
+func (r *Registry) Zones() []string {
+	return append([]string(nil), r.order...)
+}
+
+// Services returns all registered services in registration order.
+func (r *Registry) Services() []Service {
+	services := make([]Service, 0, len(r.order))
+	for _, zone := range r.order {
+		services = append(services, r.zones[zone])
+	}
+	return services
+}
+
+// SetJournal makes the services of all zones record their changes in the journal.
+func (r *Registry) SetJournal(j journal.Journal) {
+	for _, s := range r.Services() {
+		if journaled, ok := s.(journaled); ok {
+			journaled.setJournal(j)
+		}
+	}
+}
+
+// Close closes the services of all zones.
+func (r *Registry) Close() {
+	for _, s := range r.Services() {
+		s.Close()
+	}
+}
+
+func normalizeZone(zone string) string {
+	return strings.ToLower(dns.Fqdn(zone))
+}
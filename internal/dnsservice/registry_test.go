@@ -0,0 +1,64 @@
+package dnsservice
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestRegistry(t *testing.T) {
+	registry, err := NewRegistry(NewMockClientForZone("example.com."), NewMockClientForZone("example.org."))
+	if err != nil {
+		t.Fatalf("NewRegistry() error = %v", err)
+	}
+
+	if got := registry.Default().GetZone(); got != "example.com." {
+		t.Errorf("Default() zone = %s; want example.com.", got)
+	}
+
+	for _, zone := range []string{"example.org.", "example.org", "EXAMPLE.org"} {
+		s, err := registry.Get(zone)
+		if err != nil {
+			t.Errorf("Get(%q) error = %v", zone, err)
+			continue
+		}
+		if s.GetZone() != "example.org." {
+			t.Errorf("Get(%q) zone = %s; want example.org.", zone, s.GetZone())
+		}
+	}
+
+	if _, err := registry.Get("example.net"); !errors.Is(err, ErrZoneNotFound) {
+		t.Errorf("Get(example.net) error = %v; want %v", err, ErrZoneNotFound)
+	}
+}
+
+func TestRegistryLookup(t *testing.T) {
+	registry, err := NewRegistry(NewMockClientForZone("example.com."), NewMockClientForZone("lab.example.com."))
+	if err != nil {
+		t.Fatalf("NewRegistry() error = %v", err)
+	}
+	tests := map[string]string{
+		"example.com":         "example.com.",
+		"www.Example.com.":    "example.com.",
+		"nas.lab.example.com": "lab.example.com.",
+		"notlab.example.com.": "example.com.",
+	}
+	for name, want := range tests {
+		s, err := registry.Lookup(name)
+		if err != nil || s.GetZone() != want {
+			t.Errorf("Lookup(%q) = %v, %v; want %s", name, s, err, want)
+		}
+	}
+	if _, err := registry.Lookup("example.org."); !errors.Is(err, ErrZoneNotFound) {
+		t.Errorf("Lookup(example.org.) error = %v; want %v", err, ErrZoneNotFound)
+	}
+}
+
+func TestRegistryDuplicateZone(t *testing.T) {
+	_, err := NewRegistry(NewMockClientForZone("example.com."), NewMockClientForZone("Example.com."))
+	if err == nil {
+		t.Error("NewRegistry() with duplicate zones should fail")
+	}
+	if _, err := NewRegistry(); err == nil {
+		t.Error("NewRegistry() without zones should fail")
+	}
+}
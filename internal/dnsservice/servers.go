@@ -0,0 +1,226 @@
+package dnsservice
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// ErrPrimaryNotReachable is reported by the health check if the primary server is down while a
+// secondary still answers. The zone can be read, but updates fail until the primary is back.
+var ErrPrimaryNotReachable = errors.New("primary server not reachable")
+
+const (
+	ServerRolePrimary   = "primary"
+	ServerRoleSecondary = "secondary"
+)
+
+// ServerEndpoint is an authoritative DNS server of a zone. Updates are only sent to the primary
+// server, while zone transfers and SOA queries fall back to the secondaries if it is down.
+type ServerEndpoint struct {
+	// Addr is the address of the server with port, e.g. "ns1.example.com:53".
+	Addr string `mapstructure:"addr"`
+	// Role is either "primary" or "secondary". Defaults to primary for the first server and to
+	// secondary for all others.
+	Role string `mapstructure:"role"`
+	// Transport is "udp", "tcp" or "dot" for DNS over TLS. Defaults to udp. Zone transfers of udp
+	// servers and updates too large for a UDP message use TCP.
+	Transport string `mapstructure:"transport"`
+	// TLS configures the certificate verification of dot servers.
+	TLS TLSConfig `mapstructure:"tls"`
+
+	tlsConfig *tls.Config
+}
+
+// ServerHealth is the result of probing a single server with a SOA query.
+type ServerHealth struct {
+	Addr      string
+	Role      string
+	Transport string
+	Reachable bool
+	// Serial is the SOA serial of the zone on the server.
+	Serial uint32
+	// Behind reports whether a secondary server serves an older serial than the primary server.
+	Behind bool
+	Error  error
+}
+
+// servers returns the normalized servers of the zone, primary server first. The single Addr is
+// used as the primary server if no servers are listed.
+func (config ServerConfig) servers() ([]ServerEndpoint, error) {
+	servers := config.Servers
+	if len(servers) == 0 {
+		servers = []ServerEndpoint{{Addr: config.Addr}}
+	}
+
+	var primary ServerEndpoint
+	secondaries := make([]ServerEndpoint, 0, len(servers))
+	for i, server := range servers {
+		if server.Addr == "" {
+			return nil, fmt.Errorf("server %d: address must be specified", i)
+		}
+		if err := validateAddress(server.Addr); err != nil {
+			return nil, fmt.Errorf("server %s: %w", server.Addr, err)
+		}
+		if err := server.normalizeTransport(); err != nil {
+			return nil, err
+		}
+
+		switch strings.ToLower(server.Role) {
+		case "":
+			if i == 0 && !hasPrimaryServer(servers) {
+				server.Role = ServerRolePrimary
+			} else {
+				server.Role = ServerRoleSecondary
+			}
+		case ServerRolePrimary, ServerRoleSecondary:
+			server.Role = strings.ToLower(server.Role)
+		default:
+			return nil, fmt.Errorf("server %s: role must be %q or %q", server.Addr, ServerRolePrimary, ServerRoleSecondary)
+		}
+
+		if server.Role == ServerRolePrimary {
+			if primary.Addr != "" {
+				return nil, fmt.Errorf("servers %s and %s are both primary servers", primary.Addr, server.Addr)
+			}
+			primary = server
+			continue
+		}
+		secondaries = append(secondaries, server)
+	}
+	if primary.Addr == "" {
+		return nil, fmt.Errorf("one server must be the primary server")
+	}
+	return append([]ServerEndpoint{primary}, secondaries...), nil
+}
+
+func hasPrimaryServer(servers []ServerEndpoint) bool {
+	for _, server := range servers {
+		if strings.EqualFold(server.Role, ServerRolePrimary) {
+			return true
+		}
+	}
+	return false
+}
+
+// primary returns the primary server, which receives all updates.
+func (c *Client) primary() ServerEndpoint {
+	return c.servers[0]
+}
+
+// withServers runs op with the servers of the zone, primary server first, until op succeeds or
+// ctx is done. Reads that any server can answer, like zone transfers, use it to survive an outage
+// of the primary server.
+func (c *Client) withServers(ctx context.Context, op func(server ServerEndpoint) error) error {
+	var errs []error
+	for _, server := range c.servers {
+		err := op(server)
+		if err == nil {
+			return nil
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if len(c.servers) > 1 {
+			slog.Warn("DNS server failed, trying the next server", "zone", c.zone, "server", server.Addr, "role", server.Role, "error", err.Error())
+		}
+		errs = append(errs, fmt.Errorf("%s server %s: %w", server.Role, server.Addr, err))
+	}
+	if len(errs) == 1 {
+		return errors.Unwrap(errs[0])
+	}
+	return errors.Join(errs...)
+}
+
+// probeServers queries the SOA record of the zone on every server.
+func (c *Client) probeServers(ctx context.Context) []ServerHealth {
+	health := make([]ServerHealth, 0, len(c.servers))
+	for _, server := range c.servers {
+		state := ServerHealth{Addr: server.Addr, Role: server.Role, Transport: server.Transport}
+		soa, err := c.querySOAFrom(ctx, server)
+		if err != nil {
+			state.Error = err
+		} else {
+			state.Reachable = true
+			state.Serial = soa.Serial
+		}
+		health = append(health, state)
+	}
+	return health
+}
+
+// checkHealth probes the servers and the NS set and updates the health state. The zone counts as
+// reachable as long as any server answers. The serials of the secondaries and the NS set are
+// compared with the primary server, or the cached zone while the primary is down.
+func (c *Client) checkHealth(ctx context.Context) {
+	servers := c.probeServers(ctx)
+	nameservers := c.probeNameservers(ctx)
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	serial := c.healthState.Serial
+	if servers[0].Reachable {
+		serial = servers[0].Serial
+	}
+	for i := range servers[1:] {
+		secondary := &servers[i+1]
+		secondary.Behind = secondary.Reachable && isBehind(secondary.Serial, serial)
+		if secondary.Behind {
+			slog.Warn("Secondary DNS server is behind the primary", "zone", c.zone, "server", secondary.Addr, "serial", secondary.Serial, "primary_serial", serial)
+		}
+	}
+	c.healthState.Nameservers = nameservers
+	c.healthState.NameserverError = checkNameservers(nameservers, serial)
+	if c.healthState.NameserverError != nil {
+		slog.Warn("Nameservers of the zone are inconsistent", "zone", c.zone, "error", c.healthState.NameserverError.Error())
+	}
+	c.healthState.Servers = servers
+	c.healthState.LastChecked = time.Now()
+	c.healthState.ServerReachable = false
+	for _, server := range servers {
+		if server.Reachable {
+			c.healthState.ServerReachable = true
+		} else {
+			slog.Error("DNS server not reachable", "zone", c.zone, "server", server.Addr, "role", server.Role, "error", server.Error.Error())
+		}
+	}
+	switch {
+	case !c.healthState.ServerReachable:
+		c.healthState.CheckError = ErrServerNotReachable
+	case !servers[0].Reachable:
+		c.healthState.CheckError = ErrPrimaryNotReachable
+	default:
+		c.healthState.CheckError = nil
+	}
+}
+
+// isBehind reports whether serial is older than the cached serial in serial number arithmetic
+// (RFC 1982), which happens if a secondary has not yet transferred the latest changes.
+func isBehind(serial, cached uint32) bool {
+	return int32(serial-cached) < 0
+}
+
+// querySOAFrom returns the SOA record of the zone as reported by the server. The query is
+// signed like any other exchange, so servers that only answer signed queries can be probed.
+func (c *Client) querySOAFrom(ctx context.Context, server ServerEndpoint) (*dns.SOA, error) {
+	m := new(dns.Msg)
+	m.SetQuestion(c.zone, dns.TypeSOA)
+	r, err := c.exchangeWith(ctx, m, server)
+	if err != nil {
+		return nil, err
+	}
+	if r.Rcode != dns.RcodeSuccess {
+		return nil, fmt.Errorf("SOA query failed: %s", dns.RcodeToString[r.Rcode])
+	}
+	for _, rr := range r.Answer {
+		if soa, ok := rr.(*dns.SOA); ok {
+			return soa, nil
+		}
+	}
+	return nil, errSerialNotAnswered
+}
@@ -0,0 +1,192 @@
+package dnsservice
+
+import (
+	"context"
+	"errors"
+	"net"
+	"reflect"
+	"sync/atomic"
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+func TestServers(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  ServerConfig
+		want    []ServerEndpoint
+		wantErr bool
+	}{
+		{
+			name:   "single address is the primary server",
+			config: ServerConfig{Addr: "ns1.example.com:53"},
+			want:   []ServerEndpoint{{Addr: "ns1.example.com:53", Role: ServerRolePrimary, Transport: TransportUDP}},
+		},
+		{
+			name: "servers take precedence, primary first",
+			config: ServerConfig{Addr: "ns0.example.com:53", Servers: []ServerEndpoint{
+				{Addr: "ns2.example.com:53", Role: "Secondary"},
+				{Addr: "ns1.example.com:53", Role: "primary"},
+			}},
+			want: []ServerEndpoint{
+				{Addr: "ns1.example.com:53", Role: ServerRolePrimary, Transport: TransportUDP},
+				{Addr: "ns2.example.com:53", Role: ServerRoleSecondary, Transport: TransportUDP},
+			},
+		},
+		{
+			name: "first server is primary by default",
+			config: ServerConfig{Servers: []ServerEndpoint{
+				{Addr: "192.0.2.1:53"},
+				{Addr: "192.0.2.2:53"},
+			}},
+			want: []ServerEndpoint{
+				{Addr: "192.0.2.1:53", Role: ServerRolePrimary, Transport: TransportUDP},
+				{Addr: "192.0.2.2:53", Role: ServerRoleSecondary, Transport: TransportUDP},
+			},
+		},
+		{name: "missing address", config: ServerConfig{}, wantErr: true},
+		{name: "invalid port", config: ServerConfig{Addr: "ns1.example.com:0"}, wantErr: true},
+		{
+			name: "two primary servers",
+			config: ServerConfig{Servers: []ServerEndpoint{
+				{Addr: "192.0.2.1:53", Role: "primary"},
+				{Addr: "192.0.2.2:53", Role: "primary"},
+			}},
+			wantErr: true,
+		},
+		{
+			name: "no primary server",
+			config: ServerConfig{Servers: []ServerEndpoint{
+				{Addr: "192.0.2.1:53", Role: "secondary"},
+			}},
+			wantErr: true,
+		},
+		{
+			name:    "unknown role",
+			config:  ServerConfig{Servers: []ServerEndpoint{{Addr: "192.0.2.1:53", Role: "hidden"}}},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.config.servers()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("servers() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("servers() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// unreachableAddr returns a local UDP address nothing listens on.
+func unreachableAddr(t *testing.T) string {
+	t.Helper()
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := conn.LocalAddr().String()
+	conn.Close()
+	return addr
+}
+
+// startTestServer starts a local UDP server with the handler and returns its address. Unlike the
+// default, the server accepts UPDATE messages. The options configure the server before it starts.
+func startTestServer(t *testing.T, handler dns.Handler, options ...func(*dns.Server)) string {
+	t.Helper()
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := &dns.Server{PacketConn: conn, Handler: handler}
+	server.MsgAcceptFunc = func(dns.Header) dns.MsgAcceptAction { return dns.MsgAccept }
+	for _, option := range options {
+		option(server)
+	}
+	go server.ActivateAndServe()
+	t.Cleanup(func() { server.Shutdown() })
+	return conn.LocalAddr().String()
+}
+
+// startStreamTestServer starts local UDP and TCP servers on the same port with the handler and
+// returns their address. Like startTestServer, the servers accept UPDATE messages.
+func startStreamTestServer(t *testing.T, handler dns.Handler) string {
+	t.Helper()
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	listener, err := net.Listen("tcp", conn.LocalAddr().String())
+	if err != nil {
+		conn.Close()
+		t.Fatal(err)
+	}
+	for _, server := range []*dns.Server{
+		{PacketConn: conn, Handler: handler},
+		{Listener: listener, Handler: handler},
+	} {
+		server := server
+		server.MsgAcceptFunc = func(dns.Header) dns.MsgAcceptAction { return dns.MsgAccept }
+		go server.ActivateAndServe()
+		t.Cleanup(func() { server.Shutdown() })
+	}
+	return conn.LocalAddr().String()
+}
+
+// soaReply returns the reply to the query with the SOA record of example.com. and the serial.
+func soaReply(r *dns.Msg, serial uint32) *dns.Msg {
+	m := new(dns.Msg)
+	m.SetReply(r)
+	m.Answer = append(m.Answer, &dns.SOA{
+		Hdr:    dns.RR_Header{Name: "example.com.", Rrtype: dns.TypeSOA, Class: dns.ClassINET, Ttl: 3600},
+		Ns:     "ns1.example.com.",
+		Mbox:   "admin.example.com.",
+		Serial: serial,
+	})
+	return m
+}
+
+// soaHandler answers every query with the SOA record of example.com. and reports the network
+// of each request to the channel.
+func soaHandler(networks chan<- string) dns.HandlerFunc {
+	return func(w dns.ResponseWriter, r *dns.Msg) {
+		networks <- w.RemoteAddr().Network()
+		w.WriteMsg(soaReply(r, 2024010101))
+	}
+}
+
+func TestSecondaryServerFallback(t *testing.T) {
+	var serial atomic.Uint32
+	serial.Store(2024010102)
+	c, _ := newSerialTestClient(t, &serial)
+	secondary := c.servers[0].Addr
+	primary := unreachableAddr(t)
+	c.servers = []ServerEndpoint{
+		{Addr: primary, Role: ServerRolePrimary},
+		{Addr: secondary, Role: ServerRoleSecondary},
+	}
+	ctx := context.Background()
+
+	got, server, err := c.querySerial(ctx)
+	if err != nil {
+		t.Fatalf("querySerial() error = %v", err)
+	}
+	if got != 2024010102 || server.Addr != secondary {
+		t.Errorf("querySerial() = %d from %s, want 2024010102 from the secondary %s", got, server.Addr, secondary)
+	}
+	if _, err := c.querySOA(ctx); err == nil {
+		t.Error("querySOA() must only ask the primary server")
+	}
+
+	c.checkHealth(ctx)
+	health := c.HealthCheck()
+	if !health.ServerReachable || !errors.Is(health.CheckError, ErrPrimaryNotReachable) {
+		t.Errorf("expected a reachable zone with an unreachable primary, got %v, %v", health.ServerReachable, health.CheckError)
+	}
+	if len(health.Servers) != 2 || health.Servers[0].Reachable || !health.Servers[1].Reachable || health.Servers[1].Serial != 2024010102 {
+		t.Errorf("unexpected server health %+v", health.Servers)
+	}
+}
@@ -0,0 +1,158 @@
+package dnsservice
+
+import (
+	"context"
+	"crypto"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// sig0Algorithms maps the supported algorithm names to their DNSSEC algorithm number and key size.
+var sig0Algorithms = map[string]struct {
+	algorithm uint8
+	bits      int
+}{
+	"ed25519":         {dns.ED25519, 256},
+	"ecdsap256sha256": {dns.ECDSAP256SHA256, 256},
+	"ecdsap384sha384": {dns.ECDSAP384SHA384, 384},
+	"rsasha256":       {dns.RSASHA256, 2048},
+	"rsasha512":       {dns.RSASHA512, 2048},
+}
+
+// SIG0Algorithms returns the names of the algorithms SIG(0) keys can be generated with.
+func SIG0Algorithms() []string {
+	return []string{"ed25519", "ecdsap256sha256", "ecdsap384sha384", "rsasha256", "rsasha512"}
+}
+
+// SIG0Key is a key pair that signs dynamic updates with SIG(0) (RFC 2931). Unlike TSIG, the
+// server only knows the public KEY record, so DNSify does not need the secret of the zone and
+// the server can grant the key narrowly scoped update-policy rules.
+type SIG0Key struct {
+	Key    *dns.KEY
+	signer crypto.Signer
+}
+
+// GenerateSIG0Key generates a new key pair for the key name with one of SIG0Algorithms.
+func GenerateSIG0Key(name, algorithm string) (*SIG0Key, error) {
+	alg, ok := sig0Algorithms[strings.ToLower(algorithm)]
+	if !ok {
+		return nil, fmt.Errorf("unsupported SIG(0) algorithm %q, use one of %s", algorithm, strings.Join(SIG0Algorithms(), ", "))
+	}
+	if !isValidDomain(name) {
+		return nil, fmt.Errorf("invalid key name %q", name)
+	}
+	key := &dns.KEY{DNSKEY: dns.DNSKEY{
+		Hdr:       dns.RR_Header{Name: dns.Fqdn(strings.ToLower(name)), Rrtype: dns.TypeKEY, Class: dns.ClassINET, Ttl: 3600},
+		Flags:     512, // host key, the name type dnssec-keygen -n HOST uses
+		Protocol:  3,
+		Algorithm: alg.algorithm,
+	}}
+	private, err := key.Generate(alg.bits)
+	if err != nil {
+		return nil, err
+	}
+	return newSIG0Key(key, private)
+}
+
+// LoadSIG0Key reads a key pair in the format of dnssec-keygen. privateFile is the path of the
+// private key file, e.g. "Kdnsify.example.com.+015+12345.private", the public KEY record is read
+// from the .key file next to it.
+func LoadSIG0Key(privateFile string) (*SIG0Key, error) {
+	publicFile := strings.TrimSuffix(privateFile, ".private") + ".key"
+	public, err := os.Open(publicFile)
+	if err != nil {
+		return nil, fmt.Errorf("SIG(0) key: %w", err)
+	}
+	defer public.Close()
+	parser := dns.NewZoneParser(public, "", publicFile)
+	rr, ok := parser.Next()
+	if err := parser.Err(); err != nil {
+		return nil, fmt.Errorf("SIG(0) key: %w", err)
+	}
+	key, isKey := rr.(*dns.KEY)
+	if !ok || !isKey {
+		return nil, fmt.Errorf("SIG(0) key: %s does not contain a KEY record", publicFile)
+	}
+
+	file, err := os.Open(privateFile)
+	if err != nil {
+		return nil, fmt.Errorf("SIG(0) key: %w", err)
+	}
+	defer file.Close()
+	private, err := key.ReadPrivateKey(file, privateFile)
+	if err != nil {
+		return nil, fmt.Errorf("SIG(0) key: %w", err)
+	}
+	return newSIG0Key(key, private)
+}
+
+func newSIG0Key(key *dns.KEY, private crypto.PrivateKey) (*SIG0Key, error) {
+	signer, ok := private.(crypto.Signer)
+	if !ok {
+		return nil, errors.New("SIG(0) key: private key can't sign messages")
+	}
+	return &SIG0Key{Key: key, signer: signer}, nil
+}
+
+// FileName returns the base name of the key files as used by dnssec-keygen, without extension.
+func (k *SIG0Key) FileName() string {
+	return fmt.Sprintf("K%s+%03d+%05d", k.Key.Hdr.Name, k.Key.Algorithm, k.Key.KeyTag())
+}
+
+// WriteFiles writes the public and the private key to dir in the format of dnssec-keygen and
+// returns the path of the private key file.
+func (k *SIG0Key) WriteFiles(dir string) (string, error) {
+	base := filepath.Join(dir, k.FileName())
+	if err := os.WriteFile(base+".key", []byte(k.Key.String()+"\n"), 0o644); err != nil {
+		return "", err
+	}
+	if err := os.WriteFile(base+".private", []byte(k.Key.PrivateKeyString(k.signer)), 0o600); err != nil {
+		return "", err
+	}
+	return base + ".private", nil
+}
+
+// sign returns the wire format of the message with a SIG(0) record appended.
+func (k *SIG0Key) sign(msg *dns.Msg) ([]byte, error) {
+	now := time.Now()
+	sig := &dns.SIG{RRSIG: dns.RRSIG{
+		Algorithm:  k.Key.Algorithm,
+		KeyTag:     k.Key.KeyTag(),
+		SignerName: k.Key.Hdr.Name,
+		Inception:  uint32(now.Add(-5 * time.Minute).Unix()),
+		Expiration: uint32(now.Add(5 * time.Minute).Unix()),
+	}}
+	return sig.Sign(k.signer, msg)
+}
+
+// exchangeSigned sends the wire format of a signed message to the server. The dns package can't
+// send signed wire data, so the message is written to a connection of the client directly.
+func exchangeSigned(ctx context.Context, client *dns.Client, buf []byte, addr string) (*dns.Msg, error) {
+	conn, err := client.DialContext(ctx, addr)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(5 * time.Second)
+	}
+	conn.SetDeadline(deadline)
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	if _, err := conn.Write(buf); err != nil {
+		return nil, err
+	}
+	reply, err := conn.ReadMsg()
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+	return reply, err
+}
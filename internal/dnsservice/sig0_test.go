@@ -0,0 +1,119 @@
+package dnsservice
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+func TestSIG0KeyRoundTrip(t *testing.T) {
+	for _, algorithm := range SIG0Algorithms() {
+		t.Run(algorithm, func(t *testing.T) {
+			generated, err := GenerateSIG0Key("dnsify.example.com", algorithm)
+			if err != nil {
+				t.Fatalf("GenerateSIG0Key() error = %v", err)
+			}
+			privateFile, err := generated.WriteFiles(t.TempDir())
+			if err != nil {
+				t.Fatalf("WriteFiles() error = %v", err)
+			}
+			key, err := LoadSIG0Key(privateFile)
+			if err != nil {
+				t.Fatalf("LoadSIG0Key() error = %v", err)
+			}
+			if key.Key.KeyTag() != generated.Key.KeyTag() {
+				t.Fatalf("expected the loaded key to match the generated key")
+			}
+
+			msg := new(dns.Msg)
+			msg.SetUpdate("example.com.")
+			msg.Insert([]dns.RR{&dns.A{Hdr: dns.RR_Header{Name: "www.example.com.", Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: 300}, A: net.IPv4(192, 0, 2, 1)}})
+			buf, err := key.sign(msg)
+			if err != nil {
+				t.Fatalf("sign() error = %v", err)
+			}
+			signed := new(dns.Msg)
+			if err := signed.Unpack(buf); err != nil {
+				t.Fatal(err)
+			}
+			sig, ok := signed.Extra[len(signed.Extra)-1].(*dns.SIG)
+			if !ok {
+				t.Fatalf("expected a SIG record, got %v", signed.Extra)
+			}
+			if err := sig.Verify(generated.Key, buf); err != nil {
+				t.Errorf("Verify() error = %v", err)
+			}
+		})
+	}
+}
+
+func TestGenerateSIG0KeyInvalid(t *testing.T) {
+	if _, err := GenerateSIG0Key("dnsify.example.com", "hmac-sha256"); err == nil {
+		t.Error("expected an error for an unsupported algorithm")
+	}
+	if _, err := GenerateSIG0Key("not a name", "ed25519"); err == nil {
+		t.Error("expected an error for an invalid key name")
+	}
+}
+
+func TestExchangeSignsUpdatesWithSIG0(t *testing.T) {
+	key, err := GenerateSIG0Key("dnsify.example.com", "ed25519")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, updates := newUpdateTestClient(t)
+	c.sig0 = key
+
+	record := NewRecord("www.example.com.", 300, &ARecord{IP: "192.0.2.1"})
+	if err := c.AddRecord(context.Background(), record); err != nil {
+		t.Fatalf("AddRecord() error = %v", err)
+	}
+	msg := <-updates
+	sig, ok := msg.Extra[len(msg.Extra)-1].(*dns.SIG)
+	if !ok {
+		t.Fatalf("expected the update to be signed with SIG(0), got %v", msg.Extra)
+	}
+	if msg.IsTsig() != nil {
+		t.Error("expected no TSIG record in a SIG(0) signed update")
+	}
+	if sig.SignerName != "dnsify.example.com." || sig.KeyTag != key.Key.KeyTag() {
+		t.Errorf("unexpected signer %s/%d", sig.SignerName, sig.KeyTag)
+	}
+}
+
+func TestSIG0RetriesTruncatedRepliesOverTCP(t *testing.T) {
+	key, err := GenerateSIG0Key("dnsify.example.com", "ed25519")
+	if err != nil {
+		t.Fatal(err)
+	}
+	networks := make(chan string, 10)
+	addr := startStreamTestServer(t, dns.HandlerFunc(func(w dns.ResponseWriter, r *dns.Msg) {
+		network := w.RemoteAddr().Network()
+		networks <- network
+		m := new(dns.Msg)
+		m.SetReply(r)
+		m.Truncated = network == "udp"
+		w.WriteMsg(m)
+	}))
+	c := &Client{
+		client:  new(dns.Client),
+		zone:    "example.com.",
+		servers: []ServerEndpoint{{Addr: addr, Role: ServerRolePrimary, Transport: TransportUDP}},
+		sig0:    key,
+	}
+
+	msg := new(dns.Msg)
+	msg.SetUpdate("example.com.")
+	reply, err := c.exchange(context.Background(), msg)
+	if err != nil {
+		t.Fatalf("exchange() error = %v", err)
+	}
+	if reply.Truncated {
+		t.Error("expected the complete reply of the TCP retry")
+	}
+	if first, second := <-networks, <-networks; first != "udp" || second != "tcp" {
+		t.Errorf("update sent over %s and %s, want udp and tcp", first, second)
+	}
+}
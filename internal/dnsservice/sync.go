@@ -0,0 +1,172 @@
+package dnsservice
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"slices"
+
+	"github.com/miekg/dns"
+)
+
+// SyncMode describes how a synchronization obtained the zone from the DNS server.
+type SyncMode string
+
+const (
+	// SyncModeAXFR means the whole zone was transferred.
+	SyncModeAXFR SyncMode = "AXFR"
+	// SyncModeIXFR means only the changes since the cached serial were transferred and applied.
+	SyncModeIXFR SyncMode = "IXFR"
+	// SyncModeUnchanged means the SOA serial did not change, so no transfer was necessary.
+	SyncModeUnchanged SyncMode = "unchanged"
+)
+
+var (
+	errMissingSOA        = errors.New("zone transfer did not start with a SOA record")
+	errMalformedIXFR     = errors.New("malformed IXFR response")
+	errIXFRWithoutDiff   = errors.New("IXFR response has no changes for a new serial")
+	errSerialNotAnswered = errors.New("SOA query returned no answer")
+)
+
+// syncRecords brings the cache up to date with the DNS server. It first compares the SOA serial
+// of the server with the cached one and skips the transfer if they match. Otherwise it requests an
+// incremental transfer (IXFR) and falls back to a full transfer (AXFR) if that fails.
+func (c *Client) syncRecords(ctx context.Context) (SyncMode, error) {
+	c.mutex.RLock()
+	cached := c.soa
+	c.mutex.RUnlock()
+
+	if cached == nil {
+		return SyncModeAXFR, c.fetchAndCacheRecords(ctx)
+	}
+
+	serial, server, err := c.querySerial(ctx)
+	if err != nil {
+		slog.Warn("Failed to query SOA serial, falling back to a full zone transfer", "error", err.Error())
+		return SyncModeAXFR, c.fetchAndCacheRecords(ctx)
+	}
+	if serial == cached.Serial {
+		return SyncModeUnchanged, nil
+	}
+	if server.Role != ServerRolePrimary && isBehind(serial, cached.Serial) {
+		slog.Debug("Secondary server is behind the cached zone", "zone", c.zone, "server", server.Addr, "serial", serial, "cached", cached.Serial)
+		return SyncModeUnchanged, nil
+	}
+
+	mode, err := c.incrementalSync(ctx, cached, server)
+	if err != nil {
+		slog.Warn("Incremental zone transfer failed, falling back to a full zone transfer", "error", err.Error())
+		return SyncModeAXFR, c.fetchAndCacheRecords(ctx)
+	}
+	return mode, nil
+}
+
+// querySerial returns the current SOA serial of the zone along with the server that reported it,
+// which is the primary server unless it is down.
+func (c *Client) querySerial(ctx context.Context) (uint32, ServerEndpoint, error) {
+	var serial uint32
+	var answered ServerEndpoint
+	err := c.withServers(ctx, func(server ServerEndpoint) error {
+		soa, err := c.querySOAFrom(ctx, server)
+		if err != nil {
+			return err
+		}
+		serial, answered = soa.Serial, server
+		return nil
+	})
+	return serial, answered, err
+}
+
+// querySOA returns the current SOA record of the zone as reported by the primary server, which
+// is the one updates are applied to.
+func (c *Client) querySOA(ctx context.Context) (*dns.SOA, error) {
+	return c.querySOAFrom(ctx, c.primary())
+}
+
+// incrementalSync requests the changes since the cached SOA from the server via IXFR and
+// applies them to the cache.
+// Servers that cannot serve the delta may answer with the full zone, in which case the cache is
+// replaced and SyncModeAXFR is reported.
+func (c *Client) incrementalSync(ctx context.Context, cached *dns.SOA, server ServerEndpoint) (SyncMode, error) {
+	m := new(dns.Msg)
+	m.SetIxfr(c.zone, cached.Serial, cached.Ns, cached.Mbox)
+
+	var rrs []dns.RR
+	err := c.withTSIG(func(key TSIGKey) (err error) {
+		rrs, err = transferIn(ctx, c.dnsClient(server, true), m, server.Addr, key)
+		return err
+	})
+	if err != nil {
+		return "", err
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	records, soa, full, err := applyIXFR(c.cache, cached.Serial, rrs)
+	if err != nil {
+		return "", err
+	}
+	c.cache = records
+	c.soa = soa
+	if full {
+		return SyncModeAXFR, nil
+	}
+	return SyncModeIXFR, nil
+}
+
+// applyIXFR applies an IXFR response as described in RFC 1995 to the cached records of the serial
+// and returns the resulting records along with the new SOA. A response consisting of a single SOA,
+// or of two SOAs without difference sequences, means the zone is up to date. If it reports another
+// serial, the changes are missing and errIXFRWithoutDiff is returned, so the caller transfers the
+// full zone. If the response is a full zone (AXFR style), full is true and the returned records
+// replace the cache entirely. Otherwise the response consists of difference sequences, each made of
+// the old SOA followed by the deleted records and the new SOA followed by the added records.
+func applyIXFR(cache []Record, serial uint32, rrs []dns.RR) (records []Record, soa *dns.SOA, full bool, err error) {
+	if len(rrs) == 0 {
+		return nil, nil, false, errMissingSOA
+	}
+	soa, ok := rrs[0].(*dns.SOA)
+	if !ok {
+		return nil, nil, false, errMissingSOA
+	}
+	if len(rrs) <= 2 && rrs[len(rrs)-1].Header().Rrtype == dns.TypeSOA {
+		if soa.Serial != serial {
+			return nil, nil, false, errIXFRWithoutDiff
+		}
+		return cache, soa, false, nil
+	}
+	if _, ok := rrs[1].(*dns.SOA); !ok {
+		return recordsFromRRs(rrs), soa, true, nil
+	}
+
+	last, ok := rrs[len(rrs)-1].(*dns.SOA)
+	if !ok || last.Serial != soa.Serial {
+		return nil, nil, false, errMalformedIXFR
+	}
+
+	records = slices.Clone(cache)
+	deleting := false
+	for _, rr := range rrs[1 : len(rrs)-1] {
+		if _, ok := rr.(*dns.SOA); ok {
+			// every SOA starts a new part of a difference sequence, alternating between deletions and additions
+			deleting = !deleting
+			continue
+		}
+		record, ok := recordFromRR(rr)
+		if !ok {
+			continue
+		}
+		// The cache may already reflect changes made by this client, so deletions of missing
+		// records are ignored and additions of existing records only update them.
+		i := slices.IndexFunc(records, func(r Record) bool { return SameRecord(r, record) })
+		switch {
+		case deleting && i >= 0:
+			records = slices.Delete(records, i, i+1)
+		case !deleting && i >= 0:
+			records[i] = record
+		case !deleting:
+			records = append(records, record)
+		}
+	}
+	return records, soa, false, nil
+}
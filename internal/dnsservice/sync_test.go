@@ -0,0 +1,98 @@
+package dnsservice
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+func mustRRs(t *testing.T, lines ...string) []dns.RR {
+	t.Helper()
+	rrs := make([]dns.RR, 0, len(lines))
+	for _, line := range lines {
+		rr, err := dns.NewRR(line)
+		if err != nil {
+			t.Fatalf("dns.NewRR(%q) error = %v", line, err)
+		}
+		rrs = append(rrs, rr)
+	}
+	return rrs
+}
+
+func TestApplyIXFR(t *testing.T) {
+	cache := []Record{
+		NewRecord("www.example.com.", 3600, &ARecord{IP: "192.0.2.1"}),
+		NewRecord("mail.example.com.", 3600, &ARecord{IP: "192.0.2.10"}),
+	}
+
+	t.Run("Up to date", func(t *testing.T) {
+		rrs := mustRRs(t, "example.com. 3600 IN SOA ns1.example.com. admin.example.com. 1 3600 600 86400 300")
+		records, soa, full, err := applyIXFR(cache, 1, rrs)
+		if err != nil || full || soa.Serial != 1 || len(records) != len(cache) {
+			t.Errorf("applyIXFR() = %v, %v, %v, %v", records, soa, full, err)
+		}
+		rrs = append(rrs, rrs[0])
+		if records, soa, full, err := applyIXFR(cache, 1, rrs); err != nil || full || soa.Serial != 1 || len(records) != len(cache) {
+			t.Errorf("applyIXFR() = %v, %v, %v, %v", records, soa, full, err)
+		}
+	})
+
+	t.Run("New serial without changes", func(t *testing.T) {
+		soa := "example.com. 3600 IN SOA ns1.example.com. admin.example.com. 2 3600 600 86400 300"
+		for _, rrs := range [][]dns.RR{mustRRs(t, soa), mustRRs(t, soa, soa)} {
+			if _, _, _, err := applyIXFR(cache, 1, rrs); !errors.Is(err, errIXFRWithoutDiff) {
+				t.Errorf("applyIXFR(%v) error = %v, want %v", rrs, err, errIXFRWithoutDiff)
+			}
+		}
+	})
+
+	t.Run("Incremental", func(t *testing.T) {
+		rrs := mustRRs(t,
+			"example.com. 3600 IN SOA ns1.example.com. admin.example.com. 3 3600 600 86400 300",
+			"example.com. 3600 IN SOA ns1.example.com. admin.example.com. 1 3600 600 86400 300",
+			"www.example.com. 3600 IN A 192.0.2.1",
+			"example.com. 3600 IN SOA ns1.example.com. admin.example.com. 2 3600 600 86400 300",
+			"www.example.com. 3600 IN A 192.0.2.2",
+			"example.com. 3600 IN SOA ns1.example.com. admin.example.com. 2 3600 600 86400 300",
+			"example.com. 3600 IN SOA ns1.example.com. admin.example.com. 3 3600 600 86400 300",
+			"mail.example.com. 300 IN A 192.0.2.10",
+			"example.com. 3600 IN SOA ns1.example.com. admin.example.com. 3 3600 600 86400 300",
+		)
+		records, soa, full, err := applyIXFR(cache, 1, rrs)
+		if err != nil {
+			t.Fatalf("applyIXFR() error = %v", err)
+		}
+		if full || soa.Serial != 3 {
+			t.Errorf("applyIXFR() full = %v, serial = %d; want false, 3", full, soa.Serial)
+		}
+		if len(records) != 2 {
+			t.Fatalf("applyIXFR() returned %d records; want 2: %v", len(records), records)
+		}
+		if records[0].Name != "mail.example.com." || records[0].TTL != 300 {
+			t.Errorf("expected the mail record to be updated in place, got %v", records[0])
+		}
+		if records[1].Name != "www.example.com." || records[1].Data.Value() != "192.0.2.2" {
+			t.Errorf("expected www to resolve to 192.0.2.2, got %v", records[1])
+		}
+	})
+
+	t.Run("Full zone", func(t *testing.T) {
+		rrs := mustRRs(t,
+			"example.com. 3600 IN SOA ns1.example.com. admin.example.com. 5 3600 600 86400 300",
+			"www.example.com. 3600 IN A 192.0.2.5",
+			"example.com. 3600 IN SOA ns1.example.com. admin.example.com. 5 3600 600 86400 300",
+		)
+		records, soa, full, err := applyIXFR(cache, 1, rrs)
+		if err != nil || !full || soa.Serial != 5 || len(records) != 1 {
+			t.Errorf("applyIXFR() = %v, %v, %v, %v", records, soa, full, err)
+		}
+	})
+
+	t.Run("Malformed", func(t *testing.T) {
+		rrs := mustRRs(t, "www.example.com. 3600 IN A 192.0.2.5")
+		if _, _, _, err := applyIXFR(cache, 1, rrs); err == nil {
+			t.Error("applyIXFR() without leading SOA should fail")
+		}
+	})
+}
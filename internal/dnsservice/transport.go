@@ -0,0 +1,168 @@
+package dnsservice
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+const (
+	TransportUDP = "udp"
+	TransportTCP = "tcp"
+	// TransportDoT is DNS over TLS (RFC 7858).
+	TransportDoT = "dot"
+)
+
+// errPinMismatch is returned by the TLS handshake if no certificate of the server matches a pin.
+var errPinMismatch = errors.New("DoT: no certificate of the server matches a pinned key")
+
+// TLSConfig configures the TLS connections to a server with the DoT transport.
+type TLSConfig struct {
+	// CAFile is a PEM bundle of the CAs the server certificate must be issued by. Defaults to the
+	// system roots.
+	CAFile string `mapstructure:"caFile"`
+	// ServerName is the name the server certificate is verified against. Defaults to the host of
+	// the server address.
+	ServerName string `mapstructure:"serverName"`
+	// Pins are base64 encoded SHA-256 digests of the SubjectPublicKeyInfo of certificates (RFC 7858
+	// section 4.2). One of the certificates of the server must match a pin. Without a CAFile,
+	// matching a pin is sufficient and the certificate chain is not verified.
+	Pins []string `mapstructure:"pins"`
+	// CertFile and KeyFile are a PEM encoded client certificate and key for servers that
+	// authenticate their clients with TLS.
+	CertFile string `mapstructure:"certFile"`
+	KeyFile  string `mapstructure:"keyFile"`
+}
+
+// normalizeTransport validates the transport of the server and adds the default port of the
+// transport to the address if it has none. The TLS configuration of DoT servers is loaded here, so
+// missing or invalid certificate files are reported with the rest of the configuration.
+func (server *ServerEndpoint) normalizeTransport() error {
+	server.Transport = strings.ToLower(server.Transport)
+	port := "53"
+	switch server.Transport {
+	case "":
+		server.Transport = TransportUDP
+	case TransportUDP, TransportTCP:
+	case TransportDoT:
+		port = "853"
+	default:
+		return fmt.Errorf("server %s: transport must be %q, %q or %q", server.Addr, TransportUDP, TransportTCP, TransportDoT)
+	}
+	if _, _, err := net.SplitHostPort(server.Addr); err != nil {
+		server.Addr = net.JoinHostPort(strings.Trim(server.Addr, "[]"), port)
+	}
+	if server.Transport != TransportDoT {
+		return nil
+	}
+	config, err := server.TLS.load(server.Addr)
+	if err != nil {
+		return fmt.Errorf("server %s: %w", server.Addr, err)
+	}
+	server.tlsConfig = config
+	return nil
+}
+
+// load builds the TLS configuration for a DoT server at addr.
+func (c TLSConfig) load(addr string) (*tls.Config, error) {
+	config := &tls.Config{MinVersion: tls.VersionTLS12, ServerName: c.ServerName}
+	if config.ServerName == "" {
+		config.ServerName, _, _ = net.SplitHostPort(addr)
+	}
+	if c.CAFile != "" {
+		pem, err := os.ReadFile(c.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("DoT CA bundle: %w", err)
+		}
+		config.RootCAs = x509.NewCertPool()
+		if !config.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("DoT CA bundle: %s contains no certificates", c.CAFile)
+		}
+	}
+	if c.CertFile != "" || c.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("DoT client certificate: %w", err)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	if len(c.Pins) == 0 {
+		return config, nil
+	}
+
+	pins := make(map[string]bool, len(c.Pins))
+	for _, pin := range c.Pins {
+		digest, err := base64.StdEncoding.DecodeString(pin)
+		if err != nil || len(digest) != sha256.Size {
+			return nil, fmt.Errorf("DoT pin %q is not a base64 encoded SHA-256 digest", pin)
+		}
+		pins[base64.StdEncoding.EncodeToString(digest)] = true
+	}
+	// Pinning alone authenticates the server, the chain is only verified against a CA bundle.
+	config.InsecureSkipVerify = c.CAFile == ""
+	config.VerifyConnection = func(state tls.ConnectionState) error {
+		for _, cert := range state.PeerCertificates {
+			if pins[pinOf(cert)] {
+				return nil
+			}
+		}
+		return errPinMismatch
+	}
+	return config, nil
+}
+
+// pinOf returns the base64 encoded SHA-256 digest of the SubjectPublicKeyInfo of the certificate.
+func pinOf(cert *x509.Certificate) string {
+	digest := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	return base64.StdEncoding.EncodeToString(digest[:])
+}
+
+// dnsClient returns a client for the transport of the server with the TSIG secrets and timeouts
+// of the base client. Zone transfers need a stream, so stream selects TCP for UDP servers.
+func (c *Client) dnsClient(server ServerEndpoint, stream bool) *dns.Client {
+	client := &dns.Client{
+		Net:        server.Transport,
+		TsigSecret: c.client.TsigSecret,
+		Timeout:    c.client.Timeout,
+	}
+	switch server.Transport {
+	case TransportDoT:
+		client.Net = "tcp-tls"
+		client.TLSConfig = server.tlsConfig
+	case TransportTCP:
+	default:
+		client.Net = TransportUDP
+		if stream {
+			client.Net = TransportTCP
+		}
+	}
+	return client
+}
+
+// tsigMACSizes maps the TSIG algorithms to the size of their MAC in bytes.
+var tsigMACSizes = map[string]int{
+	dns.HmacSHA1:   20,
+	dns.HmacSHA224: 28,
+	dns.HmacSHA256: 32,
+	dns.HmacSHA384: 48,
+	dns.HmacSHA512: 64,
+}
+
+// needsStream reports whether the message does not fit into a UDP message without EDNS0, as is
+// the case for updates of many records. The MAC of a TSIG record that is yet to be signed is
+// taken into account.
+func needsStream(msg *dns.Msg) bool {
+	size := msg.Len()
+	if tsig := msg.IsTsig(); tsig != nil && tsig.MAC == "" {
+		size += tsigMACSizes[tsig.Algorithm]
+	}
+	return size > dns.MinMsgSize
+}
@@ -0,0 +1,146 @@
+package dnsservice
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// newDoTTestServer starts a DNS over TLS server with a self-signed certificate for 127.0.0.1 and
+// returns its address and certificate.
+func newDoTTestServer(t *testing.T) (string, *x509.Certificate) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IPAddresses:           []net.IP{net.IPv4(127, 0, 0, 1)},
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	listener, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{
+		Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := &dns.Server{Listener: listener, Net: "tcp-tls", Handler: soaHandler(make(chan string, 10))}
+	go server.ActivateAndServe()
+	t.Cleanup(func() { server.Shutdown() })
+	return listener.Addr().String(), cert
+}
+
+func TestDoTTransport(t *testing.T) {
+	addr, cert := newDoTTestServer(t)
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	if err := os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw}), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	otherPin := strings.Repeat("A", 43) + "="
+
+	tests := []struct {
+		name    string
+		tls     TLSConfig
+		wantErr bool
+	}{
+		{name: "CA bundle", tls: TLSConfig{CAFile: caFile}},
+		{name: "pinned key", tls: TLSConfig{Pins: []string{pinOf(cert)}}},
+		{name: "CA bundle and pinned key", tls: TLSConfig{CAFile: caFile, Pins: []string{otherPin, pinOf(cert)}}},
+		{name: "untrusted certificate", tls: TLSConfig{}, wantErr: true},
+		{name: "pin mismatch", tls: TLSConfig{Pins: []string{otherPin}}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := ServerEndpoint{Addr: addr, Role: ServerRolePrimary, Transport: TransportDoT, TLS: tt.tls}
+			if err := server.normalizeTransport(); err != nil {
+				t.Fatal(err)
+			}
+			c := &Client{client: new(dns.Client), zone: "example.com.", servers: []ServerEndpoint{server}}
+			soa, err := c.querySOA(context.Background())
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("querySOA() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && soa.Serial != 2024010101 {
+				t.Errorf("querySOA() serial = %d", soa.Serial)
+			}
+		})
+	}
+}
+
+func TestNormalizeTransport(t *testing.T) {
+	server := ServerEndpoint{Addr: "ns1.example.com", Transport: "DoT"}
+	if err := server.normalizeTransport(); err != nil {
+		t.Fatal(err)
+	}
+	if server.Addr != "ns1.example.com:853" || server.Transport != TransportDoT || server.tlsConfig.ServerName != "ns1.example.com" {
+		t.Errorf("unexpected server %+v", server)
+	}
+
+	server = ServerEndpoint{Addr: "192.0.2.1", Transport: "quic"}
+	if err := server.normalizeTransport(); err == nil {
+		t.Error("expected an error for an unsupported transport")
+	}
+	server = ServerEndpoint{Addr: "192.0.2.1", Transport: TransportDoT, TLS: TLSConfig{Pins: []string{"c2hvcnQ="}}}
+	if err := server.normalizeTransport(); err == nil {
+		t.Error("expected an error for an invalid pin")
+	}
+}
+
+func TestLargeUpdatesUseTCP(t *testing.T) {
+	networks := make(chan string, 10)
+	addr := startStreamTestServer(t, soaHandler(networks))
+
+	keys := []TSIGKey{{Name: "test.", Secret: "c2VjcmV0", Algorithm: dns.HmacSHA512, Role: TSIGRolePrimary}}
+	c := &Client{
+		client:  &dns.Client{TsigSecret: tsigSecrets(keys)},
+		zone:    "example.com.",
+		servers: []ServerEndpoint{{Addr: addr, Role: ServerRolePrimary, Transport: TransportUDP}},
+		keys:    keys,
+	}
+
+	small := new(dns.Msg)
+	small.SetUpdate("example.com.")
+	small.Insert([]dns.RR{&dns.TXT{Hdr: dns.RR_Header{Name: "a.example.com.", Rrtype: dns.TypeTXT, Class: dns.ClassINET, Ttl: 300}, Txt: []string{"small"}}})
+	large := small.Copy()
+	large.Insert([]dns.RR{&dns.TXT{Hdr: dns.RR_Header{Name: "b.example.com.", Rrtype: dns.TypeTXT, Class: dns.ClassINET, Ttl: 300}, Txt: []string{strings.Repeat("x", 200), strings.Repeat("y", 200)}}})
+
+	for _, tt := range []struct {
+		msg  *dns.Msg
+		want string
+	}{{small, "udp"}, {large, "tcp"}} {
+		if _, err := c.exchange(context.Background(), tt.msg); err != nil {
+			t.Fatalf("exchange() error = %v", err)
+		}
+		if got := <-networks; got != tt.want {
+			t.Errorf("message of %d bytes sent over %s, want %s", tt.msg.Len(), got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,172 @@
+package dnsservice
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// ErrTSIGRejected is returned if the DNS server rejected the TSIG signature of a message,
+// e.g. because it does not know the key (BADKEY) or the secret differs (BADSIG).
+var ErrTSIGRejected = errors.New("TSIG key rejected by the server")
+
+const (
+	TSIGRolePrimary   = "primary"
+	TSIGRoleSecondary = "secondary"
+)
+
+// tsigAlgorithms maps the configurable algorithm names to the TSIG algorithm names.
+var tsigAlgorithms = map[string]string{
+	"hmac-sha1":   dns.HmacSHA1,
+	"hmac-sha224": dns.HmacSHA224,
+	"hmac-sha256": dns.HmacSHA256,
+	"hmac-sha384": dns.HmacSHA384,
+	"hmac-sha512": dns.HmacSHA512,
+}
+
+// TSIGKey is a named TSIG key. Messages are signed with the primary key of a zone. Secondary
+// keys are used if the server rejects the primary key, which allows rolling the secrets on
+// the server without downtime: configure the new key as primary and the old one as secondary
+// until the server knows the new key, then remove the old one.
+type TSIGKey struct {
+	Name   string `mapstructure:"name"`
+	Secret string `mapstructure:"secret"`
+	// Algorithm is the HMAC algorithm of the key, e.g. "hmac-sha512". Defaults to "hmac-sha256".
+	Algorithm string `mapstructure:"algorithm"`
+	// Role is either "primary" or "secondary". Defaults to primary for the first key and to
+	// secondary for all others.
+	Role string `mapstructure:"role"`
+}
+
+// tsigKeys returns the normalized TSIG keys of the server, primary key first. The single
+// TsigKey/TsigSecret pair is used if no named keys are configured. TSIG is optional if updates
+// are signed with a SIG(0) key, zone transfers are unsigned then.
+func (config ServerConfig) tsigKeys() ([]TSIGKey, error) {
+	keys := config.TsigKeys
+	if len(keys) == 0 {
+		if config.Sig0KeyFile != "" && config.TsigKey == "" && config.TsigSecret == "" {
+			return nil, nil
+		}
+		if config.TsigKey == "" || config.TsigSecret == "" {
+			return nil, fmt.Errorf("TSIGKey and TSIGSecret must be specified")
+		}
+		keys = []TSIGKey{{Name: config.TsigKey, Secret: config.TsigSecret, Algorithm: config.TsigAlgorithm}}
+	}
+
+	var primary TSIGKey
+	secondaries := make([]TSIGKey, 0, len(keys))
+	for i, key := range keys {
+		if key.Name == "" || key.Secret == "" {
+			return nil, fmt.Errorf("TSIG key %d: name and secret must be specified", i)
+		}
+		key.Name = dns.Fqdn(strings.ToLower(key.Name))
+
+		algorithm := strings.ToLower(strings.TrimSuffix(key.Algorithm, "."))
+		if algorithm == "" {
+			algorithm = "hmac-sha256"
+		}
+		var ok bool
+		if key.Algorithm, ok = tsigAlgorithms[algorithm]; !ok {
+			return nil, fmt.Errorf("TSIG key %s: unsupported algorithm %q", key.Name, algorithm)
+		}
+
+		switch strings.ToLower(key.Role) {
+		case "":
+			if i == 0 && !hasPrimary(keys) {
+				key.Role = TSIGRolePrimary
+			} else {
+				key.Role = TSIGRoleSecondary
+			}
+		case TSIGRolePrimary, TSIGRoleSecondary:
+			key.Role = strings.ToLower(key.Role)
+		default:
+			return nil, fmt.Errorf("TSIG key %s: role must be %q or %q", key.Name, TSIGRolePrimary, TSIGRoleSecondary)
+		}
+
+		if key.Role == TSIGRolePrimary {
+			if primary.Name != "" {
+				return nil, fmt.Errorf("TSIG keys %s and %s are both primary keys", primary.Name, key.Name)
+			}
+			primary = key
+			continue
+		}
+		secondaries = append(secondaries, key)
+	}
+	if primary.Name == "" {
+		return nil, fmt.Errorf("one TSIG key must be the primary key")
+	}
+	return append([]TSIGKey{primary}, secondaries...), nil
+}
+
+func hasPrimary(keys []TSIGKey) bool {
+	for _, key := range keys {
+		if strings.EqualFold(key.Role, TSIGRolePrimary) {
+			return true
+		}
+	}
+	return false
+}
+
+// tsigSecrets returns the secrets of the keys by key name, as expected by the dns package.
+func tsigSecrets(keys []TSIGKey) map[string]string {
+	secrets := make(map[string]string, len(keys))
+	for _, key := range keys {
+		secrets[key.Name] = key.Secret
+	}
+	return secrets
+}
+
+// tsigRejection returns an error wrapping ErrTSIGRejected if the reply or the error show that the
+// server rejected the TSIG signature of the request, and nil otherwise.
+func tsigRejection(reply *dns.Msg, err error) error {
+	if reply != nil {
+		if tsig := reply.IsTsig(); tsig != nil {
+			switch tsig.Error {
+			case dns.RcodeBadSig, dns.RcodeBadKey, dns.RcodeBadTime:
+				return fmt.Errorf("%w: %s", ErrTSIGRejected, dns.RcodeToString[int(tsig.Error)])
+			}
+		}
+	}
+	// zone transfers drop replies that fail the verification, which is the case for
+	// rejections since the server does not sign them
+	if reply == nil && (errors.Is(err, dns.ErrSig) || errors.Is(err, dns.ErrTime)) {
+		return fmt.Errorf("%w: %v", ErrTSIGRejected, err)
+	}
+	return nil
+}
+
+// withTSIG runs op with the TSIG keys of the zone, primary key first, until op succeeds or fails
+// for another reason than a rejected key. The key in use and rejections of the primary key are
+// reported in the health state. Without TSIG keys, op runs once with the zero key.
+func (c *Client) withTSIG(op func(key TSIGKey) error) error {
+	if len(c.keys) == 0 {
+		return op(TSIGKey{})
+	}
+	var rejections []error
+	for _, key := range c.keys {
+		err := op(key)
+		if errors.Is(err, ErrTSIGRejected) {
+			slog.Warn("TSIG key rejected by the server", "zone", c.zone, "key", key.Name, "error", err.Error())
+			rejections = append(rejections, fmt.Errorf("%s key %s: %w", key.Role, key.Name, err))
+			continue
+		}
+		c.setTSIGHealth(key.Name, errors.Join(rejections...))
+		return err
+	}
+	err := errors.Join(rejections...)
+	c.setTSIGHealth("", err)
+	return err
+}
+
+func (c *Client) setTSIGHealth(key string, rejected error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if key != "" && key != c.healthState.TSIGKey {
+		slog.Info("Using TSIG key", "zone", c.zone, "key", key)
+	}
+	c.healthState.TSIGKey = key
+	c.healthState.TSIGError = rejected
+}
@@ -0,0 +1,145 @@
+package dnsservice
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+func TestTSIGKeys(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  ServerConfig
+		want    []TSIGKey
+		wantErr bool
+	}{
+		{
+			name:   "single key defaults to hmac-sha256",
+			config: ServerConfig{TsigKey: "Key", TsigSecret: "c2VjcmV0"},
+			want:   []TSIGKey{{Name: "key.", Secret: "c2VjcmV0", Algorithm: dns.HmacSHA256, Role: TSIGRolePrimary}},
+		},
+		{
+			name:   "single key with algorithm",
+			config: ServerConfig{TsigKey: "key.", TsigSecret: "c2VjcmV0", TsigAlgorithm: "HMAC-SHA512"},
+			want:   []TSIGKey{{Name: "key.", Secret: "c2VjcmV0", Algorithm: dns.HmacSHA512, Role: TSIGRolePrimary}},
+		},
+		{
+			name: "named keys take precedence, primary first",
+			config: ServerConfig{TsigKey: "key.", TsigSecret: "c2VjcmV0", TsigKeys: []TSIGKey{
+				{Name: "old.", Secret: "b2xk", Role: "secondary"},
+				{Name: "new.", Secret: "bmV3", Algorithm: "hmac-sha384", Role: "primary"},
+			}},
+			want: []TSIGKey{
+				{Name: "new.", Secret: "bmV3", Algorithm: dns.HmacSHA384, Role: TSIGRolePrimary},
+				{Name: "old.", Secret: "b2xk", Algorithm: dns.HmacSHA256, Role: TSIGRoleSecondary},
+			},
+		},
+		{
+			name: "first key is primary by default",
+			config: ServerConfig{TsigKeys: []TSIGKey{
+				{Name: "new.", Secret: "bmV3"},
+				{Name: "old.", Secret: "b2xk"},
+			}},
+			want: []TSIGKey{
+				{Name: "new.", Secret: "bmV3", Algorithm: dns.HmacSHA256, Role: TSIGRolePrimary},
+				{Name: "old.", Secret: "b2xk", Algorithm: dns.HmacSHA256, Role: TSIGRoleSecondary},
+			},
+		},
+		{name: "missing key", config: ServerConfig{}, wantErr: true},
+		{name: "unsupported algorithm", config: ServerConfig{TsigKey: "key.", TsigSecret: "c2VjcmV0", TsigAlgorithm: "hmac-md5"}, wantErr: true},
+		{
+			name: "two primary keys",
+			config: ServerConfig{TsigKeys: []TSIGKey{
+				{Name: "a.", Secret: "YQ==", Role: "primary"},
+				{Name: "b.", Secret: "Yg==", Role: "primary"},
+			}},
+			wantErr: true,
+		},
+		{
+			name:    "no primary key",
+			config:  ServerConfig{TsigKeys: []TSIGKey{{Name: "a.", Secret: "YQ==", Role: "secondary"}}},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.config.tsigKeys()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("tsigKeys() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("tsigKeys() = %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("tsigKeys()[%d] = %v, want %v", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+// newTSIGTestServer starts a DNS server that only knows the given keys and answers requests
+// signed with other keys with BADKEY, like BIND does.
+func newTSIGTestServer(t *testing.T, secrets map[string]string) string {
+	t.Helper()
+	return startTestServer(t, dns.HandlerFunc(func(w dns.ResponseWriter, r *dns.Msg) {
+		m := new(dns.Msg)
+		m.SetReply(r)
+		tsig := r.IsTsig()
+		if w.TsigStatus() != nil {
+			// rejections are not signed, so they can't be written with WriteMsg
+			m.Rcode = dns.RcodeNotAuth
+			m.Extra = append(m.Extra, &dns.TSIG{
+				Hdr:        dns.RR_Header{Name: tsig.Hdr.Name, Rrtype: dns.TypeTSIG, Class: dns.ClassANY},
+				Algorithm:  tsig.Algorithm,
+				TimeSigned: tsig.TimeSigned,
+				Fudge:      tsig.Fudge,
+				OrigId:     r.Id,
+				Error:      dns.RcodeBadKey,
+			})
+			buf, _ := m.Pack()
+			w.Write(buf)
+			return
+		}
+		m.SetTsig(tsig.Hdr.Name, tsig.Algorithm, 300, time.Now().Unix())
+		w.WriteMsg(m)
+	}), func(server *dns.Server) { server.TsigSecret = secrets })
+}
+
+func TestExchangeFallsBackToSecondaryKey(t *testing.T) {
+	keys := []TSIGKey{
+		{Name: "new.", Secret: "bmV3", Algorithm: dns.HmacSHA256, Role: TSIGRolePrimary},
+		{Name: "old.", Secret: "b2xk", Algorithm: dns.HmacSHA512, Role: TSIGRoleSecondary},
+	}
+	c := &Client{
+		client:  &dns.Client{TsigSecret: tsigSecrets(keys)},
+		zone:    "example.com.",
+		servers: []ServerEndpoint{{Addr: newTSIGTestServer(t, map[string]string{"old.": "b2xk"}), Role: ServerRolePrimary}},
+		keys:    keys,
+	}
+
+	msg := new(dns.Msg)
+	msg.SetQuestion(c.zone, dns.TypeSOA)
+	if _, err := c.exchange(context.Background(), msg); err != nil {
+		t.Fatalf("exchange() error = %v", err)
+	}
+	health := c.HealthCheck()
+	if health.TSIGKey != "old." {
+		t.Errorf("expected the secondary key to be in use, got %q", health.TSIGKey)
+	}
+	if !errors.Is(health.TSIGError, ErrTSIGRejected) {
+		t.Errorf("expected the rejection of the primary key to be reported, got %v", health.TSIGError)
+	}
+
+	c.keys = keys[:1]
+	if _, err := c.exchange(context.Background(), msg); !errors.Is(err, ErrTSIGRejected) {
+		t.Errorf("expected ErrTSIGRejected without a valid key, got %v", err)
+	}
+	if health := c.HealthCheck(); health.TSIGKey != "" || health.TSIGError == nil {
+		t.Errorf("expected no accepted key in the health state, got %+v", health)
+	}
+}
@@ -3,8 +3,9 @@ package dnsservice
 import (
 	"fmt"
 	"net"
+	"net/url"
 	"regexp"
-	"strconv"
+	"slices"
 	"strings"
 )
 
@@ -47,21 +48,6 @@ func validateAAAARecord(value string) error {
 	return nil
 }
 
-func validateMXRecord(value string) error {
-	parts := strings.Split(value, ":")
-	if len(parts) != 2 {
-		return fmt.Errorf("invalid MX record format: %s", value)
-	}
-	_, err := strconv.Atoi(parts[0]) // Validate priority
-	if err != nil {
-		return fmt.Errorf("invalid MX record priority: %s", parts[0])
-	}
-	if !isValidFQDN(parts[1]) {
-		return fmt.Errorf("invalid MX record mail server: %s", parts[1])
-	}
-	return nil
-}
-
 func validateNSRecord(value string) error {
 	if !isValidFQDN(value) {
 		return fmt.Errorf("invalid NS record: %s", value)
@@ -76,35 +62,68 @@ func validateCNAMERecord(value string) error {
 	return nil
 }
 
-func validateTXTRecord(value string) error {
-	// For TXT records, you might want to validate the length or the content format
-	if len(value) == 0 || len(value) > 255 {
-		return fmt.Errorf("invalid TXT record length: %d", len(value))
+func validateTXTRecord(txt *TXTRecord) error {
+	if len(txt.Text) == 0 {
+		return fmt.Errorf("invalid TXT record length: %d", len(txt.Text))
+	}
+	// text is split into strings short enough, only given strings can be too long
+	for _, s := range txt.characterStrings() {
+		if len(s) > maxCharacterString {
+			return fmt.Errorf("invalid TXT character string length: %d", len(s))
+		}
 	}
 	return nil
 }
 
-func validateSRVRecord(value string) error {
-	parts := strings.Split(value, ":")
-	if len(parts) != 4 {
-		return fmt.Errorf("invalid SRV record format: %s", value)
-	}
+var (
+	caaParameterRegex = regexp.MustCompile(`^[a-zA-Z0-9]+=[\x21-\x3A\x3C-\x7E]*$`)
+	caaIodefSchemes   = []string{"mailto", "http", "https"}
+)
 
-	if _, err := strconv.Atoi(parts[0]); err != nil { // Validate priority
-		return fmt.Errorf("invalid SRV record priority: %s", parts[0])
+// validateCAAProperty validates the tag and value of a CAA record. Only the "issue", "issuewild"
+// and "iodef" properties of RFC 8659 are supported.
+func validateCAAProperty(tag, value string) error {
+	if strings.ContainsAny(value, "\"\\") {
+		return fmt.Errorf("invalid CAA record value: %s", value)
 	}
-
-	if _, err := strconv.Atoi(parts[1]); err != nil { // Validate weight
-		return fmt.Errorf("invalid SRV record weight: %s", parts[1])
+	switch strings.ToLower(tag) {
+	case "issue", "issuewild":
+		return validateCAAIssuer(value)
+	case "iodef":
+		u, err := url.Parse(value)
+		if err != nil || !slices.Contains(caaIodefSchemes, u.Scheme) || (u.Opaque == "" && u.Host == "") {
+			return fmt.Errorf("invalid CAA iodef URL: %s", value)
+		}
+		return nil
+	default:
+		return fmt.Errorf("unsupported CAA record tag: %s", tag)
 	}
+}
 
-	if _, err := strconv.Atoi(parts[2]); err != nil { // Validate port
-		return fmt.Errorf("invalid SRV record port: %s", parts[2])
+// validateCAAIssuer validates the value of an issue or issuewild property, which consists of an
+// optional issuer domain name followed by optional "key=value" parameters separated by semicolons.
+// A value without an issuer, such as ";", forbids issuance.
+func validateCAAIssuer(value string) error {
+	issuer, parameters, hasParameters := strings.Cut(value, ";")
+	issuer = strings.TrimSpace(issuer)
+	if issuer != "" && !isValidFQDN(strings.TrimSuffix(issuer, ".")+".") {
+		return fmt.Errorf("invalid CAA record issuer: %s", issuer)
 	}
-
-	if !isValidFQDN(parts[3]) { // Validate target
-		return fmt.Errorf("invalid SRV record target: %s", parts[3])
+	if !hasParameters || strings.TrimSpace(parameters) == "" {
+		return nil
+	}
+	for _, parameter := range strings.Split(parameters, ";") {
+		if !caaParameterRegex.MatchString(strings.TrimSpace(parameter)) {
+			return fmt.Errorf("invalid CAA record parameter: %s", parameter)
+		}
 	}
-
 	return nil
 }
+
+func validateRecordData(data RecordData) error {
+	t, ok := LookupRecordType(data.RecordType())
+	if !ok {
+		return fmt.Errorf("unsupported record type: %s", data.RecordType())
+	}
+	return t.Validate(data)
+}
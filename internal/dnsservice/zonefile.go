@@ -0,0 +1,141 @@
+package dnsservice
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// ZoneDiff is the difference between the records of a zone and a desired state of the zone,
+// e.g. an imported zone file.
+type ZoneDiff struct {
+	ChangeSet
+	// Skipped lists the desired records that are left alone because their names are guarded.
+	Skipped []Record
+}
+
+// WriteZoneFile writes the records as an RFC 1035 master file of the zone, preceded by the SOA
+// record if it is known. The records are sorted by name and type.
+func WriteZoneFile(w io.Writer, zone string, soa *dns.SOA, records []Record) error {
+	sorted := slices.Clone(records)
+	slices.SortStableFunc(sorted, func(a, b Record) int {
+		if c := strings.Compare(strings.ToLower(a.Name), strings.ToLower(b.Name)); c != 0 {
+			return c
+		}
+		return strings.Compare(a.Data.RecordType(), b.Data.RecordType())
+	})
+
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "; %s exported by DNSify at %s\n", zone, time.Now().UTC().Format(time.RFC3339))
+	fmt.Fprintf(bw, "$ORIGIN %s\n", zone)
+	if soa != nil {
+		fmt.Fprintln(bw, soa.String())
+	}
+	for _, record := range sorted {
+		rr, err := toRR(record)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(bw, rr.String())
+	}
+	return bw.Flush()
+}
+
+// ParseZoneFile parses an RFC 1035 master file of the zone, in which relative names are relative
+// to the zone. The SOA record is ignored since its serial is maintained by the DNS server. Records
+// of unsupported types are returned in presentation format instead of failing the import.
+func ParseZoneFile(r io.Reader, zone string) (records []Record, unsupported []string, err error) {
+	zone = dns.Fqdn(zone)
+	parser := dns.NewZoneParser(r, zone, "")
+	for rr, ok := parser.Next(); ok; rr, ok = parser.Next() {
+		if !dns.IsSubDomain(zone, rr.Header().Name) {
+			return nil, nil, fmt.Errorf("%s is not part of the zone %s", rr.Header().Name, zone)
+		}
+		if rr.Header().Rrtype == dns.TypeSOA {
+			continue
+		}
+		record, ok := recordFromRR(rr)
+		if !ok {
+			unsupported = append(unsupported, rr.String())
+			continue
+		}
+		if err := validateRecordData(record.Data); err != nil {
+			return nil, nil, fmt.Errorf("%s: %w", rr, err)
+		}
+		records = append(records, record)
+	}
+	if err := parser.Err(); err != nil {
+		return nil, nil, err
+	}
+	return records, unsupported, nil
+}
+
+// DiffRecords returns the changes that turn the current records into the desired ones. Records
+// whose TTL changed are added again, which applies the new TTL to their record set.
+func DiffRecords(current, desired []Record) ChangeSet {
+	var changes ChangeSet
+	for _, record := range current {
+		if !slices.ContainsFunc(desired, func(r Record) bool { return SameRecord(r, record) }) {
+			changes.Remove = append(changes.Remove, record)
+		}
+	}
+	for _, record := range desired {
+		unchanged := func(r Record) bool { return SameRecord(r, record) && r.TTL == record.TTL }
+		if !slices.ContainsFunc(current, unchanged) && !slices.ContainsFunc(changes.Add, unchanged) {
+			changes.Add = append(changes.Add, record)
+		}
+	}
+	return changes
+}
+
+// RetainUndeclared drops the removals of records whose record set is not declared by any of the
+// desired records, so a partial desired state only manages the record sets it lists.
+func RetainUndeclared(changes ChangeSet, desired []Record) ChangeSet {
+	declared := func(record Record) bool {
+		return slices.ContainsFunc(desired, func(r Record) bool {
+			return inRecordSet(r, record.Name, record.Data.RecordType())
+		})
+	}
+	var removals []Record
+	for _, record := range changes.Remove {
+		if declared(record) {
+			removals = append(removals, record)
+		}
+	}
+	changes.Remove = removals
+	return changes
+}
+
+// ExportZone writes the cached zone, including guarded records, as a master file.
+func (c *Client) ExportZone(w io.Writer) error {
+	c.mutex.RLock()
+	records := slices.Clone(c.cache)
+	soa := c.soa
+	c.mutex.RUnlock()
+	return WriteZoneFile(w, c.zone, soa, records)
+}
+
+// DiffZone compares the cached zone with the desired records. Guarded records are neither
+// removed nor changed, desired records of guarded names are reported as skipped.
+func (c *Client) DiffZone(desired []Record) ZoneDiff {
+	c.mutex.RLock()
+	current := slices.DeleteFunc(slices.Clone(c.cache), c.isRecordGuarded)
+	c.mutex.RUnlock()
+
+	var diff ZoneDiff
+	var kept []Record
+	for _, record := range desired {
+		if c.isRecordGuarded(record) {
+			diff.Skipped = append(diff.Skipped, record)
+			continue
+		}
+		kept = append(kept, record)
+	}
+	diff.ChangeSet = DiffRecords(current, kept)
+	return diff
+}
@@ -0,0 +1,104 @@
+package dnsservice
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+const testZoneFile = `$ORIGIN example.com.
+$TTL 3600
+@       IN SOA ns1 hostmaster 2024010101 7200 3600 1209600 300
+@       IN NS    ns1
+ns1     IN A     192.0.2.53
+www 300 IN A     192.0.2.1
+www 300 IN A     192.0.2.2
+mail    IN MX    10 mx1.example.net.
+@       IN TXT   "v=spf1 -all"
+@       IN HINFO "PC" "Linux"
+`
+
+func TestParseZoneFile(t *testing.T) {
+	records, unsupported, err := ParseZoneFile(strings.NewReader(testZoneFile), "example.com")
+	if err != nil {
+		t.Fatalf("ParseZoneFile() error = %v", err)
+	}
+	if len(records) != 6 {
+		t.Fatalf("expected 6 records without the SOA, got %v", records)
+	}
+	if records[2].Name != "www.example.com." || records[2].TTL != 300 || records[2].Data.Value() != "192.0.2.1" {
+		t.Errorf("unexpected record %v", records[2])
+	}
+	if records[4].TTL != 3600 {
+		t.Errorf("expected the default TTL, got %v", records[4])
+	}
+	if len(unsupported) != 1 || !strings.Contains(unsupported[0], "HINFO") {
+		t.Errorf("expected the HINFO record to be unsupported, got %v", unsupported)
+	}
+
+	if _, _, err := ParseZoneFile(strings.NewReader("www.example.org. 300 IN A 192.0.2.1\n"), "example.com."); err == nil {
+		t.Error("expected an error for a record outside of the zone")
+	}
+	if _, _, err := ParseZoneFile(strings.NewReader("www 300 IN A 192.0.2\n"), "example.com."); err == nil {
+		t.Error("expected an error for a malformed record")
+	}
+}
+
+func TestZoneFileRoundTrip(t *testing.T) {
+	records, _, err := ParseZoneFile(strings.NewReader(testZoneFile), "example.com.")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := WriteZoneFile(&buf, "example.com.", nil, records); err != nil {
+		t.Fatalf("WriteZoneFile() error = %v", err)
+	}
+	parsed, _, err := ParseZoneFile(&buf, "example.com.")
+	if err != nil {
+		t.Fatalf("ParseZoneFile() of the export error = %v", err)
+	}
+	if diff := DiffRecords(records, parsed); !diff.IsEmpty() {
+		t.Errorf("expected the export to round trip, got diff %+v", diff)
+	}
+}
+
+func TestDiffZone(t *testing.T) {
+	c, _ := newUpdateTestClient(t,
+		NewRecord("example.com.", 3600, &NSRecord{NameServer: "ns1.example.com."}),
+		NewRecord("www.example.com.", 300, &ARecord{IP: "192.0.2.1"}),
+		NewRecord("old.example.com.", 300, &ARecord{IP: "192.0.2.9"}),
+	)
+	c.guards = parseGuards(RecordGuards{Immutable: []string{"*/@"}}, "example.com.")
+
+	diff := c.DiffZone([]Record{
+		NewRecord("example.com.", 3600, &NSRecord{NameServer: "ns2.example.com."}),
+		NewRecord("www.example.com.", 600, &ARecord{IP: "192.0.2.1"}),
+		NewRecord("new.example.com.", 300, &ARecord{IP: "192.0.2.2"}),
+	})
+	if len(diff.Skipped) != 1 || diff.Skipped[0].Name != "example.com." {
+		t.Errorf("expected the guarded apex to be skipped, got %v", diff.Skipped)
+	}
+	if len(diff.Remove) != 1 || diff.Remove[0].Name != "old.example.com." {
+		t.Errorf("expected old to be removed, got %v", diff.Remove)
+	}
+	if len(diff.Add) != 2 || diff.Add[0].TTL != 600 || diff.Add[1].Name != "new.example.com." {
+		t.Errorf("expected the TTL change of www and new to be added, got %v", diff.Add)
+	}
+}
+
+func TestRetainUndeclared(t *testing.T) {
+	current := []Record{
+		NewRecord("www.example.com.", 300, &ARecord{IP: "192.0.2.1"}),
+		NewRecord("www.example.com.", 300, &AAAARecord{IPv6: "2001:db8::1"}),
+		NewRecord("old.example.com.", 300, &ARecord{IP: "192.0.2.9"}),
+	}
+	desired := []Record{NewRecord("www.example.com.", 300, &ARecord{IP: "192.0.2.2"})}
+
+	changes := RetainUndeclared(DiffRecords(current, desired), desired)
+	if len(changes.Remove) != 1 || changes.Remove[0].Data.Value() != "192.0.2.1" {
+		t.Errorf("expected only the replaced A record to be removed, got %v", changes.Remove)
+	}
+	if len(changes.Add) != 1 {
+		t.Errorf("expected the new A record to be added, got %v", changes.Add)
+	}
+}
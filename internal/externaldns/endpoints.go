@@ -0,0 +1,132 @@
+// Package externaldns implements the webhook provider protocol of Kubernetes ExternalDNS, which
+// publishes the hostnames of Ingresses and Services. ExternalDNS reads the records of the zones,
+// lets the provider adjust the endpoints it wants and sends the changes to apply.
+package externaldns
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/miekg/dns"
+	"github.com/theadell/dnsify/internal/dnsservice"
+)
+
+// MediaType is the content type of the webhook protocol.
+const MediaType = "application/external.dns.webhook+json;version=1"
+
+// DefaultTTL is the TTL of endpoints without a configured TTL.
+const DefaultTTL = 300
+
+// supportedTypes are the record types ExternalDNS manages that DNSify supports.
+var supportedTypes = []string{"A", "AAAA", "CNAME", "TXT", "MX", "SRV", "NS"}
+
+// Endpoint is a record set as ExternalDNS sees it. Names and hostname targets have no trailing dot.
+type Endpoint struct {
+	DNSName          string                     `json:"dnsName,omitempty"`
+	Targets          []string                   `json:"targets,omitempty"`
+	RecordType       string                     `json:"recordType,omitempty"`
+	SetIdentifier    string                     `json:"setIdentifier,omitempty"`
+	RecordTTL        int64                      `json:"recordTTL,omitempty"`
+	Labels           map[string]string          `json:"labels,omitempty"`
+	ProviderSpecific []ProviderSpecificProperty `json:"providerSpecific,omitempty"`
+}
+
+// ProviderSpecificProperty is an option of an endpoint for a particular provider.
+type ProviderSpecificProperty struct {
+	Name  string `json:"name,omitempty"`
+	Value string `json:"value,omitempty"`
+}
+
+// Changes are the endpoints ExternalDNS creates, updates and deletes. The JSON keys are the field
+// names, as ExternalDNS sends them.
+type Changes struct {
+	Create    []*Endpoint
+	UpdateOld []*Endpoint
+	UpdateNew []*Endpoint
+	Delete    []*Endpoint
+}
+
+// DomainFilter lists the domains the provider manages, it is the answer to the negotiation.
+type DomainFilter struct {
+	Include []string `json:"include,omitempty"`
+	Exclude []string `json:"exclude,omitempty"`
+}
+
+func isSupportedType(recordType string) bool {
+	return slices.Contains(supportedTypes, recordType)
+}
+
+// Endpoints converts the records of the supported types into an endpoint per record set.
+func Endpoints(records []dnsservice.Record) []*Endpoint {
+	var endpoints []*Endpoint
+	for _, set := range dnsservice.GroupRecordSets(records) {
+		if !isSupportedType(set.Type) {
+			continue
+		}
+		endpoint := &Endpoint{
+			DNSName:    strings.TrimSuffix(set.Name, "."),
+			RecordType: set.Type,
+			RecordTTL:  int64(set.TTL),
+		}
+		for _, record := range set.Records {
+			endpoint.Targets = append(endpoint.Targets, endpointTarget(set.Type, record.Data.Value()))
+		}
+		endpoints = append(endpoints, endpoint)
+	}
+	return endpoints
+}
+
+// endpointTarget returns the value of a record as target, hostnames without the trailing dot.
+func endpointTarget(recordType, value string) string {
+	switch recordType {
+	case "CNAME", "NS", "MX", "SRV":
+		return strings.TrimSuffix(value, ".")
+	default:
+		return value
+	}
+}
+
+// Records converts an endpoint into the records of the zone, one per target.
+func (e *Endpoint) Records(zone string) ([]dnsservice.Record, error) {
+	if !isSupportedType(e.RecordType) {
+		return nil, fmt.Errorf("unsupported record type %q", e.RecordType)
+	}
+	ttl := e.RecordTTL
+	if ttl <= 0 {
+		ttl = DefaultTTL
+	}
+	var zoneFile strings.Builder
+	for _, target := range e.Targets {
+		fmt.Fprintf(&zoneFile, "%s %d IN %s %s\n", dns.Fqdn(e.DNSName), ttl, e.RecordType, presentationTarget(e.RecordType, target))
+	}
+	records, unsupported, err := dnsservice.ParseZoneFile(strings.NewReader(zoneFile.String()), zone)
+	if err != nil {
+		return nil, fmt.Errorf("endpoint %s %s: %w", e.RecordType, e.DNSName, err)
+	}
+	if len(unsupported) > 0 {
+		return nil, fmt.Errorf("endpoint %s %s: unsupported records %v", e.RecordType, e.DNSName, unsupported)
+	}
+	return records, nil
+}
+
+// presentationTarget returns a target in the master file format, with fully qualified hostnames
+// and quoted text.
+func presentationTarget(recordType, target string) string {
+	switch recordType {
+	case "CNAME", "NS":
+		return dns.Fqdn(target)
+	case "MX", "SRV":
+		fields := strings.Fields(target)
+		if len(fields) > 0 {
+			fields[len(fields)-1] = dns.Fqdn(fields[len(fields)-1])
+		}
+		return strings.Join(fields, " ")
+	case "TXT":
+		text := strings.Trim(target, `"`)
+		text = strings.ReplaceAll(text, `\`, `\\`)
+		return `"` + strings.ReplaceAll(text, `"`, `\"`) + `"`
+	default:
+		return target
+	}
+}
@@ -0,0 +1,146 @@
+package externaldns
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+
+	"github.com/theadell/dnsify/internal/dnsservice"
+	"github.com/theadell/dnsify/internal/rbac"
+)
+
+func TestEndpointRecords(t *testing.T) {
+	tests := []struct {
+		endpoint Endpoint
+		want     string
+	}{
+		{Endpoint{DNSName: "www.example.com", RecordType: "A", Targets: []string{"192.0.2.1"}, RecordTTL: 60}, "192.0.2.1"},
+		{Endpoint{DNSName: "app.example.com", RecordType: "CNAME", Targets: []string{"lb.example.net"}}, "lb.example.net."},
+		{Endpoint{DNSName: "example.com", RecordType: "MX", Targets: []string{"10 mail.example.com"}}, "10 mail.example.com."},
+		{Endpoint{DNSName: "a-www.example.com", RecordType: "TXT", Targets: []string{`"heritage=external-dns,external-dns/owner=c1"`}}, "heritage=external-dns,external-dns/owner=c1"},
+	}
+	for _, tt := range tests {
+		records, err := tt.endpoint.Records("example.com.")
+		if err != nil {
+			t.Errorf("Records(%v) error = %v", tt.endpoint, err)
+			continue
+		}
+		if len(records) != 1 || records[0].Data.Value() != tt.want {
+			t.Errorf("Records(%v) = %v, want %s", tt.endpoint, records, tt.want)
+			continue
+		}
+		if tt.endpoint.RecordTTL == 0 && records[0].TTL != DefaultTTL {
+			t.Errorf("expected the default TTL, got %d", records[0].TTL)
+		}
+		back := Endpoints(records)
+		if len(back) != 1 || back[0].DNSName != tt.endpoint.DNSName || back[0].RecordType != tt.endpoint.RecordType {
+			t.Errorf("Endpoints() = %v, want %v", back, tt.endpoint)
+		}
+	}
+}
+
+func TestOwners(t *testing.T) {
+	owners := Owners([]dnsservice.Record{
+		dnsservice.NewRecord("www.example.com.", 300, &dnsservice.ARecord{IP: "192.0.2.1"}),
+		dnsservice.NewRecord("a-www.example.com.", 300, &dnsservice.TXTRecord{Text: "heritage=external-dns,external-dns/owner=cluster-1,external-dns/resource=ingress/default/web"}),
+		dnsservice.NewRecord("api.example.com.", 300, &dnsservice.TXTRecord{Text: `"heritage=external-dns,external-dns/owner=cluster-2"`}),
+		dnsservice.NewRecord("example.com.", 300, &dnsservice.TXTRecord{Text: "v=spf1 -all"}),
+		// an old format entry of a name that starts like a type prefix, b.example.com. has no A set
+		dnsservice.NewRecord("a-b.example.com.", 300, &dnsservice.ARecord{IP: "192.0.2.2"}),
+		dnsservice.NewRecord("a-b.example.com.", 300, &dnsservice.TXTRecord{Text: "heritage=external-dns,external-dns/owner=cluster-3"}),
+	})
+	tests := []struct {
+		name, recordType, want string
+	}{
+		{"www.example.com.", "A", "cluster-1"},
+		{"www.example.com.", "AAAA", ""},
+		{"a-www.example.com.", "TXT", "cluster-1"},
+		{"API.example.com.", "CNAME", "cluster-2"},
+		{"example.com.", "TXT", ""},
+		{"a-b.example.com.", "A", "cluster-3"},
+		{"b.example.com.", "A", ""},
+	}
+	for _, tt := range tests {
+		if got := owners.Owner(tt.name, tt.recordType); got != tt.want {
+			t.Errorf("Owner(%s, %s) = %q, want %q", tt.name, tt.recordType, got, tt.want)
+		}
+	}
+}
+
+func newTestProvider(t *testing.T) (*Provider, *dnsservice.MockClient) {
+	t.Helper()
+	zone := dnsservice.NewMockClientForZone("example.com.")
+	registry, err := dnsservice.NewRegistry(zone)
+	if err != nil {
+		t.Fatal(err)
+	}
+	provider, err := NewProvider(Config{}, registry)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return provider, zone
+}
+
+func TestProviderApplyChanges(t *testing.T) {
+	provider, zone := newTestProvider(t)
+	changes := Changes{
+		Create:    []*Endpoint{{DNSName: "web.example.com", RecordType: "A", Targets: []string{"192.0.2.10"}}},
+		UpdateOld: []*Endpoint{{DNSName: "foo.example.com", RecordType: "A", Targets: []string{"192.168.1.1"}, RecordTTL: 100}},
+		UpdateNew: []*Endpoint{{DNSName: "foo.example.com", RecordType: "A", Targets: []string{"192.0.2.20"}, RecordTTL: 100}},
+		Delete:    []*Endpoint{{DNSName: "gone.example.com", RecordType: "A", Targets: []string{"192.0.2.30"}}},
+	}
+	body, _ := json.Marshal(changes)
+	rec := httptest.NewRecorder()
+	provider.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/records", bytes.NewReader(body)))
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("POST /records = %d %s", rec.Code, rec.Body)
+	}
+
+	var values []string
+	for _, record := range zone.GetRecords() {
+		if record.Data.RecordType() == "A" {
+			values = append(values, record.Name+" "+record.Data.Value())
+		}
+	}
+	for _, want := range []string{"web.example.com. 192.0.2.10", "foo.example.com. 192.0.2.20"} {
+		if !slices.Contains(values, want) {
+			t.Errorf("expected %s among %v", want, values)
+		}
+	}
+	if slices.Contains(values, "foo.example.com. 192.168.1.1") {
+		t.Errorf("expected the old record to be removed, got %v", values)
+	}
+
+	rec = httptest.NewRecorder()
+	provider.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/records", nil))
+	var endpoints []*Endpoint
+	if err := json.Unmarshal(rec.Body.Bytes(), &endpoints); err != nil || rec.Header().Get("Content-Type") != MediaType {
+		t.Fatalf("GET /records = %s, %v", rec.Body, err)
+	}
+	if !slices.ContainsFunc(endpoints, func(e *Endpoint) bool { return e.DNSName == "web.example.com" && e.RecordType == "A" }) {
+		t.Errorf("expected the created endpoint in %s", rec.Body)
+	}
+}
+
+func TestProviderAdjustEndpoints(t *testing.T) {
+	provider, _ := newTestProvider(t)
+	ctx := rbac.WithRole(context.Background(), rbac.RoleViewer)
+	adjusted := provider.AdjustEndpoints(ctx, []*Endpoint{{DNSName: "web.example.com", RecordType: "A", Targets: []string{"192.0.2.10"}}})
+	if len(adjusted) != 0 {
+		t.Errorf("expected endpoints the role may not change to be dropped, got %v", adjusted)
+	}
+
+	ctx = rbac.WithRole(context.Background(), rbac.RoleEditor)
+	adjusted = provider.AdjustEndpoints(ctx, []*Endpoint{
+		{DNSName: "web.example.com", RecordType: "A", Targets: []string{"192.0.2.10"}},
+		{DNSName: "web.example.org", RecordType: "A", Targets: []string{"192.0.2.10"}},
+		{DNSName: "web.example.com", RecordType: "NAPTR", Targets: []string{"x"}},
+	})
+	if len(adjusted) != 1 || adjusted[0].RecordTTL != DefaultTTL {
+		t.Errorf("expected only the endpoint in the zone with the default TTL, got %v", adjusted)
+	}
+}
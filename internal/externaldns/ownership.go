@@ -0,0 +1,75 @@
+package externaldns
+
+import (
+	"strings"
+
+	"github.com/theadell/dnsify/internal/dnsservice"
+)
+
+const (
+	heritageLabel = "heritage"
+	heritage      = "external-dns"
+	ownerLabel    = "external-dns/owner"
+)
+
+// Ownership maps the record sets managed by ExternalDNS to the owner ID of the cluster that
+// manages them, as recorded by the TXT registry of ExternalDNS.
+type Ownership map[string]string
+
+// Owners reads the TXT registry entries among the records. An entry is a TXT record like
+// "heritage=external-dns,external-dns/owner=cluster-1,...", named after the record it owns with
+// the type as prefix of the first label, e.g. a-www.example.com., or in the old format exactly
+// like the owned name, covering all of its types. A name like a-www.example.com. is only read as
+// a type prefix if the records contain the owned record set, otherwise it is an old format entry.
+func Owners(records []dnsservice.Record) Ownership {
+	sets := map[string]bool{}
+	for _, record := range records {
+		sets[ownershipKey(record.Name, record.Data.RecordType())] = true
+	}
+	owners := Ownership{}
+	for _, record := range records {
+		if record.Data.RecordType() != "TXT" {
+			continue
+		}
+		labels := parseLabels(record.Data.Value())
+		if labels[heritageLabel] != heritage {
+			continue
+		}
+		owner := labels[ownerLabel]
+		name := strings.ToLower(record.Name)
+		owners[ownershipKey(name, "TXT")] = owner
+
+		first, rest, _ := strings.Cut(name, ".")
+		if recordType, label, ok := strings.Cut(first, "-"); ok && isSupportedType(strings.ToUpper(recordType)) {
+			if key := ownershipKey(label+"."+rest, strings.ToUpper(recordType)); sets[key] {
+				owners[key] = owner
+				continue
+			}
+		}
+		owners[ownershipKey(name, "*")] = owner
+	}
+	return owners
+}
+
+// Owner returns the owner ID of the record set, or "" if ExternalDNS does not manage it.
+func (o Ownership) Owner(name, recordType string) string {
+	if owner, ok := o[ownershipKey(name, recordType)]; ok {
+		return owner
+	}
+	return o[ownershipKey(name, "*")]
+}
+
+func ownershipKey(name, recordType string) string {
+	return strings.ToLower(name) + "/" + recordType
+}
+
+// parseLabels parses the comma separated key=value labels of a TXT registry entry.
+func parseLabels(text string) map[string]string {
+	labels := map[string]string{}
+	for _, pair := range strings.Split(strings.Trim(text, `"`), ",") {
+		if key, value, ok := strings.Cut(pair, "="); ok {
+			labels[strings.TrimSpace(key)] = strings.TrimSpace(value)
+		}
+	}
+	return labels
+}
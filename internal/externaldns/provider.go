@@ -0,0 +1,229 @@
+package externaldns
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/theadell/dnsify/internal/dnsservice"
+	"github.com/theadell/dnsify/internal/journal"
+	"github.com/theadell/dnsify/internal/rbac"
+)
+
+// maxRequestSize limits the size of the request bodies ExternalDNS sends.
+const maxRequestSize = 4 << 20
+
+// requestTimeout bounds the DNS exchanges of a request.
+const requestTimeout = 30 * time.Second
+
+// Config configures the webhook provider.
+type Config struct {
+	// Listen is the address the webhook listens on, e.g. "127.0.0.1:8888". ExternalDNS does not
+	// authenticate, so it must only be reachable by the cluster. The webhook is disabled if empty.
+	Listen string `mapstructure:"listen"`
+	// Role is the role changes are made with, editor by default, so records guarded as admin only
+	// are left alone.
+	Role string `mapstructure:"role"`
+}
+
+// Provider serves the webhook protocol for the zones of a registry.
+type Provider struct {
+	zones *dnsservice.Registry
+	role  rbac.Role
+}
+
+// NewProvider returns a provider for the zones of the registry.
+func NewProvider(config Config, zones *dnsservice.Registry) (*Provider, error) {
+	role := rbac.RoleEditor
+	if config.Role != "" {
+		var err error
+		if role, err = rbac.ParseRole(config.Role); err != nil {
+			return nil, fmt.Errorf("externaldns: %w", err)
+		}
+	}
+	return &Provider{zones: zones, role: role}, nil
+}
+
+func (p *Provider) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(p.requestContext(r), requestTimeout)
+	defer cancel()
+	switch {
+	case r.URL.Path == "/" && r.Method == http.MethodGet:
+		writeJSON(w, http.StatusOK, p.Negotiate())
+	case r.URL.Path == "/records" && r.Method == http.MethodGet:
+		writeJSON(w, http.StatusOK, p.Records())
+	case r.URL.Path == "/records" && r.Method == http.MethodPost:
+		var changes Changes
+		if err := decodeJSON(w, r, &changes); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := p.ApplyChanges(ctx, changes); err != nil {
+			slog.Error("Failed to apply ExternalDNS changes", "error", err.Error())
+			http.Error(w, err.Error(), statusOf(err))
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	case r.URL.Path == "/adjustendpoints" && r.Method == http.MethodPost:
+		var endpoints []*Endpoint
+		if err := decodeJSON(w, r, &endpoints); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		writeJSON(w, http.StatusOK, p.AdjustEndpoints(ctx, endpoints))
+	case r.URL.Path == "/healthz":
+		w.WriteHeader(http.StatusOK)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// requestContext attributes the changes of a request to ExternalDNS and makes them with the role
+// of the provider.
+func (p *Provider) requestContext(r *http.Request) context.Context {
+	actor := journal.Actor{Name: "ExternalDNS", SourceIP: r.RemoteAddr}
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		actor.SourceIP = host
+	}
+	return rbac.WithRole(journal.WithActor(r.Context(), actor), p.role)
+}
+
+// Negotiate returns the zones of the registry as domain filter.
+func (p *Provider) Negotiate() DomainFilter {
+	var filter DomainFilter
+	for _, zone := range p.zones.Zones() {
+		filter.Include = append(filter.Include, strings.TrimSuffix(zone, "."))
+	}
+	return filter
+}
+
+// Records returns the endpoints of all zones.
+func (p *Provider) Records() []*Endpoint {
+	endpoints := []*Endpoint{}
+	for _, zone := range p.zones.Services() {
+		endpoints = append(endpoints, Endpoints(zone.GetRecords())...)
+	}
+	return endpoints
+}
+
+// AdjustEndpoints drops the endpoints DNSify can't manage, as they are outside the zones, of an
+// unsupported type or guarded against changes by the provider's role, and sets the default TTL.
+func (p *Provider) AdjustEndpoints(ctx context.Context, endpoints []*Endpoint) []*Endpoint {
+	adjusted := make([]*Endpoint, 0, len(endpoints))
+	for _, endpoint := range endpoints {
+		if endpoint.SetIdentifier != "" || !isSupportedType(endpoint.RecordType) {
+			slog.Info("Ignoring unsupported ExternalDNS endpoint", "name", endpoint.DNSName, "type", endpoint.RecordType)
+			continue
+		}
+		name := strings.ToLower(strings.TrimSuffix(endpoint.DNSName, ".")) + "."
+		zone, err := p.zones.Lookup(name)
+		if err != nil {
+			slog.Info("Ignoring ExternalDNS endpoint outside the zones", "name", endpoint.DNSName)
+			continue
+		}
+		if err := zone.Authorize(ctx, name, endpoint.RecordType); err != nil {
+			slog.Info("Ignoring guarded ExternalDNS endpoint", "name", endpoint.DNSName, "type", endpoint.RecordType, "error", err.Error())
+			continue
+		}
+		if endpoint.RecordTTL <= 0 {
+			endpoint.RecordTTL = DefaultTTL
+		}
+		adjusted = append(adjusted, endpoint)
+	}
+	return adjusted
+}
+
+// ApplyChanges applies the changes with a change set per zone. Deleted endpoints and the old
+// state of updated endpoints are removed, records that no longer exist are skipped.
+func (p *Provider) ApplyChanges(ctx context.Context, changes Changes) error {
+	sets := map[string]*dnsservice.ChangeSet{}
+	services := map[string]dnsservice.Service{}
+	changeSet := func(endpoint *Endpoint) (dnsservice.Service, *dnsservice.ChangeSet, []dnsservice.Record, error) {
+		zone, err := p.zones.Lookup(endpoint.DNSName)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		records, err := endpoint.Records(zone.GetZone())
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		if _, ok := sets[zone.GetZone()]; !ok {
+			sets[zone.GetZone()] = &dnsservice.ChangeSet{}
+			services[zone.GetZone()] = zone
+		}
+		return zone, sets[zone.GetZone()], records, nil
+	}
+
+	for _, endpoint := range append(slices.Clone(changes.Delete), changes.UpdateOld...) {
+		zone, set, records, err := changeSet(endpoint)
+		if err != nil {
+			return err
+		}
+		current := zone.GetRecords()
+		for _, record := range records {
+			if slices.ContainsFunc(current, func(r dnsservice.Record) bool { return dnsservice.SameRecord(r, record) }) {
+				set.Remove = append(set.Remove, record)
+			}
+		}
+	}
+	for _, endpoint := range append(slices.Clone(changes.Create), changes.UpdateNew...) {
+		_, set, records, err := changeSet(endpoint)
+		if err != nil {
+			return err
+		}
+		set.Add = append(set.Add, records...)
+	}
+
+	var errs []error
+	for zone, set := range sets {
+		if set.IsEmpty() {
+			continue
+		}
+		if err := services[zone].ApplyChangeSet(ctx, *set); err != nil {
+			errs = append(errs, fmt.Errorf("zone %s: %w", zone, err))
+			continue
+		}
+		slog.Info("Applied ExternalDNS changes", "zone", zone, "add", len(set.Add), "remove", len(set.Remove))
+	}
+	return errors.Join(errs...)
+}
+
+// statusOf returns the HTTP status of an error of ApplyChanges.
+func statusOf(err error) int {
+	switch {
+	case errors.Is(err, dnsservice.ErrImmutableRecord), errors.Is(err, dnsservice.ErrNotAuthorized):
+		return http.StatusForbidden
+	case errors.Is(err, dnsservice.ErrZoneNotFound), errors.Is(err, dnsservice.ErrInvalidChangeSet):
+		return http.StatusUnprocessableEntity
+	case errors.Is(err, dnsservice.ErrRecordConflict):
+		return http.StatusConflict
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+func decodeJSON(w http.ResponseWriter, r *http.Request, dst any) error {
+	r.Body = http.MaxBytesReader(w, r.Body, maxRequestSize)
+	if err := json.NewDecoder(r.Body).Decode(dst); err != nil {
+		return fmt.Errorf("invalid request body: %w", err)
+	}
+	return nil
+}
+
+func writeJSON(w http.ResponseWriter, status int, data any) {
+	b, err := json.Marshal(data)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", MediaType)
+	w.WriteHeader(status)
+	w.Write(b)
+}
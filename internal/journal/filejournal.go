@@ -0,0 +1,104 @@
+package journal
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// fileJournal appends entries as JSON lines to a file and keeps them in memory.
+type fileJournal struct {
+	entries  []Entry
+	mutex    sync.RWMutex
+	filePath string
+}
+
+func NewFileJournal(filePath string) (Journal, error) {
+	j := &fileJournal{filePath: filePath}
+	if err := j.load(); err != nil {
+		return nil, err
+	}
+	return j, nil
+}
+
+func (j *fileJournal) load() error {
+	file, err := os.Open(j.filePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil // created on the first change
+		}
+		return err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if strings.TrimSpace(scanner.Text()) == "" {
+			continue
+		}
+		var entry Entry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return fmt.Errorf("%s:%d: %w", j.filePath, line, err)
+		}
+		j.entries = append(j.entries, entry)
+	}
+	return scanner.Err()
+}
+
+func (j *fileJournal) Append(ctx context.Context, entry Entry) (Entry, error) {
+	id, err := newEntryID()
+	if err != nil {
+		return Entry{}, err
+	}
+	entry.ID = id
+	entry.Time = time.Now().UTC()
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return Entry{}, err
+	}
+
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+	file, err := os.OpenFile(j.filePath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return Entry{}, err
+	}
+	defer file.Close()
+	if _, err := file.Write(append(data, '\n')); err != nil {
+		return Entry{}, err
+	}
+	j.entries = append(j.entries, entry)
+	return entry, nil
+}
+
+func (j *fileJournal) Entries(ctx context.Context, zone, name string, limit int) ([]Entry, error) {
+	j.mutex.RLock()
+	defer j.mutex.RUnlock()
+
+	var entries []Entry
+	for i := len(j.entries) - 1; i >= 0 && (limit <= 0 || len(entries) < limit); i-- {
+		entry := j.entries[i]
+		if entry.Zone == zone && (name == "" || entry.Touches(name)) {
+			entries = append(entries, entry)
+		}
+	}
+	return entries, nil
+}
+
+func (j *fileJournal) Get(ctx context.Context, id string) (Entry, error) {
+	j.mutex.RLock()
+	defer j.mutex.RUnlock()
+
+	for _, entry := range j.entries {
+		if entry.ID == id {
+			return entry, nil
+		}
+	}
+	return Entry{}, ErrEntryNotFound
+}
@@ -0,0 +1,52 @@
+package journal
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+func TestFileJournal(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "journal.jsonl")
+	j, err := NewFileJournal(path)
+	if err != nil {
+		t.Fatalf("NewFileJournal() error = %v", err)
+	}
+
+	first, err := j.Append(ctx, Entry{Zone: "example.com.", Action: ActionAdd, Changes: []RecordSetChange{
+		{Name: "www.example.com.", Type: "A", After: []string{"www.example.com.\t300\tIN\tA\t192.0.2.1"}},
+	}})
+	if err != nil {
+		t.Fatalf("Append() error = %v", err)
+	}
+	if first.ID == "" || first.Time.IsZero() {
+		t.Errorf("expected an ID and a time to be assigned, got %+v", first)
+	}
+	j.Append(ctx, Entry{Zone: "example.com.", Action: ActionRemove, Changes: []RecordSetChange{{Name: "mail.example.com.", Type: "MX"}}})
+	j.Append(ctx, Entry{Zone: "example.org.", Action: ActionAdd, Changes: []RecordSetChange{{Name: "www.example.org.", Type: "A"}}})
+
+	// entries survive a restart
+	j, err = NewFileJournal(path)
+	if err != nil {
+		t.Fatalf("NewFileJournal() error = %v", err)
+	}
+	entries, _ := j.Entries(ctx, "example.com.", "", 0)
+	if len(entries) != 2 || entries[0].Action != ActionRemove || entries[1].ID != first.ID {
+		t.Errorf("expected the entries of the zone newest first, got %+v", entries)
+	}
+	entries, _ = j.Entries(ctx, "example.com.", "www.example.com.", 0)
+	if len(entries) != 1 || entries[0].Changes[0].After[0] != first.Changes[0].After[0] {
+		t.Errorf("expected the entry of www, got %+v", entries)
+	}
+	if entries, _ := j.Entries(ctx, "example.com.", "", 1); len(entries) != 1 {
+		t.Errorf("expected the limit to apply, got %d entries", len(entries))
+	}
+	if _, err := j.Get(ctx, first.ID); err != nil {
+		t.Errorf("Get() error = %v", err)
+	}
+	if _, err := j.Get(ctx, "unknown"); !errors.Is(err, ErrEntryNotFound) {
+		t.Errorf("Get() error = %v, want %v", err, ErrEntryNotFound)
+	}
+}
@@ -0,0 +1,95 @@
+// Package journal records the changes DNSify makes to its zones, so they can be reviewed and
+// rolled back.
+package journal
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"time"
+)
+
+var ErrEntryNotFound = errors.New("journal entry not found")
+
+// Actions describe what caused a change.
+const (
+	ActionAdd       = "add"
+	ActionReplace   = "replace"
+	ActionRemove    = "remove"
+	ActionChangeSet = "change set"
+	ActionRollback  = "rollback"
+)
+
+// Actor is who made a change, either the email of a dashboard user or the label of an API key.
+type Actor struct {
+	Name     string
+	SourceIP string
+}
+
+type actorKey struct{}
+
+// WithActor returns a context that attributes the changes made with it to the actor.
+func WithActor(ctx context.Context, actor Actor) context.Context {
+	return context.WithValue(ctx, actorKey{}, actor)
+}
+
+// ActorFromContext returns the actor of the context, or the zero Actor if there is none.
+func ActorFromContext(ctx context.Context) Actor {
+	actor, _ := ctx.Value(actorKey{}).(Actor)
+	return actor
+}
+
+// RecordSetChange is the state of a record set before and after a change. The records are in
+// presentation format, an empty list means the record set did not exist.
+type RecordSetChange struct {
+	Name   string   `json:"name"`
+	Type   string   `json:"type"`
+	Before []string `json:"before"`
+	After  []string `json:"after"`
+	// Incomplete reports that records of the set could not be recorded, so Before and After
+	// don't describe the record set and the change can't be rolled back.
+	Incomplete bool `json:"incomplete,omitempty"`
+}
+
+// Entry is a change of one or more record sets of a zone, applied with a single update.
+type Entry struct {
+	ID       string            `json:"id"`
+	Zone     string            `json:"zone"`
+	Time     time.Time         `json:"time"`
+	Actor    string            `json:"actor"`
+	SourceIP string            `json:"sourceIp"`
+	Action   string            `json:"action"`
+	Changes  []RecordSetChange `json:"changes"`
+	// RollbackOf is the ID of the entry a rollback reverted.
+	RollbackOf string `json:"rollbackOf,omitempty"`
+}
+
+// Touches reports whether the entry changed a record set of the name.
+func (e Entry) Touches(name string) bool {
+	for _, change := range e.Changes {
+		if change.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Journal stores the change history of all zones.
+type Journal interface {
+	// Append stores the entry, assigning it an ID and the current time.
+	Append(ctx context.Context, entry Entry) (Entry, error)
+	// Entries returns up to limit entries of the zone, newest first. If name is not empty, only
+	// entries that changed a record set of the name are returned.
+	Entries(ctx context.Context, zone, name string, limit int) ([]Entry, error)
+	// Get returns the entry with the ID or ErrEntryNotFound.
+	Get(ctx context.Context, id string) (Entry, error)
+}
+
+func newEntryID() (string, error) {
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(id), nil
+}
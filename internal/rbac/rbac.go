@@ -0,0 +1,152 @@
+// Package rbac assigns roles to the users of DNSify. Roles are ordered, each role may do
+// everything the roles below it may do: viewers only read zones, editors change records and
+// admins also change the records guarded as admin only.
+package rbac
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// Role is the role of a user. The zero value is no role.
+type Role int
+
+const (
+	RoleViewer Role = iota + 1
+	RoleEditor
+	RoleAdmin
+)
+
+var roleNames = map[Role]string{
+	RoleViewer: "viewer",
+	RoleEditor: "editor",
+	RoleAdmin:  "admin",
+}
+
+func (r Role) String() string {
+	if name, ok := roleNames[r]; ok {
+		return name
+	}
+	return "none"
+}
+
+// ParseRole returns the role with the given name, e.g. "editor".
+func ParseRole(name string) (Role, error) {
+	for role, roleName := range roleNames {
+		if strings.EqualFold(strings.TrimSpace(name), roleName) {
+			return role, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown role %q, want viewer, editor or admin", name)
+}
+
+// CanEdit reports whether the role may change records.
+func (r Role) CanEdit() bool {
+	return r >= RoleEditor
+}
+
+// IsAdmin reports whether the role may change records guarded as admin only.
+func (r Role) IsAdmin() bool {
+	return r >= RoleAdmin
+}
+
+// UserRole assigns a role to the user with the email address.
+type UserRole struct {
+	Email string `mapstructure:"email"`
+	Role  string `mapstructure:"role"`
+}
+
+// GroupRole assigns a role to the members of a group of the identity provider, as listed in the
+// groups claim of the ID token.
+type GroupRole struct {
+	Group string `mapstructure:"group"`
+	Role  string `mapstructure:"role"`
+}
+
+// Config assigns roles to users. A role assigned to the user takes precedence over the roles of
+// their groups, of which the highest applies. Users without any assignment get the default role.
+type Config struct {
+	// DefaultRole defaults to editor.
+	DefaultRole string      `mapstructure:"defaultRole"`
+	Users       []UserRole  `mapstructure:"users"`
+	Groups      []GroupRole `mapstructure:"groups"`
+}
+
+// Policy resolves the roles of users as configured.
+type Policy struct {
+	defaultRole Role
+	users       map[string]Role
+	groups      map[string]Role
+}
+
+// NewPolicy validates the configuration and returns its policy.
+func NewPolicy(config Config) (*Policy, error) {
+	p := &Policy{
+		defaultRole: RoleEditor,
+		users:       make(map[string]Role, len(config.Users)),
+		groups:      make(map[string]Role, len(config.Groups)),
+	}
+	if config.DefaultRole != "" {
+		role, err := ParseRole(config.DefaultRole)
+		if err != nil {
+			return nil, fmt.Errorf("rbac: default role: %w", err)
+		}
+		p.defaultRole = role
+	}
+	for _, user := range config.Users {
+		role, err := ParseRole(user.Role)
+		if err != nil {
+			return nil, fmt.Errorf("rbac: user %s: %w", user.Email, err)
+		}
+		p.users[strings.ToLower(user.Email)] = role
+	}
+	for _, group := range config.Groups {
+		role, err := ParseRole(group.Role)
+		if err != nil {
+			return nil, fmt.Errorf("rbac: group %s: %w", group.Group, err)
+		}
+		p.groups[strings.ToLower(group.Group)] = role
+	}
+	return p, nil
+}
+
+// RoleOf returns the role of the user with the email address and the groups.
+func (p *Policy) RoleOf(email string, groups []string) Role {
+	if role, ok := p.users[strings.ToLower(email)]; ok {
+		return role
+	}
+	var highest Role
+	for _, group := range groups {
+		if role := p.groups[strings.ToLower(group)]; role > highest {
+			highest = role
+		}
+	}
+	if highest != 0 {
+		return highest
+	}
+	return p.defaultRole
+}
+
+// KeyRole returns the role of an API key of the user with the email address, given the groups the
+// user had when creating the key. Keys whose groups are unknown (nil) are limited to viewer unless
+// the user has an assignment of their own, as the groups may have made the user a viewer.
+func (p *Policy) KeyRole(email string, groups []string) Role {
+	if _, ok := p.users[strings.ToLower(email)]; !ok && groups == nil {
+		return RoleViewer
+	}
+	return p.RoleOf(email, groups)
+}
+
+type roleContextKey struct{}
+
+// WithRole returns a copy of ctx that carries the role of the user a request is made by.
+func WithRole(ctx context.Context, role Role) context.Context {
+	return context.WithValue(ctx, roleContextKey{}, role)
+}
+
+// RoleFromContext returns the role stored in ctx by WithRole.
+func RoleFromContext(ctx context.Context) (Role, bool) {
+	role, ok := ctx.Value(roleContextKey{}).(Role)
+	return role, ok
+}
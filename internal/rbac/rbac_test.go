@@ -0,0 +1,82 @@
+package rbac
+
+import (
+	"context"
+	"testing"
+)
+
+func TestPolicyRoleOf(t *testing.T) {
+	policy, err := NewPolicy(Config{
+		DefaultRole: "viewer",
+		Users:       []UserRole{{Email: "Alice@example.com", Role: "admin"}, {Email: "bob@example.com", Role: "viewer"}},
+		Groups:      []GroupRole{{Group: "dns-editors", Role: "editor"}, {Group: "dns-admins", Role: "Admin"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		email  string
+		groups []string
+		want   Role
+	}{
+		{"alice@example.com", nil, RoleAdmin},
+		{"bob@example.com", []string{"dns-admins"}, RoleViewer},
+		{"carol@example.com", []string{"dns-editors", "DNS-Admins"}, RoleAdmin},
+		{"dave@example.com", []string{"dns-editors"}, RoleEditor},
+		{"erin@example.com", []string{"other"}, RoleViewer},
+	}
+	for _, tt := range tests {
+		if got := policy.RoleOf(tt.email, tt.groups); got != tt.want {
+			t.Errorf("RoleOf(%q, %q) = %s, want %s", tt.email, tt.groups, got, tt.want)
+		}
+	}
+}
+
+func TestPolicyKeyRole(t *testing.T) {
+	policy, err := NewPolicy(Config{
+		Users:  []UserRole{{Email: "alice@example.com", Role: "admin"}},
+		Groups: []GroupRole{{Group: "support", Role: "viewer"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		email  string
+		groups []string
+		want   Role
+	}{
+		// a viewer only through a group must not get the default editor role with an API key
+		{"bob@example.com", []string{"support"}, RoleViewer},
+		{"bob@example.com", nil, RoleViewer},
+		{"carol@example.com", []string{}, RoleEditor},
+		{"alice@example.com", nil, RoleAdmin},
+	}
+	for _, tt := range tests {
+		if got := policy.KeyRole(tt.email, tt.groups); got != tt.want {
+			t.Errorf("KeyRole(%q, %q) = %s, want %s", tt.email, tt.groups, got, tt.want)
+		}
+	}
+}
+
+func TestNewPolicyDefaults(t *testing.T) {
+	policy, err := NewPolicy(Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := policy.RoleOf("someone@example.com", nil); got != RoleEditor {
+		t.Errorf("default role = %s, want editor", got)
+	}
+	if _, err := NewPolicy(Config{Users: []UserRole{{Email: "a@example.com", Role: "owner"}}}); err == nil {
+		t.Error("expected an error for an unknown role")
+	}
+}
+
+func TestRoleContext(t *testing.T) {
+	if _, ok := RoleFromContext(context.Background()); ok {
+		t.Error("expected no role in an empty context")
+	}
+	role, ok := RoleFromContext(WithRole(context.Background(), RoleEditor))
+	if !ok || role != RoleEditor || !role.CanEdit() || role.IsAdmin() {
+		t.Errorf("unexpected role %s", role)
+	}
+}